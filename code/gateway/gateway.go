@@ -0,0 +1,211 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gateway OpenAI 兼容网关，内部脚本凭团队 Token 调用，复用机器人的密钥池、代理和模型路由
+type Gateway struct {
+	gpt    *openai.ChatGPT
+	config *initialization.GatewayConfig
+	quota  *quota
+	usage  *usageLogger
+}
+
+func NewGateway(gpt *openai.ChatGPT, config *initialization.GatewayConfig,
+	usageLog string) *Gateway {
+	return &Gateway{
+		gpt:    gpt,
+		config: config,
+		quota:  newQuota(),
+		usage:  &usageLogger{path: usageLog},
+	}
+}
+
+// Register 注册 /v1/chat/completions 和 /v1/models
+func (g *Gateway) Register(r *gin.Engine) {
+	v1 := r.Group("/v1", g.auth)
+	v1.POST("/chat/completions", g.chatCompletions)
+	v1.GET("/models", g.models)
+}
+
+const teamKey = "gateway_team"
+
+// apiError 按 OpenAI 的错误格式返回
+func apiError(c *gin.Context, status int, errType string, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{"message": message, "type": errType},
+	})
+}
+
+func (g *Gateway) auth(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	for _, team := range g.config.Teams {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(team.Token)) == 1 {
+			c.Set(teamKey, team)
+			c.Next()
+			return
+		}
+	}
+	apiError(c, http.StatusUnauthorized, "invalid_request_error", "Invalid API token")
+}
+
+// resolveModel 把别名解析为上游模型ID
+func (g *Gateway) resolveModel(model string) string {
+	if target, ok := g.config.ModelAlias[model]; ok {
+		return target
+	}
+	return model
+}
+
+func allowed(team initialization.GatewayTeam, model string) bool {
+	if len(team.Models) == 0 {
+		return true
+	}
+	for _, m := range team.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Gateway) chatCompletions(c *gin.Context) {
+	team := c.MustGet(teamKey).(initialization.GatewayTeam)
+	start := time.Now()
+
+	// 用 map 解析，未识别的字段原样转发
+	var body map[string]interface{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body")
+		return
+	}
+	model, _ := body["model"].(string)
+	if model == "" {
+		model = g.gpt.Model
+	}
+	model = g.resolveModel(model)
+	if !allowed(team, model) {
+		apiError(c, http.StatusForbidden, "invalid_request_error",
+			"Model "+model+" is not allowed for team "+team.Name)
+		return
+	}
+	if ok, reason := g.quota.acquire(team); !ok {
+		apiError(c, http.StatusTooManyRequests, "rate_limit_exceeded", reason)
+		return
+	}
+	body["model"] = model
+	stream, _ := body["stream"].(bool)
+	if stream {
+		// 让上游在最后一个事件里带上用量，用于统计
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	reqBody, _ := json.Marshal(body)
+
+	record := usageRecord{Time: start, Team: team.Name, Model: model, Stream: stream}
+	defer func() {
+		record.Duration = time.Since(start).Milliseconds()
+		g.quota.addTokens(team.Name, record.TotalTokens)
+		g.usage.log(record)
+	}()
+
+	resp, err := g.gpt.Forward(c.Request.Context(), "chat/completions", reqBody)
+	if err != nil {
+		record.Status = http.StatusBadGateway
+		apiError(c, http.StatusBadGateway, "api_error", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	record.Status = resp.StatusCode
+
+	if !stream || resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		var parsed struct {
+			Usage Usage `json:"usage"`
+		}
+		if json.Unmarshal(data, &parsed) == nil {
+			record.Usage = parsed.Usage
+		}
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		c.Data(resp.StatusCode, contentType, data)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	record.Usage = passthroughSSE(c.Writer, resp.Body)
+}
+
+// passthroughSSE 逐行转发上游的 SSE 事件，并从中取出用量
+func passthroughSSE(w gin.ResponseWriter, body io.Reader) Usage {
+	var usage Usage
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, werr := w.Write(line); werr != nil {
+				return usage
+			}
+			w.Flush()
+			if data := bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data:")); len(data) > 0 &&
+				bytes.Contains(data, []byte(`"usage"`)) {
+				var chunk struct {
+					Usage *Usage `json:"usage"`
+				}
+				if json.Unmarshal(bytes.TrimSpace(data), &chunk) == nil && chunk.Usage != nil {
+					usage = *chunk.Usage
+				}
+			}
+		}
+		if err != nil {
+			w.Flush()
+			return usage
+		}
+	}
+}
+
+func (g *Gateway) models(c *gin.Context) {
+	team := c.MustGet(teamKey).(initialization.GatewayTeam)
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	var data []model
+	for id, info := range openai.SupportedModels {
+		// 自动选择只在机器人对话中生效，网关原样转发不做路由
+		if id == openai.AutoModel {
+			continue
+		}
+		if allowed(team, id) {
+			data = append(data, model{ID: id, Object: "model", OwnedBy: string(info.Provider)})
+		}
+	}
+	for alias, target := range g.config.ModelAlias {
+		if allowed(team, target) {
+			data = append(data, model{ID: alias, Object: "model", OwnedBy: "alias:" + target})
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].ID < data[j].ID })
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/loadbalancer"
+	"start-feishubot/services/openai"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestGateway(t *testing.T, upstream http.HandlerFunc) (*gin.Engine, *Gateway) {
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	gpt := &openai.ChatGPT{
+		Lb:       loadbalancer.NewLoadBalancer([]string{"sk-upstream"}),
+		ApiUrl:   server.URL,
+		Model:    "openai/gpt-4o",
+		Platform: openai.OpenRouter,
+	}
+	g := NewGateway(gpt, &initialization.GatewayConfig{
+		Teams: []initialization.GatewayTeam{
+			{Name: "data", Token: "team-token", DailyRequests: 2},
+		},
+		ModelAlias: map[string]string{"gpt-4o": "openai/gpt-4o"},
+	}, "")
+	r := gin.New()
+	g.Register(r)
+	return r, g
+}
+
+func post(r *gin.Engine, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChatCompletionsForwardsWithPoolKey(t *testing.T) {
+	var upstreamBody map[string]interface{}
+	var upstreamAuth string
+	r, g := newTestGateway(t, func(w http.ResponseWriter, req *http.Request) {
+		upstreamAuth = req.Header.Get("Authorization")
+		data, _ := ioutil.ReadAll(req.Body)
+		json.Unmarshal(data, &upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"}}],` +
+			`"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	})
+
+	if rec := post(r, "wrong", `{"model":"gpt-4o"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown token, got %d", rec.Code)
+	}
+
+	rec := post(r, "team-token", `{"model":"gpt-4o","messages":[],"user":"script"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstreamAuth != "Bearer sk-upstream" {
+		t.Fatalf("expected pool key upstream, got %q", upstreamAuth)
+	}
+	if upstreamBody["model"] != "openai/gpt-4o" || upstreamBody["user"] != "script" {
+		t.Fatalf("unexpected upstream body %v", upstreamBody)
+	}
+	if got := g.quota.today("data").tokens; got != 5 {
+		t.Fatalf("expected 5 tokens recorded, got %d", got)
+	}
+
+	post(r, "team-token", `{"model":"gpt-4o"}`)
+	if rec := post(r, "team-token", `{"model":"gpt-4o"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected daily request quota to be enforced, got %d", rec.Code)
+	}
+}
+
+func TestChatCompletionsStreamPassthrough(t *testing.T) {
+	events := "data: {\"choices\":[{\"delta\":{\"content\":\"he\"}}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":6,\"total_tokens\":10}}\n\n" +
+		"data: [DONE]\n\n"
+	var includeUsage bool
+	r, g := newTestGateway(t, func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			StreamOptions struct {
+				IncludeUsage bool `json:"include_usage"`
+			} `json:"stream_options"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		includeUsage = body.StreamOptions.IncludeUsage
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(events))
+	})
+
+	rec := post(r, "team-token", `{"model":"openai/gpt-4o","stream":true}`)
+	if rec.Code != http.StatusOK || rec.Body.String() != events {
+		t.Fatalf("expected events to pass through unchanged, got %d %q", rec.Code, rec.Body.String())
+	}
+	if !includeUsage {
+		t.Fatal("expected stream_options.include_usage to be requested")
+	}
+	if got := g.quota.today("data").tokens; got != 10 {
+		t.Fatalf("expected 10 tokens recorded, got %d", got)
+	}
+}
+
+func TestModelsListsAliases(t *testing.T) {
+	r, _ := newTestGateway(t, func(w http.ResponseWriter, req *http.Request) {})
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer team-token")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	ids := make(map[string]bool)
+	for _, m := range resp.Data {
+		ids[m.ID] = true
+	}
+	if !ids["gpt-4o"] || !ids["openai/gpt-4o"] {
+		t.Fatalf("expected catalog and alias models, got %v", ids)
+	}
+}
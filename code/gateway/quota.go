@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/logger"
+)
+
+// Usage 一次请求的用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type teamUsage struct {
+	day      string
+	requests int
+	tokens   int
+}
+
+// quota 按团队统计当天的请求数和 token 数
+type quota struct {
+	mu    sync.Mutex
+	usage map[string]*teamUsage
+	now   func() time.Time
+}
+
+func newQuota() *quota {
+	return &quota{usage: make(map[string]*teamUsage), now: time.Now}
+}
+
+func (q *quota) today(team string) *teamUsage {
+	day := q.now().Format("2006-01-02")
+	u, ok := q.usage[team]
+	if !ok || u.day != day {
+		u = &teamUsage{day: day}
+		q.usage[team] = u
+	}
+	return u
+}
+
+// acquire 检查配额并占用一次请求，超出时返回 false
+func (q *quota) acquire(team initialization.GatewayTeam) (bool, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.today(team.Name)
+	if team.DailyRequests > 0 && u.requests >= team.DailyRequests {
+		return false, "今日请求次数已用完"
+	}
+	if team.DailyTokens > 0 && u.tokens >= team.DailyTokens {
+		return false, "今日 token 额度已用完"
+	}
+	u.requests++
+	return true, ""
+}
+
+func (q *quota) addTokens(team string, tokens int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.today(team).tokens += tokens
+}
+
+// usageRecord 用量日志中的一行
+type usageRecord struct {
+	Time     time.Time `json:"time"`
+	Team     string    `json:"team"`
+	Model    string    `json:"model"`
+	Stream   bool      `json:"stream"`
+	Status   int       `json:"status"`
+	Duration int64     `json:"duration_ms"`
+	Usage
+}
+
+type usageLogger struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (l *usageLogger) log(record usageRecord) {
+	logger.Infof("网关请求 team=%s model=%s stream=%v status=%d tokens=%d(%d+%d) %dms",
+		record.Team, record.Model, record.Stream, record.Status, record.TotalTokens,
+		record.PromptTokens, record.CompletionTokens, record.Duration)
+	if l.path == "" {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Errorf("写入网关用量日志失败: %v", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
@@ -31,8 +31,51 @@ func CommonProcessAIMode(msg CardMsg, cardAction *larkcard.CardAction,
 	cache services.SessionServiceCacheInterface) (interface{},
 	error, bool) {
 	option := cardAction.Action.Option
-	replyMsg(context.Background(), "已选择发散模式:"+option,
-		&msg.MsgId)
+	cardId := cardAction.OpenMessageID
+	replyMsg(context.Background(), "已选择发散模式:"+option, &cardId)
 	cache.SetAIMode(msg.SessionId, openai.AIModeMap[option])
 	return nil, nil, true
 }
+
+// NewReasoningEffortCardHandler 推理强度选择
+func NewReasoningEffortCardHandler(cardMsg CardMsg,
+	m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != ReasoningEffortKind {
+			return nil, ErrNextHandler
+		}
+		option := cardAction.Action.Option
+		label, ok := reasoningEffortLabels[option]
+		if !ok {
+			return nil, nil
+		}
+		effort := option
+		if effort == "default" {
+			effort = ""
+		}
+		m.sessionCache.SetReasoningEffort(cardMsg.SessionId, effort)
+		cardId := cardAction.OpenMessageID
+		replyMsg(context.Background(), "已选择推理强度:"+label, &cardId)
+		return nil, nil
+	}
+}
+
+// NewParamsCardHandler 生成参数卡片上的选择，返回更新后的卡片
+func NewParamsCardHandler(cardMsg CardMsg,
+	m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != ParamsKind {
+			return nil, ErrNextHandler
+		}
+		name, _ := cardMsg.Value.(string)
+		params := m.sessionCache.GetParams(cardMsg.SessionId)
+		if name == "reset" {
+			params = openai.GenParams{}
+		} else if err := params.Set(name, cardAction.Action.Option); err != nil {
+			return nil, err
+		}
+		m.sessionCache.SetParams(cardMsg.SessionId, params)
+		return newParamsCard(cardMsg.SessionId, params,
+			m.sessionCache.GetCurrentModel(cardMsg.SessionId)), nil
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"start-feishubot/logger"
+	"start-feishubot/services/openai"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// continuePrompt 续写被截断回答时追加的提示，不写入会话历史
+const continuePrompt = "请从上一条回答中断的地方继续，不要重复已经输出的内容。"
+
+// NewAnswerActionCardHandler 处理回答卡片上的重新生成和继续生成按钮
+func NewAnswerActionCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != RegenerateKind && cardMsg.Kind != ContinueKind {
+			return nil, ErrNextHandler
+		}
+		sessionId := cardMsg.SessionId
+		cardId := cardAction.OpenMessageID
+		// 点击按钮的人作为提问人，带上其自定义指令、长期记忆和可用的工具
+		asker := promptTarget{chatId: cardMsg.ChatId, userId: cardAction.OpenID}
+
+		title := "🔁 正在重新生成"
+		if cardMsg.Kind == ContinueKind {
+			title = "▶️ 正在继续生成"
+		}
+		processingCard, _ := newSendCard(
+			withHeader(title, larkcard.TemplateBlue),
+			withNote("正在思考，请稍等..."))
+
+		// 卡片回调需在3秒内返回，模型请求放到后台，完成后原地更新卡片
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("处理回答卡片操作时发生panic: %v", r)
+				}
+			}()
+			unlock := m.sessionCache.LockSession(sessionId)
+			defer unlock()
+
+			var answer openai.Messages
+			var err error
+			if cardMsg.Kind == RegenerateKind {
+				answer, err = m.regenerateLastAnswer(sessionId, asker)
+			} else {
+				answer, err = m.continueLastAnswer(sessionId, asker)
+			}
+			if err != nil {
+				logger.Errorf("处理回答卡片操作失败: %v", err)
+				errorCard, _ := newSendCard(
+					withHeader("❌ 操作失败", larkcard.TemplateRed),
+					withMainText(err.Error()),
+					withNote("请稍后重试，或直接继续提问"))
+				PatchCard(context.Background(), &cardId, errorCard)
+				return
+			}
+			newCard, _ := newAnswerCard(
+				withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
+				answer, &sessionId, cardMsg.ChatId,
+				"已完成，点击按钮可切换模型回答，或继续提问保持话题连贯。")
+			if err := PatchCard(context.Background(), &cardId, newCard); err != nil {
+				logger.Errorf("更新回答卡片失败: %v", err)
+			}
+		}()
+
+		return processingCard, nil
+	}
+}
+
+// lastQuestion 会话历史中最后一个用户问题
+func lastQuestion(msg []openai.Messages) string {
+	for i := len(msg) - 1; i >= 0; i-- {
+		if msg[i].Role == "user" {
+			return msg[i].Content
+		}
+	}
+	return ""
+}
+
+// lastAnswerIndex 返回会话历史中最后一轮回答的位置，最后一条不是回答时返回-1
+func lastAnswerIndex(msg []openai.Messages) int {
+	if len(msg) == 0 || msg[len(msg)-1].Role != "assistant" {
+		return -1
+	}
+	return len(msg) - 1
+}
+
+// askerInfo 卡片操作重新请求时，以点击按钮的人作为提问人
+func askerInfo(asker promptTarget, sessionId string, question string) *MsgInfo {
+	return &MsgInfo{
+		chatId:    &asker.chatId,
+		userId:    &asker.userId,
+		sessionId: &sessionId,
+		qParsed:   question,
+	}
+}
+
+// regenerateLastAnswer 丢弃最后一轮回答，用同样的上下文重新请求并替换到历史中
+func (m MessageHandler) regenerateLastAnswer(sessionId string, asker promptTarget) (openai.Messages, error) {
+	msg := m.sessionCache.GetMsg(sessionId)
+	idx := lastAnswerIndex(msg)
+	if idx < 0 {
+		return openai.Messages{}, fmt.Errorf("没有可以重新生成的回答，话题可能已被清除")
+	}
+	cardId := msg[idx].FeishuMsgId
+	msg = msg[:idx]
+	aiMode := m.sessionCache.GetAIMode(sessionId)
+	currentModel, autoRoute := resolveModel(context.Background(), m.gpt,
+		m.sessionCache.GetCurrentModel(sessionId), openai.RouteInput{Question: lastQuestion(msg)})
+	info := askerInfo(asker, sessionId, lastQuestion(msg))
+	answer, err := m.gpt.CompletionsWithOptions(context.Background(), requestMessages(msg, info),
+		aiMode, currentModel, openai.ChatOptions{
+			Tools:           messageTools(info),
+			ReasoningEffort: m.sessionCache.GetReasoningEffort(sessionId),
+			Params:          m.sessionCache.GetParams(sessionId),
+			ResponseSchema:  m.sessionCache.GetResponseSchema(sessionId),
+		})
+	if err != nil {
+		return openai.Messages{}, err
+	}
+	answer.AutoRoute = autoRoute
+	applyResponseSchema(&answer, m.sessionCache.GetResponseSchema(sessionId))
+	// 新回答显示在原来的卡片上，旧回答保留在另一条分支中
+	answer.FeishuMsgId = cardId
+	m.sessionCache.SetMsg(sessionId, append(msg, answer))
+	return answer, nil
+}
+
+// continueLastAnswer 让模型接着被截断的回答继续写，并把续写内容合并进最后一轮回答
+func (m MessageHandler) continueLastAnswer(sessionId string, asker promptTarget) (openai.Messages, error) {
+	msg := m.sessionCache.GetMsg(sessionId)
+	idx := lastAnswerIndex(msg)
+	if idx < 0 {
+		return openai.Messages{}, fmt.Errorf("没有可以继续生成的回答，话题可能已被清除")
+	}
+	last := msg[idx]
+	if !last.Truncated {
+		return last, nil
+	}
+	req := append(msg, openai.Messages{Role: "user", Content: continuePrompt})
+	aiMode := m.sessionCache.GetAIMode(sessionId)
+	// 续写沿用上一段回答的模型，自动选择时不再重新路由
+	currentModel := m.sessionCache.GetCurrentModel(sessionId)
+	if currentModel == openai.AutoModel && last.Model != "" {
+		currentModel = last.Model
+	} else if currentModel == openai.AutoModel {
+		currentModel = openai.DefaultModel
+	}
+	info := askerInfo(asker, sessionId, lastQuestion(msg))
+	more, err := m.gpt.CompletionsWithOptions(context.Background(), requestMessages(req, info),
+		aiMode, currentModel, openai.ChatOptions{
+			Tools:           messageTools(info),
+			ReasoningEffort: m.sessionCache.GetReasoningEffort(sessionId),
+			Params:          m.sessionCache.GetParams(sessionId),
+			ResponseSchema:  m.sessionCache.GetResponseSchema(sessionId),
+		})
+	if err != nil {
+		return openai.Messages{}, err
+	}
+	last.Content += more.Content
+	last.Truncated = more.Truncated
+	last.Model, last.FallbackFrom = more.Model, more.FallbackFrom
+	applyResponseSchema(&last, m.sessionCache.GetResponseSchema(sessionId))
+	msg[idx] = last
+	m.sessionCache.SetMsg(sessionId, msg)
+	return last, nil
+}
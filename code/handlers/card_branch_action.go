@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"start-feishubot/logger"
+	"start-feishubot/utils"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// NewEditResendCardHandler 回答卡片上的编辑问题按钮：回到该问题之前，下一条消息开辟新分支
+func NewEditResendCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != EditResendKind {
+			return nil, ErrNextHandler
+		}
+		sessionId := cardMsg.SessionId
+		cardId := cardAction.OpenMessageID
+
+		// 可能有回答正在生成，等它写回历史后再回退
+		go func() {
+			unlock := m.sessionCache.LockSession(sessionId)
+			question, ok := m.sessionCache.FindQuestion(sessionId, cardId)
+			if ok {
+				ok = m.sessionCache.ForkAt(sessionId, question.ID)
+			}
+			unlock()
+			if !ok {
+				replyMsg(context.Background(), "🤖️：找不到这条回答对应的问题，话题可能已被清除～", &cardId)
+				return
+			}
+			sendEditQuestionCard(context.Background(), &cardId, question.Msg.Content)
+		}()
+		return nil, nil
+	}
+}
+
+// NewBranchSwitchCardHandler 分支列表卡片上的分支切换
+func NewBranchSwitchCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != BranchSwitchKind {
+			return nil, ErrNextHandler
+		}
+		sessionId := cardMsg.SessionId
+		leafId := cardAction.Action.Option
+		cardId := cardAction.OpenMessageID
+
+		processingCard, _ := newSendCard(
+			withHeader("🌿 正在切换分支", larkcard.TemplateBlue),
+			withNote("话题中可能有回答正在生成，完成后切换"))
+
+		// 回答生成中会话锁被占用，卡片回调需在3秒内返回，切换放到后台，完成后原地更新卡片
+		go func() {
+			unlock := m.sessionCache.LockSession(sessionId)
+			ok := m.sessionCache.SwitchBranch(sessionId, leafId)
+			branches := m.sessionCache.GetBranches(sessionId)
+			unlock()
+			if !ok {
+				logger.Errorf("切换分支失败: session %s, leaf %s", sessionId, leafId)
+				errorCard, _ := newSendCard(
+					withHeader("❌ 切换分支失败", larkcard.TemplateRed),
+					withMainText("分支不存在，话题可能已被清除"))
+				PatchCard(context.Background(), &cardId, errorCard)
+				return
+			}
+			question := ""
+			for i, branch := range branches {
+				if branch.Current {
+					question = fmt.Sprintf("**分支%d**：%s", i+1, utils.Ellipsis(branch.LastQuestion, 40))
+				}
+			}
+			newCard, _ := newSendCard(
+				withHeader("🌿 已切换分支", larkcard.TemplateTurquoise),
+				withMainMd(question),
+				withNote("继续在话题中提问，将沿着这个分支对话。"))
+			if err := PatchCard(context.Background(), &cardId, newCard); err != nil {
+				logger.Errorf("更新分支卡片失败: %v", err)
+			}
+		}()
+
+		return processingCard, nil
+	}
+}
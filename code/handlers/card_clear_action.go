@@ -24,7 +24,12 @@ func CommonProcessClearCache(cardMsg CardMsg, session services.SessionServiceCac
 	interface{}, error, bool) {
 	logger.Debugf("card msg value %v", cardMsg.Value)
 	if cardMsg.Value == "1" {
-		session.Clear(cardMsg.SessionId)
+		// 等进行中的回答写回后再清除，否则上下文会被重新写入
+		go func() {
+			unlock := session.LockSession(cardMsg.SessionId)
+			defer unlock()
+			session.Clear(cardMsg.SessionId)
+		}()
 		newCard, _ := newSendCard(
 			withHeader("️🆑 机器人提醒", larkcard.TemplateGrey),
 			withMainMd("已删除此话题的上下文信息"),
@@ -24,10 +24,21 @@ func NewCardHandler(m MessageHandler) CardHandlerFunc {
 		NewRoleTagCardHandler,
 		NewRoleCardHandler,
 		NewAIModeCardHandler,
+		NewReasoningEffortCardHandler,
+		NewParamsCardHandler,
+		NewRoleExampleCardHandler,
 		NewVisionModeChangeHandler,
 		NewModelSwitchCardHandler,
 		NewAllModelsCardHandler,
 		NewMoreModelsCardHandler,
+		NewStopStreamCardHandler,
+		NewAnswerActionCardHandler,
+		NewEditResendCardHandler,
+		NewBranchSwitchCardHandler,
+		NewExportCardHandler,
+		NewToolToggleCardHandler,
+		NewMemoryCardHandler,
+		NewInstructionsCardHandler,
 	}
 
 	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+
+	"start-feishubot/logger"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// NewExportCardHandler 导出卡片上的格式选择
+func NewExportCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != ExportKind {
+			return nil, ErrNextHandler
+		}
+		format, _ := cardMsg.Value.(string)
+		sessionId := cardMsg.SessionId
+		cardId := cardAction.OpenMessageID
+		openId := cardAction.OpenID
+
+		// 导入文档需要轮询任务状态，放到后台完成后再更新卡片
+		go func() {
+			err := m.exportSession(context.Background(), sessionId, &cardId, openId, format)
+			if err != nil {
+				logger.Errorf("导出话题失败: %v", err)
+				errorCard, _ := newSendCard(
+					withHeader("❌ 导出失败", larkcard.TemplateRed),
+					withMainText(err.Error()),
+					withNote("请稍后重试"))
+				PatchCard(context.Background(), &cardId, errorCard)
+				return
+			}
+			doneCard, _ := newSendCard(
+				withHeader("📤 导出完成", larkcard.TemplateGreen),
+				withNote("导出结果已发送到话题中。"))
+			PatchCard(context.Background(), &cardId, doneCard)
+		}()
+
+		processingCard, _ := newSendCard(
+			withHeader("📤 正在导出", larkcard.TemplateBlue),
+			withNote("正在整理话题内容，请稍等..."))
+		return processingCard, nil
+	}
+}
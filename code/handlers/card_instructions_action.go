@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"start-feishubot/logger"
+	"start-feishubot/services"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// NewInstructionsCardHandler 自定义指令卡片的保存和清除，只有卡片的主人可以操作
+func NewInstructionsCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != InstructionsKind {
+			return nil, ErrNextHandler
+		}
+		userId := cardMsg.UserId
+		if userId == "" || userId != cardAction.OpenID {
+			return nil, nil
+		}
+		instructions := ""
+		if op, _ := cardMsg.Value.(string); op == "save" {
+			instructions = cardFormValue(cardAction, instructionsInputName)
+		}
+		note := "✅ 已保存，之后的每次提问都会带上这些指令。"
+		if err := saveUserInstructions(userId, instructions); err != nil {
+			logger.Errorf("保存自定义指令失败: %v", err)
+			note = "❌ 保存失败：" + err.Error()
+		} else if instructions == "" {
+			note = "✅ 已清除自定义指令。"
+		}
+		return newInstructionsCard(userId,
+			services.GetUserProfiles().Get(userId).Instructions, note), nil
+	}
+}
+
+// cardFormValue 读取表单提交的字段，larkcard.CardAction 没有解析 form_value，从原始请求中取
+func cardFormValue(cardAction *larkcard.CardAction, name string) string {
+	if cardAction.EventReq == nil {
+		return ""
+	}
+	var body struct {
+		Action struct {
+			FormValue map[string]interface{} `json:"form_value"`
+		} `json:"action"`
+	}
+	if err := json.Unmarshal(cardAction.Body, &body); err != nil {
+		logger.Errorf("解析卡片表单失败: %v", err)
+		return ""
+	}
+	value, _ := body.Action.FormValue[name].(string)
+	return value
+}
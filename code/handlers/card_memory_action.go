@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"start-feishubot/logger"
+	"start-feishubot/services"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// NewMemoryCardHandler 记忆卡片上的删除、开关和清空按钮，只有记忆的主人可以操作
+func NewMemoryCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != MemoryKind {
+			return nil, ErrNextHandler
+		}
+		userId := cardMsg.UserId
+		if userId == "" || userId != cardAction.OpenID {
+			return nil, nil
+		}
+		op, _ := cardMsg.Value.(string)
+		memory := services.GetMemory()
+		var err error
+		switch {
+		case op == "on" || op == "off":
+			err = memory.SetEnabled(userId, op == "on")
+		case op == "clear":
+			err = memory.Clear(userId)
+		case strings.HasPrefix(op, "delete:"):
+			_, err = memory.Forget(userId, strings.TrimPrefix(op, "delete:"))
+		}
+		if err != nil {
+			logger.Errorf("更新长期记忆失败: %v", err)
+		}
+		return newMemoryCard(userId, memory.Get(userId)), nil
+	}
+}
@@ -86,7 +86,7 @@ func NewModelSwitchCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFun
 				withMainMd(fmt.Sprintf("**问题:** %s", userQuestion)),
 				withMainMd(completions.Content),
 				withModelSwitchButtons(&sessionId),
-				withNote("点击按钮可切换其他模型回答"))
+				withNote(modelNote(completions)+"\n点击按钮可切换其他模型回答"))
 			replyCard(ctx, &cardAction.OpenMessageID, finalCard)
 		}()
 		
@@ -147,7 +147,9 @@ func NewAllModelsCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc
 					{Role: "user", Content: userQuestion},
 				}
 				
-				completions, err := m.gpt.CompletionsWithModel(newMsg, openai.Balance, model.ID)
+				// 对比回答不降级，失败就如实显示
+				completions, err := m.gpt.CompletionsWithOptions(context.Background(), newMsg,
+					openai.Balance, model.ID, openai.ChatOptions{NoFallback: true})
 				var response string
 				var cardColor string
 				if err != nil {
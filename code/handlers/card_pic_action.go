@@ -57,8 +57,8 @@ func CommonProcessPicResolution(msg CardMsg,
 	fmt.Println(larkcore.Prettify(msg))
 	cache.SetPicResolution(msg.SessionId, services.Resolution(option))
 	//send text
-	replyMsg(context.Background(), "已更新图片分辨率为"+option,
-		&msg.MsgId)
+	cardId := cardAction.OpenMessageID
+	replyMsg(context.Background(), "已更新图片分辨率为"+option, &cardId)
 }
 
 func CommonProcessPicStyle(msg CardMsg,
@@ -68,8 +68,8 @@ func CommonProcessPicStyle(msg CardMsg,
 	fmt.Println(larkcore.Prettify(msg))
 	cache.SetPicStyle(msg.SessionId, services.PicStyle(option))
 	//send text
-	replyMsg(context.Background(), "已更新图片风格为"+option,
-		&msg.MsgId)
+	cardId := cardAction.OpenMessageID
+	replyMsg(context.Background(), "已更新图片风格为"+option, &cardId)
 }
 
 func (m MessageHandler) CommonProcessPicMore(msg CardMsg) {
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"start-feishubot/initialization"
+	"start-feishubot/logger"
 	"start-feishubot/services"
 	"start-feishubot/services/openai"
+	"start-feishubot/utils"
 
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 )
@@ -48,10 +52,11 @@ func CommonProcessRoleTag(msg CardMsg, cardAction *larkcard.CardAction,
 	option := cardAction.Action.Option
 	//replyMsg(context.Background(), "已选择tag:"+option,
 	//	&msg.MsgId)
-	roles := initialization.GetTitleListByTag(option)
+	roles := initialization.GetTitleListByTag(option, roleScope(msg, cardAction))
 	//fmt.Printf("roles: %s", roles)
+	cardId := cardAction.OpenMessageID
 	SendRoleListCard(context.Background(), &msg.SessionId,
-		&msg.MsgId, option, *roles)
+		&cardId, msg.ChatId, option, *roles)
 	return nil, nil, true
 }
 
@@ -59,19 +64,123 @@ func CommonProcessRole(msg CardMsg, cardAction *larkcard.CardAction,
 	cache services.SessionServiceCacheInterface) (interface{},
 	error, bool) {
 	option := cardAction.Action.Option
-	contentByTitle, error := initialization.GetFirstRoleContentByTitle(option)
-	if error != nil {
-		return nil, error, true
+	role := initialization.GetRoleByTitle(option, roleScope(msg, cardAction))
+	if role == nil {
+		return nil, errors.New("role not found"), true
 	}
-	cache.Clear(msg.SessionId)
-	systemMsg := append([]openai.Messages{}, openai.Messages{
-		Role: "system", Content: contentByTitle,
-	})
-	cache.SetMsg(msg.SessionId, systemMsg)
-	//pp.Println("systemMsg: ", systemMsg)
-	sendSystemInstructionCard(context.Background(), &msg.SessionId,
-		&msg.MsgId, contentByTitle)
+	// 角色声明了 JSON Schema 时，之后的回答按结构化结果输出
+	var schema *openai.ResponseSchema
+	if role.SchemaJSON != nil {
+		schema = &openai.ResponseSchema{
+			Name: "role_output", Schema: role.SchemaJSON, Output: role.Output,
+		}
+	}
+	cardId := cardAction.OpenMessageID
+	// 卡片回调需要尽快返回，等待会话锁放到后台进行
+	go func() {
+		unlock := cache.LockSession(msg.SessionId)
+		defer unlock()
+		cache.Clear(msg.SessionId)
+		systemMsg := append([]openai.Messages{}, openai.Messages{
+			Role: "system", Content: role.Content,
+		})
+		cache.SetMsg(msg.SessionId, systemMsg)
+		cache.SetResponseSchema(msg.SessionId, schema)
+		settings := applyRoleSettings(cache, msg.SessionId, *role)
+		//pp.Println("systemMsg: ", systemMsg)
+		sendRoleInstructionCard(context.Background(), &msg.SessionId,
+			&cardId, *role, settings)
+	}()
 	//replyMsg(context.Background(), "已选择角色:"+contentByTitle,
 	//	&msg.MsgId)
 	return nil, nil, true
 }
+
+// roleScope 点击角色菜单的用户和菜单所在的群，用于查到他们的自定义角色
+func roleScope(msg CardMsg, cardAction *larkcard.CardAction) initialization.RoleScope {
+	return initialization.RoleScope{UserId: cardAction.OpenID, ChatId: msg.ChatId}
+}
+
+// applyRoleSettings 切换角色绑定的模型、发散模式和最大输出长度，返回生效的设置说明
+func applyRoleSettings(cache services.SessionServiceCacheInterface, sessionId string,
+	role initialization.Role) []string {
+	var settings []string
+	if role.Model != "" {
+		cache.SetCurrentModel(sessionId, role.Model)
+		settings = append(settings, "模型："+modelDisplayName(role.Model))
+	}
+	if role.AIMode != "" {
+		if mode, ok := openai.AIModeMap[role.AIMode]; ok {
+			cache.SetAIMode(sessionId, mode)
+			settings = append(settings, "模式："+role.AIMode)
+		} else {
+			logger.Warnf("角色 %s 的 ai_mode %s 无效，可选 %v", role.Title, role.AIMode, openai.AIModeStrs)
+		}
+	}
+	if role.MaxTokens > 0 {
+		// 只替换最大输出长度，保留通过 /params 设置的其它参数
+		params := cache.GetParams(sessionId)
+		params.MaxTokens = role.MaxTokens
+		cache.SetParams(sessionId, params)
+		settings = append(settings, fmt.Sprintf("max_tokens：%d", role.MaxTokens))
+	}
+	return settings
+}
+
+// NewRoleExampleCardHandler 角色卡片上的示例按钮：把示例作为问题发送并回复回答卡片
+func NewRoleExampleCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != RoleExampleKind {
+			return nil, ErrNextHandler
+		}
+		example, _ := cardMsg.Value.(string)
+		if example == "" {
+			return nil, nil
+		}
+		sessionId := cardMsg.SessionId
+		cardId := cardAction.OpenMessageID
+		// 点击按钮的人作为提问人，带上其自定义指令、长期记忆和可用的工具
+		asker := promptTarget{chatId: cardMsg.ChatId, userId: cardAction.OpenID}
+		// 卡片回调需在3秒内返回，模型请求放到后台
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("处理角色示例问题时发生panic: %v", r)
+				}
+			}()
+			unlock := m.sessionCache.LockSession(sessionId)
+			defer unlock()
+			msg := m.sessionCache.GetMsg(sessionId)
+			msg = m.setDefaultPrompt(context.Background(), msg, asker)
+			msg = append(msg, openai.Messages{Role: "user", Content: example})
+			schema := m.sessionCache.GetResponseSchema(sessionId)
+			currentModel, autoRoute := resolveModel(context.Background(), m.gpt,
+				m.sessionCache.GetCurrentModel(sessionId), openai.RouteInput{Question: example})
+			info := askerInfo(asker, sessionId, example)
+			answer, err := m.gpt.CompletionsWithOptions(context.Background(), requestMessages(msg, info),
+				m.sessionCache.GetAIMode(sessionId), currentModel, openai.ChatOptions{
+					Tools:           messageTools(info),
+					ReasoningEffort: m.sessionCache.GetReasoningEffort(sessionId),
+					Params:          m.sessionCache.GetParams(sessionId),
+					ResponseSchema:  schema,
+				})
+			if err != nil {
+				replyMsg(context.Background(), fmt.Sprintf(
+					"🤖️：消息机器人摆烂了，请稍后再试～\n错误信息: %v", err), &cardId)
+				return
+			}
+			answer.AutoRoute = autoRoute
+			applyResponseSchema(&answer, schema)
+			newCard, _ := newAnswerCard(
+				withHeader("💡 "+utils.Ellipsis(example, 30), larkcard.TemplateBlue),
+				answer, &sessionId, cardMsg.ChatId, "示例问题的回答，继续提问保持话题连贯。")
+			answerId, err := replyCardWithBackId(context.Background(), &cardId, newCard)
+			if err == nil && answerId != nil {
+				answer.FeishuMsgId = *answerId
+			}
+			m.sessionCache.SetMsg(sessionId, append(msg, answer))
+			replyStructuredFile(context.Background(), &cardId, answer, schema)
+		}()
+		return nil, nil
+	}
+}
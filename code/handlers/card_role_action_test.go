@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services"
+	"start-feishubot/services/openai"
+)
+
+// 角色只覆盖最大输出长度，/params 设置的其它参数保持不变
+func TestApplyRoleSettingsKeepsParams(t *testing.T) {
+	cache := services.GetSessionCache()
+	sessionId := "test-apply-role-settings"
+	defer cache.Clear(sessionId)
+	temperature := 0.3
+	cache.SetParams(sessionId, openai.GenParams{
+		Temperature: &temperature, MaxTokens: 100, Stop: []string{"### END"},
+	})
+
+	applyRoleSettings(cache, sessionId, initialization.Role{Title: "test", MaxTokens: 800})
+	want := openai.GenParams{Temperature: &temperature, MaxTokens: 800, Stop: []string{"### END"}}
+	if got := cache.GetParams(sessionId); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected params %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"start-feishubot/logger"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// 正在流式生成的回答卡片消息ID -> 停止信号。按卡片区分，
+// 点击旧卡片上残留的停止按钮不会停掉同一会话中正在进行的新回答
+var streamStops sync.Map
+
+func registerStreamStop(cardId string) chan struct{} {
+	stopCh := make(chan struct{})
+	streamStops.Store(cardId, stopCh)
+	return stopCh
+}
+
+func unregisterStreamStop(cardId string, stopCh chan struct{}) {
+	if current, ok := streamStops.Load(cardId); ok && current == stopCh {
+		streamStops.Delete(cardId)
+	}
+}
+
+// stopStream 通知卡片上正在进行的流式回答停止，没有进行中的回答时返回false
+func stopStream(cardId string) bool {
+	stopCh, ok := streamStops.LoadAndDelete(cardId)
+	if !ok {
+		return false
+	}
+	close(stopCh.(chan struct{}))
+	return true
+}
+
+// NewStopStreamCardHandler 处理流式卡片上的停止生成按钮
+func NewStopStreamCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != StopStreamKind {
+			return nil, ErrNextHandler
+		}
+		// 卡片内容由流式协程在上游请求结束后更新
+		if !stopStream(cardAction.OpenMessageID) {
+			logger.Debugf("no running stream for card %s", cardAction.OpenMessageID)
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import "testing"
+
+// 停止信号按卡片区分，旧卡片上的停止按钮不影响新回答
+func TestStopStreamByCard(t *testing.T) {
+	current := registerStreamStop("om_card_new")
+	defer unregisterStreamStop("om_card_new", current)
+
+	if stopStream("om_card_old") {
+		t.Fatal("stopping an old card should not find a running stream")
+	}
+	select {
+	case <-current:
+		t.Fatal("current stream was stopped by an old card")
+	default:
+	}
+	if !stopStream("om_card_new") {
+		t.Fatal("expected the current card's stream to stop")
+	}
+	<-current
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+
+	"start-feishubot/logger"
+	"start-feishubot/services"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+)
+
+// NewToolToggleCardHandler 工具设置卡片上的开关
+func NewToolToggleCardHandler(cardMsg CardMsg, m MessageHandler) CardHandlerFunc {
+	return func(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error) {
+		if cardMsg.Kind != ToolToggleKind {
+			return nil, ErrNextHandler
+		}
+		source, _ := cardMsg.Value.(string)
+		chatId := cardMsg.ChatId
+		err := services.GetChatSettings().Update(chatId, func(settings *services.ChatSettings) {
+			if settings.ToolEnabled(source) {
+				settings.DisabledTools = append(settings.DisabledTools, source)
+				return
+			}
+			var disabled []string
+			for _, s := range settings.DisabledTools {
+				if s != source {
+					disabled = append(disabled, s)
+				}
+			}
+			settings.DisabledTools = disabled
+		})
+		if err != nil {
+			logger.Errorf("保存工具设置失败: %v", err)
+		}
+		return newToolsCard(chatId, chatToolSources(chatId)), nil
+	}
+}
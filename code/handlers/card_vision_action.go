@@ -39,8 +39,8 @@ func CommonProcessVisionStyle(msg CardMsg,
 	fmt.Println(larkcore.Prettify(msg))
 	cache.SetVisionDetail(msg.SessionId, services.VisionDetail(option))
 	//send text
-	replyMsg(context.Background(), "图片解析度调整为："+option,
-		&msg.MsgId)
+	cardId := cardAction.OpenMessageID
+	replyMsg(context.Background(), "图片解析度调整为："+option, &cardId)
 }
 
 func CommonProcessVisionModeChange(cardMsg CardMsg,
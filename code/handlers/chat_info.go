@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"start-feishubot/logger"
+	"start-feishubot/platform"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// chatInfoCache 群信息和用户名变化不频繁，缓存一段时间，避免每次提问都调用平台接口
+var chatInfoCache = cache.New(10*time.Minute, 30*time.Minute)
+
+// chatInfo 查询群名称和群主，查询失败时返回空信息并短暂缓存，避免反复请求
+func chatInfo(ctx context.Context, chatId string) platform.ChatInfo {
+	p := platform.FromContext(ctx)
+	key := p.Name() + ":chat:" + chatId
+	if info, ok := chatInfoCache.Get(key); ok {
+		return info.(platform.ChatInfo)
+	}
+	info, err := p.ChatInfo(ctx, chatId)
+	if err != nil {
+		logger.Warnf("查询群 %s 的信息失败: %v", chatId, err)
+		chatInfoCache.Set(key, info, time.Minute)
+		return info
+	}
+	chatInfoCache.SetDefault(key, info)
+	return info
+}
+
+// userName 查询用户的显示名称，查询失败时返回空
+func userName(ctx context.Context, userId string) string {
+	if userId == "" {
+		return ""
+	}
+	p := platform.FromContext(ctx)
+	key := p.Name() + ":user:" + userId
+	if name, ok := chatInfoCache.Get(key); ok {
+		return name.(string)
+	}
+	name, err := p.UserName(ctx, userId)
+	if err != nil {
+		logger.Warnf("查询用户 %s 的名称失败: %v", userId, err)
+		chatInfoCache.Set(key, name, time.Minute)
+		return name
+	}
+	chatInfoCache.SetDefault(key, name)
+	return name
+}
@@ -6,17 +6,69 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
-// func sendCard
-func msgFilter(msg string) string {
-	//replace @到下一个非空的字段 为 ''
-	regex := regexp.MustCompile(`@[^ ]*`)
-	return regex.ReplaceAllString(msg, "")
+// botIdentity 机器人的身份，用于判断是否被@：获取到 open_id 时按 open_id 匹配，否则按 BOT_NAME 匹配
+type botIdentity struct {
+	openId string
+	name   string
+}
+
+func (b botIdentity) isMentioned(mention *larkim.MentionEvent) bool {
+	if mention == nil {
+		return false
+	}
+	if b.openId != "" {
+		return mention.Id != nil && mention.Id.OpenId != nil && *mention.Id.OpenId == b.openId
+	}
+	return mention.Name != nil && b.name != "" && *mention.Name == b.name
+}
+
+// mentionedIn 消息中任意一个@是机器人即可，同时@了其他人也会处理
+func (b botIdentity) mentionedIn(mentions []*larkim.MentionEvent) bool {
+	for _, mention := range mentions {
+		if b.isMentioned(mention) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionNames 消息中@占位符（如 @_user_1）对应的文字：@机器人的去掉，@其他人的换成 @名字
+func mentionNames(mentions []*larkim.MentionEvent, bot botIdentity) map[string]string {
+	names := make(map[string]string)
+	for _, mention := range mentions {
+		if mention == nil || mention.Key == nil {
+			continue
+		}
+		if bot.isMentioned(mention) {
+			names[*mention.Key] = ""
+		} else if mention.Name != nil {
+			names[*mention.Key] = "@" + *mention.Name
+		}
+	}
+	return names
+}
+
+var mentionKeyRegex = regexp.MustCompile(`@_user_\d+|@_all`)
+
+// msgFilter 按 mentionNames 替换@占位符，@所有人保留为文字，没有对应信息的占位符去掉
+func msgFilter(msg string, names map[string]string) string {
+	return mentionKeyRegex.ReplaceAllStringFunc(msg, func(key string) string {
+		if name, ok := names[key]; ok {
+			return name
+		}
+		if key == "@_all" {
+			return "@所有人"
+		}
+		return ""
+	})
 }
 
 // Parse rich text json to text
-func parsePostContent(content string) string {
+func parsePostContent(content string, names map[string]string) string {
 	var contentMap map[string]interface{}
 	err := json.Unmarshal([]byte(content), &contentMap)
 
@@ -39,11 +91,25 @@ func parsePostContent(content string) string {
 			if v1.(map[string]interface{})["tag"] == "text" {
 				text += v1.(map[string]interface{})["text"].(string)
 			}
+			// @保留占位符，由 msgFilter 统一替换
+			if v1.(map[string]interface{})["tag"] == "at" {
+				key, _ := v1.(map[string]interface{})["user_id"].(string)
+				text += key
+			}
+			// 超链接保留地址，便于后续抓取链接内容
+			if v1.(map[string]interface{})["tag"] == "a" {
+				linkText, _ := v1.(map[string]interface{})["text"].(string)
+				href, _ := v1.(map[string]interface{})["href"].(string)
+				text += linkText
+				if href != "" && href != linkText {
+					text += " " + href
+				}
+			}
 		}
 		// add new line
 		text += "\n"
 	}
-	return msgFilter(text)
+	return msgFilter(text, names)
 }
 
 func parsePostImageKeys(content string) []string {
@@ -73,11 +139,11 @@ func parsePostImageKeys(content string) []string {
 	return imageKeys
 }
 
-func parseContent(content, msgType string) string {
+func parseContent(content, msgType string, names map[string]string) string {
 	//"{\"text\":\"@_user_1  hahaha\"}",
 	//only get text content hahaha
 	if msgType == "post" {
-		return parsePostContent(content)
+		return parsePostContent(content, names)
 	}
 
 	var contentMap map[string]interface{}
@@ -89,7 +155,23 @@ func parseContent(content, msgType string) string {
 		return ""
 	}
 	text := contentMap["text"].(string)
-	return msgFilter(text)
+	return msgFilter(text, names)
+}
+
+var urlRegex = regexp.MustCompile(`https?://[^\s<>"'，。；！？、（）【】《》]+`)
+
+// parseURLs 提取消息中的链接，去掉结尾的标点并去重
+func parseURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range urlRegex.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:!?)]}")
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
 }
 
 func processMessage(msg interface{}) (string, error) {
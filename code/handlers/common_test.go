@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"testing"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+func newMention(key, name, openId string) *larkim.MentionEvent {
+	return &larkim.MentionEvent{Key: &key, Name: &name, Id: &larkim.UserId{OpenId: &openId}}
+}
+
+// @bot @alice please review：机器人和其他人同时被@
+var botAndAlice = []*larkim.MentionEvent{
+	newMention("@_user_1", "助手", "ou_bot"),
+	newMention("@_user_2", "alice", "ou_alice"),
+}
+
+func TestBotMentionedIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		bot      botIdentity
+		mentions []*larkim.MentionEvent
+		want     bool
+	}{
+		{"open_id among several mentions", botIdentity{openId: "ou_bot", name: "旧名字"}, botAndAlice, true},
+		{"open_id not mentioned", botIdentity{openId: "ou_bot"}, botAndAlice[1:], false},
+		{"renamed bot still matched by open_id", botIdentity{openId: "ou_bot", name: "助手2"}, botAndAlice[:1], true},
+		{"name fallback without open_id", botIdentity{name: "助手"}, botAndAlice, true},
+		{"name fallback does not match others", botIdentity{name: "助手"}, botAndAlice[1:], false},
+		{"no identity matches nothing", botIdentity{}, botAndAlice, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.bot.mentionedIn(tt.mentions); got != tt.want {
+				t.Errorf("mentionedIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContentMentions(t *testing.T) {
+	bot := botIdentity{openId: "ou_bot"}
+	tests := []struct {
+		name     string
+		content  string
+		msgType  string
+		mentions []*larkim.MentionEvent
+		bot      botIdentity
+		want     string
+	}{
+		{
+			name:     "bot removed, others kept as names",
+			content:  `{"text":"@_user_1 @_user_2 please review"}`,
+			msgType:  "text",
+			mentions: botAndAlice,
+			bot:      bot,
+			want:     " @alice please review",
+		},
+		{
+			name:     "name fallback without open_id",
+			content:  `{"text":"@_user_1 @_user_2 please review"}`,
+			msgType:  "text",
+			mentions: botAndAlice,
+			bot:      botIdentity{name: "助手"},
+			want:     " @alice please review",
+		},
+		{
+			name:     "at all and emails",
+			content:  `{"text":"@_user_1 @_all 周会改到 a@b.com 发的时间"}`,
+			msgType:  "text",
+			mentions: botAndAlice[:1],
+			bot:      bot,
+			want:     " @所有人 周会改到 a@b.com 发的时间",
+		},
+		{
+			name:     "unknown placeholder dropped",
+			content:  `{"text":"@_user_1 @_user_9 hi"}`,
+			msgType:  "text",
+			mentions: botAndAlice[:1],
+			bot:      bot,
+			want:     "  hi",
+		},
+		{
+			name: "at tags in post",
+			content: `{"title":"","content":[[{"tag":"at","user_id":"@_user_1","user_name":"助手"},` +
+				`{"tag":"text","text":" 请 "},{"tag":"at","user_id":"@_user_2","user_name":"alice"},` +
+				`{"tag":"text","text":" 看一下"}]]}`,
+			msgType:  "post",
+			mentions: botAndAlice,
+			bot:      bot,
+			want:     " 请 @alice 看一下\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseContent(tt.content, tt.msgType, mentionNames(tt.mentions, tt.bot))
+			if got != tt.want {
+				t.Errorf("parseContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,10 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
 	"os"
 
-	"start-feishubot/initialization"
 	"start-feishubot/utils/audio"
-
-	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 type AudioAction struct { /*语音*/
@@ -31,16 +27,13 @@ func (*AudioAction) Execute(a *ActionInfo) bool {
 		//fmt.Printf("fileKey: %s \n", fileKey)
 		msgId := a.info.msgId
 		//fmt.Println("msgId: ", *msgId)
-		req := larkim.NewGetMessageResourceReqBuilder().MessageId(
-			*msgId).FileKey(fileKey).Type("file").Build()
-		resp, err := initialization.GetLarkClient().Im.MessageResource.Get(context.Background(), req)
+		f := fmt.Sprintf("%s.ogg", fileKey)
+		err := downloadResource(*a.ctx, msgId, fileKey, "file", f)
 		//fmt.Println(resp, err)
 		if err != nil {
 			fmt.Println(err)
 			return true
 		}
-		f := fmt.Sprintf("%s.ogg", fileKey)
-		resp.WriteFile(f)
 		defer os.Remove(f)
 
 		//fmt.Println("f: ", f)
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"start-feishubot/utils"
+)
+
+type BranchAction struct { /*会话分支*/
+}
+
+func (*BranchAction) Execute(a *ActionInfo) bool {
+	if _, foundBranches := utils.EitherTrimEqual(a.info.qParsed,
+		"/branches", "分支列表"); foundBranches {
+		branches := a.handler.sessionCache.GetBranches(*a.info.sessionId)
+		if len(branches) == 0 {
+			replyMsg(*a.ctx, "🤖️：当前话题还没有对话记录～", a.info.msgId)
+			return false
+		}
+		sendBranchListCard(*a.ctx, a.info.sessionId, a.info.msgId, branches)
+		return false
+	}
+
+	if index, foundSwitch := utils.EitherCutPrefix(a.info.qParsed,
+		"/branch ", "切换分支 "); foundSwitch {
+		unlock := a.handler.sessionCache.LockSession(*a.info.sessionId)
+		defer unlock()
+		branches := a.handler.sessionCache.GetBranches(*a.info.sessionId)
+		n, err := strconv.Atoi(strings.TrimSpace(index))
+		if err != nil || n < 1 || n > len(branches) {
+			replyMsg(*a.ctx, fmt.Sprintf(
+				"🤖️：分支编号无效，当前话题共有 %d 个分支，可回复 *分支列表* 查看", len(branches)),
+				a.info.msgId)
+			return false
+		}
+		branch := branches[n-1]
+		a.handler.sessionCache.SwitchBranch(*a.info.sessionId, branch.LeafID)
+		replyMsg(*a.ctx, fmt.Sprintf("🌿 已切换到分支%d：%s", n,
+			utils.Ellipsis(branch.LastQuestion, 40)), a.info.msgId)
+		return false
+	}
+	return true
+}
@@ -3,8 +3,12 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
 
 	"start-feishubot/initialization"
+	"start-feishubot/platform"
 	"start-feishubot/services/openai"
 	"start-feishubot/utils"
 
@@ -21,7 +25,14 @@ type MsgInfo struct {
 	imageKey    string
 	imageKeys   []string // post 消息卡片中的图片组
 	sessionId   *string
-	mention     []*larkim.MentionEvent
+	rootId      string   // 话题根消息ID，不在话题中时为空
+	userId      *string  // 发送者 open_id
+	urls        []string // 消息中的链接
+	urlContext  string   // 抓取到的链接内容，作为上下文提供给模型
+	// 搜索命令的结果，作为上下文提供给模型，并在回答卡片中列出来源
+	searchContext string
+	toolRecords   []openai.ToolCallRecord
+	mention       []*larkim.MentionEvent
 }
 type ActionInfo struct {
 	handler *MessageHandler
@@ -57,6 +68,9 @@ func (*ProcessMentionAction) Execute(a *ActionInfo) bool {
 		if a.handler.judgeIfMentionMe(a.info.mention) {
 			return true
 		}
+		// 话题正在回答时会话锁被占用，放到后台记录，不阻塞事件回调
+		ctx := platform.WithPlatform(context.Background(), platform.FromContext(*a.ctx))
+		go a.handler.recordThreadMessage(ctx, a.info)
 		return false
 	}
 	return false
@@ -95,6 +109,8 @@ type RolePlayAction struct { /*角色扮演*/
 func (*RolePlayAction) Execute(a *ActionInfo) bool {
 	if system, foundSystem := utils.EitherCutPrefix(a.info.qParsed,
 		"/system ", "角色扮演 "); foundSystem {
+		unlock := a.handler.sessionCache.LockSession(*a.info.sessionId)
+		defer unlock()
 		a.handler.sessionCache.Clear(*a.info.sessionId)
 		systemMsg := append([]openai.Messages{}, openai.Messages{
 			Role: "system", Content: system,
@@ -149,13 +165,140 @@ func (*RoleListAction) Execute(a *ActionInfo) bool {
 		//a.handler.sessionCache.SetMsg(*a.info.sessionId, systemMsg)
 		//sendSystemInstructionCard(*a.ctx, a.info.sessionId,
 		//	a.info.msgId, system)
-		tags := initialization.GetAllUniqueTags()
-		SendRoleTagsCard(*a.ctx, a.info.sessionId, a.info.msgId, *tags)
+		tags := initialization.GetAllUniqueTags(a.info.roleScope())
+		SendRoleTagsCard(*a.ctx, a.info.sessionId, a.info.msgId, *a.info.chatId, *tags)
 		return false
 	}
 	return true
 }
 
+type ReasoningEffortAction struct { /*推理强度*/
+}
+
+// Execute /reasoning 显示选择卡片，/reasoning high 直接设置
+func (*ReasoningEffortAction) Execute(a *ActionInfo) bool {
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/reasoning", "推理强度"); found {
+		sendReasoningEffortCard(*a.ctx, a.info.sessionId, a.info.msgId,
+			a.handler.sessionCache.GetReasoningEffort(*a.info.sessionId))
+		return false
+	}
+	if effort, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/reasoning ", "推理强度 "); found {
+		effort = strings.ToLower(strings.TrimSpace(effort))
+		label, ok := reasoningEffortLabels[effort]
+		if !ok {
+			replyMsg(*a.ctx, "🤖️：推理强度可选 default、low、medium、high", a.info.msgId)
+			return false
+		}
+		if effort == "default" {
+			effort = ""
+		}
+		a.handler.sessionCache.SetReasoningEffort(*a.info.sessionId, effort)
+		replyMsg(*a.ctx, "已选择推理强度:"+label, a.info.msgId)
+		return false
+	}
+	return true
+}
+
+type ParamsAction struct { /*生成参数*/
+}
+
+// Execute /params 显示设置卡片，/params temperature=0.5 max_tokens=1000 直接设置，
+// /params reset 恢复默认
+func (*ParamsAction) Execute(a *ActionInfo) bool {
+	sessionId := *a.info.sessionId
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/params", "生成参数"); found {
+		sendParamsCard(*a.ctx, a.info.msgId, sessionId,
+			a.handler.sessionCache.GetParams(sessionId),
+			a.handler.sessionCache.GetCurrentModel(sessionId))
+		return false
+	}
+	args, found := utils.EitherCutPrefix(a.info.qParsed, "/params ", "生成参数 ")
+	if !found {
+		return true
+	}
+	params := a.handler.sessionCache.GetParams(sessionId)
+	if strings.TrimSpace(args) == "reset" {
+		params = openai.GenParams{}
+	} else {
+		pairs, ok := parseParamArgs(args)
+		if !ok {
+			replyMsg(*a.ctx, "🤖️：参数格式为 名称=值，例如 /params temperature=0.5 max_tokens=1000，"+
+				"值中有空格时可以加引号，例如 stop=\"### END\"", a.info.msgId)
+			return false
+		}
+		for _, pair := range pairs {
+			if err := params.Set(strings.ToLower(pair[0]), pair[1]); err != nil {
+				replyMsg(*a.ctx, "🤖️："+err.Error(), a.info.msgId)
+				return false
+			}
+		}
+	}
+	a.handler.sessionCache.SetParams(sessionId, params)
+	sendParamsCard(*a.ctx, a.info.msgId, sessionId, params,
+		a.handler.sessionCache.GetCurrentModel(sessionId))
+	return false
+}
+
+// paramNameRegex 参数名=值 中的参数名部分
+var paramNameRegex = regexp.MustCompile(`^[A-Za-z_]+=`)
+
+// parseParamArgs 解析 名称=值 列表。只在下一个 名称= 之前的空格处分隔，
+// 值中可以带空格（stop=### END），也可以用引号包起来（stop="a b=c"），引号中的内容不会被当成参数名
+func parseParamArgs(args string) (pairs [][2]string, ok bool) {
+	type word struct {
+		text string
+		bare string // 第一个引号之前的部分，只有这里能出现参数名
+	}
+	var words []word
+	var text, bare strings.Builder
+	var quote rune
+	inWord, quoted := false, false
+	for _, r := range args {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			text.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord, quoted = r, true, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word{text.String(), bare.String()})
+				text.Reset()
+				bare.Reset()
+				inWord, quoted = false, false
+			}
+		default:
+			text.WriteRune(r)
+			if !quoted {
+				bare.WriteRune(r)
+			}
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, false
+	}
+	if inWord {
+		words = append(words, word{text.String(), bare.String()})
+	}
+	for _, w := range words {
+		if paramNameRegex.MatchString(w.bare) {
+			name, value, _ := strings.Cut(w.text, "=")
+			pairs = append(pairs, [2]string{name, value})
+			continue
+		}
+		if len(pairs) == 0 {
+			return nil, false
+		}
+		pairs[len(pairs)-1][1] += " " + w.text
+	}
+	return pairs, len(pairs) > 0
+}
+
 type AIModeAction struct { /*发散模式*/
 }
 
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParamArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want [][2]string
+		ok   bool
+	}{
+		{"temperature=0.5 max_tokens=1000", [][2]string{{"temperature", "0.5"}, {"max_tokens", "1000"}}, true},
+		{"stop=### END seed=42", [][2]string{{"stop", "### END"}, {"seed", "42"}}, true},
+		{`stop="a  b=c" top_p=0.9`, [][2]string{{"stop", "a  b=c"}, {"top_p", "0.9"}}, true},
+		{`stop=END, "x=1"`, [][2]string{{"stop", "END, x=1"}}, true},
+		{"temperature=default", [][2]string{{"temperature", "default"}}, true},
+		{"0.5", nil, false},
+		{`stop="END`, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseParamArgs(tt.args)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseParamArgs(%q) = %q, %v, want %q, %v", tt.args, got, ok, tt.want, tt.ok)
+		}
+	}
+}
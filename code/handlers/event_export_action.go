@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"start-feishubot/utils"
+)
+
+type ExportAction struct { /*导出话题*/
+}
+
+func (*ExportAction) Execute(a *ActionInfo) bool {
+	if _, foundExport := utils.EitherTrimEqual(a.info.qParsed,
+		"/export", "导出"); foundExport {
+		msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
+		if len(msg) == 0 {
+			replyMsg(*a.ctx, "🤖️：当前话题还没有对话记录～", a.info.msgId)
+			return false
+		}
+		sendExportCard(*a.ctx, a.info.sessionId, a.info.msgId, len(msg))
+		return false
+	}
+
+	// /export md 或 /export doc 直接导出
+	if format, foundExport := utils.EitherCutPrefix(a.info.qParsed,
+		"/export ", "导出 "); foundExport {
+		switch strings.TrimSpace(format) {
+		case "md", "markdown", "文件":
+			format = ExportFormatFile
+		case "doc", "文档":
+			format = ExportFormatDoc
+		default:
+			replyMsg(*a.ctx, "🤖️：支持的导出格式为 md 或 doc", a.info.msgId)
+			return false
+		}
+		openId := ""
+		if a.info.userId != nil {
+			openId = *a.info.userId
+		}
+		err := a.handler.exportSession(*a.ctx, *a.info.sessionId,
+			a.info.msgId, openId, format)
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：导出失败～\n错误信息: %v", err), a.info.msgId)
+		}
+		return false
+	}
+	return true
+}
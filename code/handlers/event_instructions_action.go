@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"start-feishubot/services"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+)
+
+// userInstructionsPrefix 合并到系统提示词时自定义指令前的说明
+const userInstructionsPrefix = "提问人设置了以下自定义指令，请在不违背上面设定的前提下遵守：\n"
+
+// withUserInstructions 把提问人的自定义指令合并到第一条系统消息中，只用于本次请求，不写入历史。
+// 群里多人在同一话题提问时，每次都使用当前提问人的指令
+func withUserInstructions(msg []openai.Messages, info *MsgInfo) []openai.Messages {
+	if info.userId == nil || *info.userId == "" {
+		return msg
+	}
+	instructions := services.GetUserProfiles().Get(*info.userId).Instructions
+	if instructions == "" {
+		return msg
+	}
+	req := make([]openai.Messages, len(msg))
+	copy(req, msg)
+	for i, m := range req {
+		if m.Role == "system" {
+			req[i].Content = m.Content + "\n\n" + userInstructionsPrefix + instructions
+			return req
+		}
+	}
+	return append([]openai.Messages{{
+		Role: "system", Content: userInstructionsPrefix + instructions,
+	}}, req...)
+}
+
+// requestMessages 发给模型的消息：在会话历史上加入提问人的自定义指令、长期记忆和抓取到的链接内容，
+// 这些内容属于个人或篇幅较大，只用于本次请求
+func requestMessages(msg []openai.Messages, info *MsgInfo) []openai.Messages {
+	return withURLContext(withMemory(withUserInstructions(msg, info), info), info)
+}
+
+// saveUserInstructions 保存自定义指令，为空表示清除
+func saveUserInstructions(userId string, instructions string) error {
+	instructions = strings.TrimSpace(instructions)
+	if utf8.RuneCountInString(instructions) > services.MaxInstructionRunes {
+		return fmt.Errorf("自定义指令不能超过 %d 个字", services.MaxInstructionRunes)
+	}
+	return services.GetUserProfiles().Update(userId, func(profile *services.UserProfile) {
+		profile.Instructions = instructions
+	})
+}
+
+type InstructionsAction struct { /*自定义指令*/
+}
+
+// Execute /instructions 打开编辑卡片，/instructions set 内容 直接设置，/instructions clear 清除
+func (*InstructionsAction) Execute(a *ActionInfo) bool {
+	if a.info.userId == nil || *a.info.userId == "" {
+		return true
+	}
+	userId := *a.info.userId
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/instructions", "自定义指令"); found {
+		sendInstructionsCard(*a.ctx, a.info.msgId, userId,
+			services.GetUserProfiles().Get(userId).Instructions)
+		return false
+	}
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/instructions clear", "清除自定义指令"); found {
+		if err := saveUserInstructions(userId, ""); err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：清除失败～\n%v", err), a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, "📌 已清除自定义指令", a.info.msgId)
+		return false
+	}
+	if instructions, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/instructions set ", "设置自定义指令 "); found {
+		if err := saveUserInstructions(userId, instructions); err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：保存失败～\n%v", err), a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, "📌 已保存自定义指令，之后的每次提问都会带上", a.info.msgId)
+		return false
+	}
+	return true
+}
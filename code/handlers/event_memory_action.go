@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"start-feishubot/services"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+)
+
+// maxMemoryContextFacts 每次提问最多带上的记忆条数
+const maxMemoryContextFacts = 5
+
+// memoryContext 与问题相关的长期记忆
+func memoryContext(info *MsgInfo) string {
+	if info.userId == nil || *info.userId == "" {
+		return ""
+	}
+	var lines []string
+	for _, fact := range services.GetMemory().Relevant(*info.userId, info.qParsed, maxMemoryContextFacts) {
+		lines = append(lines, "- "+fact.Text)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "以下是关于用户的长期记忆，回答时可以参考，与问题无关时忽略：\n" + strings.Join(lines, "\n")
+}
+
+// withMemory 把提问人的长期记忆放在本次问题之前，只用于本次请求，不写入历史。
+// 记忆是个人的，群里同一话题中其他人提问时不会带上
+func withMemory(msg []openai.Messages, info *MsgInfo) []openai.Messages {
+	return withContextBeforeQuestion(msg, memoryContext(info))
+}
+
+// withContextBeforeQuestion 在本次问题之前插入一条系统消息，返回新的切片，不改动会话历史
+func withContextBeforeQuestion(msg []openai.Messages, content string) []openai.Messages {
+	if content == "" || len(msg) == 0 {
+		return msg
+	}
+	last := len(msg) - 1
+	req := make([]openai.Messages, 0, len(msg)+1)
+	req = append(req, msg[:last]...)
+	req = append(req, openai.Messages{Role: "system", Content: content}, msg[last])
+	return req
+}
+
+// messageTools 群里启用的工具，加上提问人开启长期记忆后可用的记忆工具
+func messageTools(info *MsgInfo) openai.ToolExecutor {
+	tools := chatTools(*info.chatId)
+	if info.userId == nil {
+		return tools
+	}
+	memory := services.GetMemory().Tool(*info.userId)
+	if memory == nil {
+		return tools
+	}
+	if tools == nil {
+		return memory
+	}
+	return openai.MultiToolExecutor{tools, memory}
+}
+
+type MemoryAction struct { /*长期记忆*/
+}
+
+// Execute /remember 内容 保存记忆，/memory 查看，/memory on|off|clear 开关和清空，/memory delete 序号 删除
+func (*MemoryAction) Execute(a *ActionInfo) bool {
+	if a.info.userId == nil || *a.info.userId == "" {
+		return true
+	}
+	userId := *a.info.userId
+	memory := services.GetMemory()
+	if text, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/remember ", "记住 "); found {
+		wasEnabled := memory.Get(userId).Enabled
+		fact, err := memory.Remember(userId, text)
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：保存记忆失败～\n%v", err), a.info.msgId)
+			return false
+		}
+		reply := "🧠 已记住：" + fact.Text
+		if !wasEnabled {
+			reply += "\n已为你开启长期记忆，回复 /memory 可查看或删除"
+		}
+		replyMsg(*a.ctx, reply, a.info.msgId)
+		return false
+	}
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/memory", "记忆"); found {
+		sendMemoryCard(*a.ctx, a.info.msgId, userId, memory.Get(userId))
+		return false
+	}
+	op, found := utils.EitherCutPrefix(a.info.qParsed, "/memory ")
+	if !found {
+		return true
+	}
+	op = strings.TrimSpace(op)
+	var err error
+	switch {
+	case op == "on" || op == "off":
+		err = memory.SetEnabled(userId, op == "on")
+	case op == "clear":
+		err = memory.Clear(userId)
+	case strings.HasPrefix(op, "delete "):
+		err = forgetByIndex(userId, strings.TrimSpace(strings.TrimPrefix(op, "delete ")))
+	default:
+		replyMsg(*a.ctx, "🤖️：可用命令：/memory on、/memory off、/memory clear、/memory delete 序号", a.info.msgId)
+		return false
+	}
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：操作失败～\n%v", err), a.info.msgId)
+		return false
+	}
+	sendMemoryCard(*a.ctx, a.info.msgId, userId, memory.Get(userId))
+	return false
+}
+
+// forgetByIndex 按记忆卡片上的序号删除
+func forgetByIndex(userId string, index string) error {
+	facts := services.GetMemory().Get(userId).Facts
+	if len(facts) > maxMemoryCardFacts {
+		facts = facts[len(facts)-maxMemoryCardFacts:]
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 1 || i > len(facts) {
+		return fmt.Errorf("序号 %s 不存在", index)
+	}
+	_, err = services.GetMemory().Forget(userId, facts[i-1].ID)
+	return err
+}
@@ -101,8 +101,8 @@ func handleModelCompare(a *ActionInfo) bool {
 	// 启用对比模式
 	services.GetSessionCache().SetCompareMode(sessionId, true)
 	
-	// 获取所有支持的模型
-	allModels := openai.GetAllModels()
+	// 获取所有支持的模型，自动选择不参与对比
+	allModels := openai.GetConcreteModels()
 	
 	// 发送初始消息
 	initMsg := fmt.Sprintf("🤖 多模型对比模式\n问题: %s\n\n正在请求各个模型的回答...", query)
@@ -131,7 +131,7 @@ func handleModelCompare(a *ActionInfo) bool {
 // handleModelList 处理模型列表命令
 func handleModelList(a *ActionInfo) bool {
 	// 按分类显示模型
-	categories := []string{"通用", "编程", "分析", "长文本", "免费"}
+	categories := []string{"自动", "通用", "编程", "分析", "长文本", "免费"}
 	
 	var msgBuilder strings.Builder
 	msgBuilder.WriteString("🤖 **支持的模型列表**\n\n")
@@ -250,8 +250,9 @@ func callModelForComparison(a *ActionInfo, query, modelID string) string {
 		{Role: "user", Content: query},
 	}
 	
-	// 使用指定模型调用
-	response, err := a.handler.gpt.CompletionsWithModel(msg, openai.Balance, modelID)
+	// 使用指定模型调用，对比时不降级到其它模型
+	response, err := a.handler.gpt.CompletionsWithOptions(*a.ctx, msg, openai.Balance, modelID,
+		openai.ChatOptions{NoFallback: true})
 	if err != nil {
 		return fmt.Sprintf("调用失败: %s", err.Error())
 	}
@@ -1,24 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"start-feishubot/logger"
 	"start-feishubot/services/openai"
-	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
 )
 
-func setDefaultPrompt(msg []openai.Messages) []openai.Messages {
-	if !hasSystemRole(msg) {
-		msg = append(msg, openai.Messages{
-			Role: "system", Content: "你是一个智能助手，请默认使用中文回答用户的问题，除非用户明确要求使用其他语言。请尽可能详细和准确地回答用户的问题。当前日期：" + time.Now().Format("2006年01月02日"),
-		})
-	}
-	return msg
-}
-
 //func setDefaultVisionPrompt(msg []openai.VisionMessages) []openai.VisionMessages {
 //	if !hasSystemRole(msg) {
 //		msg = append(msg, openai.VisionMessages{
@@ -43,55 +36,87 @@ func (*MessageAction) Execute(a *ActionInfo) bool {
 	if a.handler.config.StreamMode {
 		return true
 	}
+	// 同一会话的消息排队处理，避免并发的两轮对话互相覆盖历史
+	unlock := a.handler.sessionCache.LockSession(*a.info.sessionId)
+	defer unlock()
 	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
 	// 如果没有提示词，默认模拟ChatGPT
-	msg = setDefaultPrompt(msg)
+	msg = a.handler.setDefaultPrompt(*a.ctx, msg, a.info.promptTarget())
+	newTopic := len(msg) == 1
+	msg = withExtraContext(msg, a.info)
 	msg = append(msg, openai.Messages{
-		Role: "user", Content: a.info.qParsed,
+		Role: "user", Content: a.info.qParsed, FeishuMsgId: *a.info.msgId,
+		Speaker: speakerName(*a.ctx, a.info),
 	})
 
 	// get ai mode as temperature
 	aiMode := a.handler.sessionCache.GetAIMode(*a.info.sessionId)
-	// get current selected model
-	currentModel := a.handler.sessionCache.GetCurrentModel(*a.info.sessionId)
+	// get current selected model，自动选择时按问题挑选
+	currentModel, autoRoute := resolveModel(*a.ctx, a.handler.gpt,
+		a.handler.sessionCache.GetCurrentModel(*a.info.sessionId), routeInput(a.info))
 	fmt.Println("msg: ", msg)
 	fmt.Println("aiMode: ", aiMode)
 	fmt.Println("currentModel: ", currentModel)
 	
-	// use specified model for completion
-	completions, err := a.handler.gpt.CompletionsWithModel(msg, aiMode, currentModel)
+	schema := a.handler.sessionCache.GetResponseSchema(*a.info.sessionId)
+	// use specified model for completion，群里启用了工具时允许模型调用
+	// /search 的结果先占用参考来源编号，模型再次搜索时接着编号
+	completions, err := a.handler.gpt.CompletionsWithOptions(
+		openai.WithReferenceNumbering(*a.ctx, a.info.toolRecords),
+		requestMessages(msg, a.info), aiMode, currentModel,
+		openai.ChatOptions{
+			Tools:           messageTools(a.info),
+			ReasoningEffort: a.handler.sessionCache.GetReasoningEffort(*a.info.sessionId),
+			Params:          a.handler.sessionCache.GetParams(*a.info.sessionId),
+			ResponseSchema:  schema,
+		})
 	if err != nil {
 		replyMsg(*a.ctx, fmt.Sprintf(
 			"🤖️：消息机器人摆烂了，请稍后再试～\n错误信息: %v", err), a.info.msgId)
 		return false
 	}
+	completions.ToolRecords = append(a.info.toolRecords, completions.ToolRecords...)
+	completions.AutoRoute = autoRoute
+	applyResponseSchema(&completions, schema)
 	msg = append(msg, completions)
-	a.handler.sessionCache.SetMsg(*a.info.sessionId, msg)
 	//if new topic
-	if len(msg) == 3 {
+	var cardId *string
+	if newTopic {
 		//fmt.Println("new topic", msg[1].Content)
-		sendNewTopicCard(*a.ctx, a.info.sessionId, a.info.msgId,
-			completions.Content)
-		return false
+		cardId, err = sendNewTopicCard(*a.ctx, a.info.sessionId, a.info.chatId, a.info.msgId,
+			completions)
+	} else {
+		cardId, err = sendOldTopicCard(*a.ctx, a.info.sessionId, a.info.chatId, a.info.msgId,
+			completions)
 	}
-	if len(msg) != 3 {
-		sendOldTopicCard(*a.ctx, a.info.sessionId, a.info.msgId,
-			completions.Content)
-		return false
+	// 记录回答卡片的消息ID，之后可以从卡片上编辑问题开辟分支
+	if err == nil && cardId != nil {
+		msg[len(msg)-1].FeishuMsgId = *cardId
 	}
-	// 使用卡片格式回复以支持markdown
-	cardContent, _ := newSendCard(
-		withHeader("🤖 AI回答", larkcard.TemplateGreen),
-		withMainMd(completions.Content),
-		withModelSwitchButtons(a.info.sessionId),
-		withNote("点击按钮可切换其他模型回答"))
-	err = replyCard(*a.ctx, a.info.msgId, cardContent)
-	if err != nil {
-		replyMsg(*a.ctx, fmt.Sprintf(
-			"🤖️：消息机器人摆烂了，请稍后再试～\n错误信息: %v", err), a.info.msgId)
-		return false
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, msg)
+	replyStructuredFile(*a.ctx, a.info.msgId, completions, schema)
+	return false
+}
+
+// resolveModel 会话选择了自动模型时，按问题内容挑选本次使用的模型，
+// 返回实际模型和卡片脚注中的选择说明
+func resolveModel(ctx context.Context, gpt *openai.ChatGPT, model string,
+	in openai.RouteInput) (string, string) {
+	if model != openai.AutoModel {
+		return model, ""
+	}
+	decision := gpt.RouteModel(ctx, in)
+	logger.Infof("🧭 自动选择模型 %s：%s", decision.Model, decision.Reason)
+	return decision.Model, decision.Note()
+}
+
+// routeInput 自动选择模型时参考的问题信息
+func routeInput(info *MsgInfo) openai.RouteInput {
+	return openai.RouteInput{
+		Question:     info.qParsed,
+		ContextRunes: utf8.RuneCountInString(info.urlContext + info.searchContext),
+		HasImage:     len(info.imageKeys) > 0,
 	}
-	return true
 }
 
 // 判断msg中的是否包含system role
@@ -111,28 +136,34 @@ func (m *StreamMessageAction) Execute(a *ActionInfo) bool {
 	if !a.handler.config.StreamMode {
 		return true
 	}
+	// 会话锁在异步回答结束、历史写回之后才释放
+	unlock := a.handler.sessionCache.LockSession(*a.info.sessionId)
 	msg := a.handler.sessionCache.GetMsg(*a.info.sessionId)
 	// 如果没有提示词，默认模拟ChatGPT
-	msg = setDefaultPrompt(msg)
-	msg = append(msg, openai.Messages{
-		Role: "user", Content: a.info.qParsed,
-	})
-	//if new topic
+	msg = a.handler.setDefaultPrompt(*a.ctx, msg, a.info.promptTarget())
+	//if new topic，在加入链接内容之前判断
 	var ifNewTopic bool
-	if len(msg) <= 3 {
+	if len(msg) <= 2 {
 		ifNewTopic = true
 	} else {
 		ifNewTopic = false
 	}
+	msg = withExtraContext(msg, a.info)
+	msg = append(msg, openai.Messages{
+		Role: "user", Content: a.info.qParsed, FeishuMsgId: *a.info.msgId,
+		Speaker: speakerName(*a.ctx, a.info),
+	})
 
 	// 🔥 关键修复：立即发送"正在处理"卡片，然后异步处理AI调用
 	cardId, err2 := sendOnProcess(a, ifNewTopic)
 	if err2 != nil {
+		unlock()
 		return false
 	}
 
 	// 🔥 完全异步处理AI调用，不阻塞责任链执行
 	go func() {
+		defer unlock()
 		defer func() {
 			if err := recover(); err != nil {
 				log.Printf("StreamMessageAction panic: %v", err)
@@ -140,27 +171,36 @@ func (m *StreamMessageAction) Execute(a *ActionInfo) bool {
 			}
 		}()
 
+		// 上游请求使用独立的 ctx，点击"停止生成"时取消
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stopCh := registerStreamStop(*cardId)
+		defer unregisterStreamStop(*cardId, stopCh)
+
 		answer := ""
 		chatResponseStream := make(chan string)
-		done := make(chan struct{}) // 添加 done 信号，保证 goroutine 正确退出
-		noContentTimeout := time.AfterFunc(10*time.Second, func() {
-			log.Println("no content timeout")
-			close(done)
-			err := updateFinalCardWithSession(*a.ctx, "请求超时", cardId, a.info.sessionId, ifNewTopic)
-			if err != nil {
-				return
-			}
-			return
-		})
+		done := make(chan struct{}) // StreamChat 返回后关闭
+		var streamErr error
+		var result openai.StreamResult
+		currentModel, autoRoute := resolveModel(ctx, a.handler.gpt,
+			a.handler.sessionCache.GetCurrentModel(*a.info.sessionId), routeInput(a.info))
+		tools := messageTools(a.info)
+		schema := a.handler.sessionCache.GetResponseSchema(*a.info.sessionId)
+		toolCh := make(chan openai.ToolCallRecord, 1)
+		reasoningCh := make(chan string)
+		// 调用工具时首个字会来得更晚
+		timeout := 10 * time.Second
+		if tools != nil {
+			timeout = 60 * time.Second
+		}
+		noContentTimeout := time.NewTimer(timeout)
 		defer noContentTimeout.Stop()
 
 		go func() {
+			defer close(done)
 			defer func() {
 				if err := recover(); err != nil {
-					err := updateFinalCardWithSession(*a.ctx, "聊天失败", cardId, a.info.sessionId, ifNewTopic)
-					if err != nil {
-						return
-					}
+					streamErr = fmt.Errorf("stream panic: %v", err)
 				}
 			}()
 
@@ -168,100 +208,165 @@ func (m *StreamMessageAction) Execute(a *ActionInfo) bool {
 			aiMode := a.handler.sessionCache.GetAIMode(*a.info.sessionId)
 			//fmt.Println("msg: ", msg)
 			//fmt.Println("aiMode: ", aiMode)
-			if err := a.handler.gpt.StreamChat(*a.ctx, msg, aiMode,
-				chatResponseStream); err != nil {
-				err := updateFinalCardWithSession(*a.ctx, "聊天失败", cardId, a.info.sessionId, ifNewTopic)
-				if err != nil {
-					return
-				}
-				close(done) // 关闭 done 信号
-			}
-
-			close(done) // 关闭 done 信号
+			result, streamErr = a.handler.gpt.StreamChatWithOptions(
+				openai.WithReferenceNumbering(ctx, a.info.toolRecords),
+				requestMessages(msg, a.info), aiMode,
+				currentModel, chatResponseStream, openai.ChatOptions{
+					Tools:           tools,
+					ReasoningEffort: a.handler.sessionCache.GetReasoningEffort(*a.info.sessionId),
+					Params:          a.handler.sessionCache.GetParams(*a.info.sessionId),
+					ResponseSchema:  schema,
+					OnToolCall: func(r openai.ToolCallRecord) {
+						select {
+						case toolCh <- r:
+						case <-ctx.Done():
+						}
+					},
+					OnReasoning: func(r string) {
+						select {
+						case reasoningCh <- r:
+						case <-ctx.Done():
+						}
+					},
+				})
 		}()
-		
+
 		// 🎯 符合飞书官方要求的流式卡片更新机制
 		// 基于飞书API最佳实践：适中的更新频率，避免过于频繁的API调用
 		streamTicker := time.NewTicker(800 * time.Millisecond) // 800ms间隔，确保稳定性
 		defer streamTicker.Stop()
-		
+
 		var lastUpdateLength int // 记录上次更新的内容长度
-		var isStreaming bool = true
-		
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("流式更新协程异常:", r)
-				}
-			}()
-			
-			for isStreaming {
-				select {
-				case <-done:
-					isStreaming = false
-					return
-				case <-streamTicker.C:
-					// 📝 按块更新内容，给用户流式输出的感觉
-					if len(answer) > lastUpdateLength {
-						// 🎭 形式上的流式：显示当前内容 + 正在输入指示器
-						streamingContent := answer
-						if len(answer) > 0 {
-							streamingContent = answer + "\n\n⏳ *正在生成中...*"
-						}
-						
-						err := updateTextCard(*a.ctx, streamingContent, cardId, ifNewTopic)
-						if err != nil {
-							logger.Error("流式更新失败:", err)
-							// 遇到错误时适当延迟，避免频繁重试
-							time.Sleep(200 * time.Millisecond)
-							continue
-						}
-						
-						lastUpdateLength = len(answer)
-						logger.Debug("✨ 流式展示：当前内容长度", len(answer), "字符")
-					}
-				}
-			}
-		}()
-		
+		var stopped bool         // 用户是否点击了停止生成
+		toolRecords := a.info.toolRecords
+		reasoning := ""
+
 		for {
 			select {
-			case res, ok := <-chatResponseStream:
-				if !ok {
-					return
-				}
+			case res := <-chatResponseStream:
 				noContentTimeout.Stop()
 				answer += res
 				//pp.Println("answer", answer)
+			case r := <-reasoningCh:
+				// 💭 思考过程也算作有输出，不触发超时
+				noContentTimeout.Stop()
+				reasoning += r
+			case r := <-toolCh:
+				// 🔧 工具调用完成，立即在卡片上展示进度
+				toolRecords = append(toolRecords, r)
+				noContentTimeout.Reset(timeout)
+				streamingContent := streamingText(toolRecords, reasoning, answer)
+				if err := updateTextCard(*a.ctx, streamingContent, cardId, a.info.sessionId, ifNewTopic); err != nil {
+					logger.Error("流式更新失败:", err)
+				}
+			case <-noContentTimeout.C:
+				log.Println("no content timeout")
+				cancel()
+				updateFinalCardWithSession(*a.ctx, "请求超时", cardId, a.info.sessionId, ifNewTopic)
+				return
+			case <-stopCh:
+				// ⏹ 取消上游请求，等待 StreamChat 返回后按截断处理
+				stopped = true
+				stopCh = nil
+				cancel()
+			case <-streamTicker.C:
+				// 📝 按块更新内容，给用户流式输出的感觉
+				if len(answer)+len(reasoning) > lastUpdateLength {
+					// 🎭 形式上的流式：显示当前内容 + 正在输入指示器
+					streamingContent := streamingText(toolRecords, reasoning, answer)
+					err := updateTextCard(*a.ctx, streamingContent, cardId, a.info.sessionId, ifNewTopic)
+					if err != nil {
+						logger.Error("流式更新失败:", err)
+						continue
+					}
+					lastUpdateLength = len(answer) + len(reasoning)
+					logger.Debug("✨ 流式展示：当前内容长度", len(answer), "字符")
+				}
 			case <-done: // ✅ 流式更新完成处理
-				// 🎯 停止流式更新，标记完成状态
-				isStreaming = false
 				streamTicker.Stop()
-				
+				if stopped {
+					if result.Model != "" {
+						currentModel = result.Model
+					}
+					finishStoppedStream(a, msg, answer, currentModel, cardId, ifNewTopic)
+					return
+				}
+				if streamErr != nil {
+					logger.Errorf("流式回答失败: %v", streamErr)
+					updateFinalCardWithSession(*a.ctx, "聊天失败", cardId, a.info.sessionId, ifNewTopic)
+					return
+				}
+
 				// 📋 发送最终完整卡片 - 移除"正在生成中"提示，显示完整回答和操作按钮
-				err := updateFinalCardWithSession(*a.ctx, answer, cardId, a.info.sessionId, ifNewTopic)
+				reply := openai.Messages{
+					Role: "assistant", Content: answer,
+					Truncated:    result.FinishReason == openai.FinishReasonLength,
+					FeishuMsgId:  *cardId,
+					Model:        result.Model,
+					FallbackFrom: result.FallbackFrom,
+					ToolRecords:  append(a.info.toolRecords, result.ToolRecords...),
+					Reasoning:    result.Reasoning,
+					AutoRoute:    autoRoute,
+				}
+				applyResponseSchema(&reply, schema)
+				err := updateAnswerCard(*a.ctx, reply, cardId, a.info.sessionId, a.info.chatId, ifNewTopic)
 				if err != nil {
 					logger.Error("最终卡片更新失败:", err)
 					return
 				}
-				
+
 				// 💾 保存对话记录到缓存
-				msg := append(msg, openai.Messages{
-					Role: "assistant", Content: answer,
-				})
+				msg := append(msg, reply)
 				a.handler.sessionCache.SetMsg(*a.info.sessionId, msg)
-				close(chatResponseStream)
-				
+				replyStructuredFile(*a.ctx, a.info.msgId, reply, schema)
+
 				logger.Info("🎉 流式回答完成 - 总字符数:", len(answer))
 				return
 			}
 		}
 	}()
-	
+
 	// 🔥 立即返回false，表示处理完成（异步处理已启动）
 	return false
 }
 
+// finishStoppedStream 用户中途停止时，保留已生成的部分回答并标记为截断
+func finishStoppedStream(a *ActionInfo, msg []openai.Messages, answer string,
+	model string, cardId *string, ifNewTopic bool) {
+	if answer == "" {
+		updateFinalCardWithSession(*a.ctx, "⏹ 已停止生成", cardId, a.info.sessionId, ifNewTopic)
+		return
+	}
+	reply := openai.Messages{
+		Role: "assistant", Content: answer, Truncated: true,
+		FeishuMsgId: *cardId, Model: model,
+	}
+	err := updateAnswerCard(*a.ctx, reply, cardId, a.info.sessionId, a.info.chatId, ifNewTopic)
+	if err != nil {
+		logger.Error("最终卡片更新失败:", err)
+	}
+	msg = append(msg, reply)
+	a.handler.sessionCache.SetMsg(*a.info.sessionId, msg)
+	logger.Info("⏹ 流式回答被停止 - 已生成字符数:", len(answer))
+}
+
+// streamingText 生成中的卡片内容：工具调用记录 + 已生成的回答 + 正在输入指示器，
+// 推理模型还没开始回答时展示最近的思考过程
+func streamingText(toolRecords []openai.ToolCallRecord, reasoning string, answer string) string {
+	text := answer + "\n\n⏳ *正在生成中...*"
+	if answer == "" && reasoning != "" {
+		runes := []rune(strings.TrimSpace(reasoning))
+		if len(runes) > 300 {
+			runes = append([]rune("…"), runes[len(runes)-300:]...)
+		}
+		text = "💭 *正在思考...*\n\n> " + strings.ReplaceAll(string(runes), "\n", "\n> ")
+	}
+	if len(toolRecords) > 0 {
+		text = toolCallsNote(toolRecords) + "\n\n" + text
+	}
+	return text
+}
+
 func sendOnProcess(a *ActionInfo, ifNewTopic bool) (*string, error) {
 	// send 正在处理中
 	cardId, err := sendOnProcessCard(*a.ctx, a.info.sessionId,
@@ -1,17 +1,13 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"start-feishubot/logger"
 
-	"start-feishubot/initialization"
 	"start-feishubot/services"
 	"start-feishubot/services/openai"
 	"start-feishubot/utils"
-
-	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 type PicAction struct { /*图片*/
@@ -50,9 +46,8 @@ func (*PicAction) Execute(a *ActionInfo) bool {
 		//fmt.Printf("fileKey: %s \n", imageKey)
 		msgId := a.info.msgId
 		//fmt.Println("msgId: ", *msgId)
-		req := larkim.NewGetMessageResourceReqBuilder().MessageId(
-			*msgId).FileKey(imageKey).Type("image").Build()
-		resp, err := initialization.GetLarkClient().Im.MessageResource.Get(context.Background(), req)
+		f := fmt.Sprintf("%s.png", imageKey)
+		err := downloadResource(*a.ctx, msgId, imageKey, "image", f)
 		//fmt.Println(resp, err)
 		if err != nil {
 			//fmt.Println(err)
@@ -60,9 +55,6 @@ func (*PicAction) Execute(a *ActionInfo) bool {
 				a.info.msgId)
 			return false
 		}
-
-		f := fmt.Sprintf("%s.png", imageKey)
-		resp.WriteFile(f)
 		defer os.Remove(f)
 		resolution := a.handler.sessionCache.GetPicResolution(*a.
 			info.sessionId)
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"start-feishubot/logger"
+	"start-feishubot/services"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+)
+
+// promptTarget 渲染默认提示词时所在的群和提问人
+type promptTarget struct {
+	chatId string
+	userId string
+}
+
+func (m *MsgInfo) promptTarget() promptTarget {
+	scope := m.roleScope()
+	return promptTarget{chatId: scope.ChatId, userId: scope.UserId}
+}
+
+// defaultPromptTemplate 群主设置的默认提示词优先，其次是全局配置
+func (m MessageHandler) defaultPromptTemplate(chatId string) (tpl string, fromChat bool) {
+	if chatId != "" {
+		if tpl := services.GetChatSettings().Get(chatId).DefaultPrompt; tpl != "" {
+			return tpl, true
+		}
+	}
+	return m.config.DefaultPrompt, false
+}
+
+// promptLocation 提示词中日期使用的时区
+func (m MessageHandler) promptLocation() *time.Location {
+	if m.config.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(m.config.Timezone)
+	if err != nil {
+		logger.Warnf("时区 %s 无效，使用服务器时区: %v", m.config.Timezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// renderPrompt 渲染提示词模板，群名和用户名只在模板用到时才查询
+func (m MessageHandler) renderPrompt(ctx context.Context, tpl string, target promptTarget) string {
+	now := time.Now().In(m.promptLocation())
+	return utils.RenderTemplate(tpl, func(name string) (string, bool) {
+		switch name {
+		case "date":
+			return now.Format("2006年01月02日"), true
+		case "time":
+			return now.Format("15:04"), true
+		case "timezone":
+			_, offset := now.Zone()
+			zone := fmt.Sprintf("UTC%+03d:%02d", offset/3600, abs(offset%3600)/60)
+			if m.config.Timezone != "" {
+				zone = m.config.Timezone + " (" + zone + ")"
+			}
+			return zone, true
+		case "user_name":
+			return userName(ctx, target.userId), true
+		case "chat_name":
+			return chatInfo(ctx, target.chatId).Name, true
+		}
+		return "", false
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// setDefaultPrompt 话题没有系统提示词时加上默认提示词；已有的默认提示词在每次请求时重新渲染，
+// 保证日期和提问人是最新的，角色或 /system 设置的提示词保持不变
+func (m MessageHandler) setDefaultPrompt(ctx context.Context, msg []openai.Messages,
+	target promptTarget) []openai.Messages {
+	tpl, _ := m.defaultPromptTemplate(target.chatId)
+	for i, item := range msg {
+		if item.Role == "system" {
+			if item.DefaultPrompt {
+				msg[i].Content = m.renderPrompt(ctx, tpl, target)
+			}
+			return msg
+		}
+	}
+	if strings.TrimSpace(tpl) == "" {
+		return msg
+	}
+	return append(msg, openai.Messages{
+		Role: "system", Content: m.renderPrompt(ctx, tpl, target), DefaultPrompt: true,
+	})
+}
+
+// canManageChat 单聊里用户自己可以修改设置，群聊中只有群主可以
+func canManageChat(ctx context.Context, info *MsgInfo) bool {
+	if info.handlerType != GroupHandler {
+		return true
+	}
+	owner := chatInfo(ctx, *info.chatId).OwnerId
+	return owner != "" && info.userId != nil && owner == *info.userId
+}
+
+type DefaultPromptAction struct { /*默认提示词*/
+}
+
+// Execute /prompt 查看本群的默认提示词，/prompt set 模板 设置，/prompt reset 恢复全局默认
+func (*DefaultPromptAction) Execute(a *ActionInfo) bool {
+	chatId := *a.info.chatId
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/prompt", "默认提示词"); found {
+		tpl, fromChat := a.handler.defaultPromptTemplate(chatId)
+		source := "全局配置"
+		if fromChat {
+			source = "本群设置"
+		}
+		replyMsg(*a.ctx, fmt.Sprintf("📝 当前默认提示词（%s）：\n%s\n\n预览：\n%s\n\n"+
+			"可用变量：{{date}} {{time}} {{timezone}} {{user_name}} {{chat_name}}\n"+
+			"/prompt set 模板 设置本群默认提示词，/prompt reset 恢复全局配置",
+			source, tpl, a.handler.renderPrompt(*a.ctx, tpl, a.info.promptTarget())), a.info.msgId)
+		return false
+	}
+	if tpl, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/prompt set ", "设置默认提示词 "); found {
+		tpl = strings.TrimSpace(tpl)
+		if tpl == "" {
+			replyMsg(*a.ctx, "🤖️：默认提示词不能为空～", a.info.msgId)
+			return false
+		}
+		a.handler.updateDefaultPrompt(a, tpl)
+		return false
+	}
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/prompt reset", "恢复默认提示词"); found {
+		a.handler.updateDefaultPrompt(a, "")
+		return false
+	}
+	return true
+}
+
+// updateDefaultPrompt 修改本群的默认提示词，为空表示恢复全局配置，新话题开始生效
+func (m MessageHandler) updateDefaultPrompt(a *ActionInfo, tpl string) {
+	if !canManageChat(*a.ctx, a.info) {
+		replyMsg(*a.ctx, "🤖️：只有群主可以设置本群的默认提示词～", a.info.msgId)
+		return
+	}
+	err := services.GetChatSettings().Update(*a.info.chatId, func(settings *services.ChatSettings) {
+		settings.DefaultPrompt = tpl
+	})
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：保存失败～\n错误信息: %v", err), a.info.msgId)
+		return
+	}
+	if tpl == "" {
+		replyMsg(*a.ctx, "📝 已恢复为全局默认提示词", a.info.msgId)
+		return
+	}
+	replyMsg(*a.ctx, "📝 已设置本群的默认提示词，预览：\n"+
+		m.renderPrompt(*a.ctx, tpl, a.info.promptTarget()), a.info.msgId)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"start-feishubot/initialization"
+	"start-feishubot/utils"
+)
+
+// roleScope 发消息的用户和所在的群，用于合并他们的自定义角色
+func (m *MsgInfo) roleScope() initialization.RoleScope {
+	scope := initialization.RoleScope{}
+	if m.userId != nil {
+		scope.UserId = *m.userId
+	}
+	if m.chatId != nil {
+		scope.ChatId = *m.chatId
+	}
+	return scope
+}
+
+// sessionSystemPrompt 当前话题设置的角色或系统提示词，没有时返回空；
+// 自动加入的默认提示词不算，它已经渲染过日期等变量，保存成角色没有意义
+func (m MessageHandler) sessionSystemPrompt(sessionId string) string {
+	for _, msg := range m.sessionCache.GetMsg(sessionId) {
+		if msg.Role == "system" && !msg.DefaultPrompt {
+			return msg.Content
+		}
+	}
+	return ""
+}
+
+type CustomRoleAction struct { /*自定义角色*/
+}
+
+// Execute /role 列出自定义角色，/role save|share|delete 名称 管理自定义角色
+func (*CustomRoleAction) Execute(a *ActionInfo) bool {
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/role", "自定义角色"); found {
+		replyMsg(*a.ctx, customRoleSummary(a.info.roleScope()), a.info.msgId)
+		return false
+	}
+	scope := a.info.roleScope()
+	if title, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/role save ", "保存角色 "); found {
+		title = strings.TrimSpace(title)
+		system := a.handler.sessionSystemPrompt(*a.info.sessionId)
+		if err := initialization.SavePrivateRole(scope.UserId, title, system); err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：保存角色失败～\n%v", err), a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, fmt.Sprintf("🎭 已保存私有角色「%s」，可在 */roles* 的「%s」分类中选择",
+			title, initialization.PrivateRoleTag), a.info.msgId)
+		return false
+	}
+	if title, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/role share ", "分享角色 "); found {
+		if a.info.handlerType != GroupHandler {
+			replyMsg(*a.ctx, "🤖️：只能在群聊中分享角色～", a.info.msgId)
+			return false
+		}
+		title = strings.TrimSpace(title)
+		if err := initialization.ShareRole(scope.UserId, scope.ChatId, title); err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：分享角色失败～\n%v", err), a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, fmt.Sprintf("🎭 已把角色「%s」分享到本群，群成员可在 */roles* 的「%s」分类中选择",
+			title, initialization.SharedRoleTag), a.info.msgId)
+		return false
+	}
+	if title, found := utils.EitherCutPrefix(a.info.qParsed,
+		"/role delete ", "删除角色 "); found {
+		title = strings.TrimSpace(title)
+		shared, err := initialization.DeleteRole(scope.UserId, scope.ChatId, title)
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：删除角色失败～\n%v", err), a.info.msgId)
+			return false
+		}
+		where := "私有角色"
+		if shared {
+			where = "本群共享的角色"
+		}
+		replyMsg(*a.ctx, fmt.Sprintf("🗑️ 已删除%s「%s」", where, title), a.info.msgId)
+		return false
+	}
+	return true
+}
+
+// customRoleSummary 列出用户可用的自定义角色和管理命令
+func customRoleSummary(scope initialization.RoleScope) string {
+	private := initialization.GetTitleListByTag(initialization.PrivateRoleTag,
+		initialization.RoleScope{UserId: scope.UserId})
+	shared := initialization.GetTitleListByTag(initialization.SharedRoleTag,
+		initialization.RoleScope{ChatId: scope.ChatId})
+	var b strings.Builder
+	b.WriteString("🎭 自定义角色\n")
+	b.WriteString(fmt.Sprintf("%s：%s\n", initialization.PrivateRoleTag, roleTitles(*private)))
+	b.WriteString(fmt.Sprintf("%s：%s\n\n", initialization.SharedRoleTag, roleTitles(*shared)))
+	b.WriteString("在设置了角色的话题中回复 /role save 名称 保存当前系统提示词\n")
+	b.WriteString("/role share 名称 分享到本群，/role delete 名称 删除")
+	return b.String()
+}
+
+func roleTitles(titles []string) string {
+	if len(titles) == 0 {
+		return "暂无"
+	}
+	return strings.Join(titles, "、")
+}
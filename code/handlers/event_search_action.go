@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"start-feishubot/initialization"
+	"start-feishubot/logger"
+	"start-feishubot/services/openai"
+	"start-feishubot/services/search"
+	"start-feishubot/utils"
+)
+
+// webSearch 联网搜索工具，未配置搜索服务时为 nil
+var webSearch *search.Tool
+
+func initWebSearch(config initialization.Config) {
+	provider, err := search.New(config)
+	if err != nil {
+		logger.Errorf("初始化联网搜索失败: %v", err)
+		return
+	}
+	if provider == nil {
+		return
+	}
+	webSearch = &search.Tool{Provider: provider, Limit: config.SearchMaxResults}
+	logger.Infof("🔍 已启用联网搜索: %s", provider.Name())
+}
+
+type SearchAction struct { /*联网搜索*/
+}
+
+// Execute /search 关键词：先搜索，再把结果作为上下文交给后面的消息处理回答
+func (*SearchAction) Execute(a *ActionInfo) bool {
+	query, foundSearch := utils.EitherCutPrefix(a.info.qParsed, "/search ", "搜索 ")
+	if !foundSearch {
+		return true
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		replyMsg(*a.ctx, "🤖️：请在 /search 后面输入要搜索的内容～", a.info.msgId)
+		return false
+	}
+	if webSearch == nil {
+		replyMsg(*a.ctx, "🤖️：当前没有配置搜索服务～", a.info.msgId)
+		return false
+	}
+	results, err := webSearch.Provider.Search(context.Background(), query, webSearch.Limit)
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：搜索失败，请稍后再试～\n错误信息: %v", err), a.info.msgId)
+		return false
+	}
+	a.info.qParsed = query
+	// 编号接在本条消息已有的参考来源之后，回答时模型再次搜索也会继续编号
+	text := search.Format(results, openai.ReferenceNumberingFrom(
+		openai.WithReferenceNumbering(context.Background(), a.info.toolRecords)))
+	a.info.searchContext = "以下是联网搜索「" + query + "」的结果，请据此回答，并用 [编号] 标注引用的来源：\n\n" + text
+	a.info.toolRecords = append(a.info.toolRecords, openai.ToolCallRecord{
+		Name:       search.ToolName,
+		Arguments:  query,
+		Result:     text,
+		References: search.References(results),
+	})
+	return true
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"start-feishubot/services"
+	"start-feishubot/utils"
+)
+
+// sessionScope 本群的上下文划分方式，群里没有设置时使用全局配置 defaultScope
+func sessionScope(settings services.ChatSettings, defaultScope string) string {
+	if services.ValidSessionScope(settings.SessionScope) {
+		return settings.SessionScope
+	}
+	if services.ValidSessionScope(defaultScope) {
+		return defaultScope
+	}
+	return services.SessionScopeThread
+}
+
+// sessionEpochKey /new 计数对应的键，整群共用时为空字符串
+func sessionEpochKey(scope string, userId string) string {
+	if scope == services.SessionScopeUser {
+		return userId
+	}
+	return ""
+}
+
+// sessionIdFor 按划分方式得到消息所属的会话：
+// 按话题时为话题根消息ID（不在话题中则为消息本身），整群或按人共用时为持续的会话，/new 后换成新的
+func sessionIdFor(settings services.ChatSettings, defaultScope string,
+	chatId, userId, rootId, msgId string) string {
+	scope := sessionScope(settings, defaultScope)
+	epoch := settings.SessionEpochs[sessionEpochKey(scope, userId)]
+	switch scope {
+	case services.SessionScopeChat:
+		return fmt.Sprintf("chat:%s:%d", chatId, epoch)
+	case services.SessionScopeUser:
+		if userId != "" {
+			return fmt.Sprintf("user:%s:%s:%d", chatId, userId, epoch)
+		}
+	}
+	if rootId != "" {
+		return rootId
+	}
+	return msgId
+}
+
+// resolveSessionId 按本群的设置得到消息所属的会话
+func (m MessageHandler) resolveSessionId(chatId, userId, rootId, msgId string) string {
+	return sessionIdFor(services.GetChatSettings().Get(chatId), m.config.SessionScope,
+		chatId, userId, rootId, msgId)
+}
+
+// startNewSession /new 之后整群（按人划分时为本人）换用新的会话
+func startNewSession(settings *services.ChatSettings, scope string, userId string) {
+	if settings.SessionEpochs == nil {
+		settings.SessionEpochs = map[string]int{}
+	}
+	settings.SessionEpochs[sessionEpochKey(scope, userId)]++
+}
+
+// sessionScopeNames 上下文划分方式的说明
+var sessionScopeNames = map[string]string{
+	services.SessionScopeThread: "按话题（每个话题独立上下文）",
+	services.SessionScopeChat:   "整群共用（所有消息在同一个持续的话题中）",
+	services.SessionScopeUser:   "按人划分（每人各自一个持续的话题）",
+}
+
+// parseSessionScope 支持英文和中文写法
+func parseSessionScope(s string) (string, bool) {
+	switch strings.TrimSpace(s) {
+	case services.SessionScopeThread, "话题":
+		return services.SessionScopeThread, true
+	case services.SessionScopeChat, "整群":
+		return services.SessionScopeChat, true
+	case services.SessionScopeUser, "个人":
+		return services.SessionScopeUser, true
+	}
+	return "", false
+}
+
+type SessionScopeAction struct { /*上下文划分*/
+}
+
+// Execute /new 开启新话题；/session_scope 查看，/session_scope thread|chat|user 设置本群的上下文划分方式，只有群主可以设置
+func (*SessionScopeAction) Execute(a *ActionInfo) bool {
+	chatId := *a.info.chatId
+	if _, found := utils.EitherTrimEqual(a.info.qParsed, "/new", "新话题"); found {
+		scope := sessionScope(services.GetChatSettings().Get(chatId), a.handler.config.SessionScope)
+		if scope == services.SessionScopeThread {
+			replyMsg(*a.ctx, "🆕 当前按话题划分上下文，直接发送一条新消息（不在话题中回复）即可开启新话题", a.info.msgId)
+			return false
+		}
+		var userId string
+		if a.info.userId != nil {
+			userId = *a.info.userId
+		}
+		err := services.GetChatSettings().Update(chatId, func(settings *services.ChatSettings) {
+			startNewSession(settings, scope, userId)
+		})
+		if err != nil {
+			replyMsg(*a.ctx, fmt.Sprintf("🤖️：开启新话题失败～\n错误信息: %v", err), a.info.msgId)
+			return false
+		}
+		replyMsg(*a.ctx, "🆕 已开启新话题，之前的上下文不会再带入", a.info.msgId)
+		return false
+	}
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/session_scope", "上下文范围"); found {
+		scope := sessionScope(services.GetChatSettings().Get(chatId), a.handler.config.SessionScope)
+		replyMsg(*a.ctx, fmt.Sprintf("🧵 上下文范围：%s\n"+
+			"群主可回复 /session_scope thread、/session_scope chat 或 /session_scope user 切换，"+
+			"整群或按人共用时可回复 /new 开启新话题", sessionScopeNames[scope]), a.info.msgId)
+		return false
+	}
+	op, found := utils.EitherCutPrefix(a.info.qParsed, "/session_scope ", "上下文范围 ")
+	if !found {
+		return true
+	}
+	scope, ok := parseSessionScope(op)
+	if !ok {
+		replyMsg(*a.ctx, "🤖️：可选 thread（话题）、chat（整群）或 user（个人）", a.info.msgId)
+		return false
+	}
+	if !canManageChat(*a.ctx, a.info) {
+		replyMsg(*a.ctx, "🤖️：只有群主可以设置上下文范围～", a.info.msgId)
+		return false
+	}
+	err := services.GetChatSettings().Update(chatId, func(settings *services.ChatSettings) {
+		settings.SessionScope = scope
+	})
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：保存失败～\n错误信息: %v", err), a.info.msgId)
+		return false
+	}
+	replyMsg(*a.ctx, "🧵 上下文范围已设置为："+sessionScopeNames[scope], a.info.msgId)
+	return false
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"testing"
+
+	"start-feishubot/services"
+)
+
+func TestSessionIdFor(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     services.ChatSettings
+		defaultScope string
+		userId       string
+		rootId       string
+		want         string
+	}{
+		{"thread scope, top-level message", services.ChatSettings{}, "", "ou_1", "", "om_msg"},
+		{"thread scope, reply in thread", services.ChatSettings{}, "thread", "ou_1", "om_root", "om_root"},
+		{"chat default from config", services.ChatSettings{}, "chat", "ou_1", "om_root", "chat:oc_1:0"},
+		{"chat setting overrides config", services.ChatSettings{SessionScope: "chat"}, "thread", "ou_2", "", "chat:oc_1:0"},
+		{"user scope", services.ChatSettings{SessionScope: "user"}, "", "ou_1", "om_root", "user:oc_1:ou_1:0"},
+		{"user scope without sender falls back to thread", services.ChatSettings{SessionScope: "user"}, "", "", "om_root", "om_root"},
+		{"unknown scope falls back to thread", services.ChatSettings{SessionScope: "x"}, "y", "ou_1", "", "om_msg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sessionIdFor(tt.settings, tt.defaultScope, "oc_1", tt.userId, tt.rootId, "om_msg")
+			if got != tt.want {
+				t.Errorf("sessionIdFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// /new 之后换用新的会话；按人划分时只影响本人
+func TestStartNewSession(t *testing.T) {
+	chat := services.ChatSettings{SessionScope: services.SessionScopeChat}
+	startNewSession(&chat, services.SessionScopeChat, "ou_1")
+	if got := sessionIdFor(chat, "", "oc_1", "ou_2", "", "om_msg"); got != "chat:oc_1:1" {
+		t.Fatalf("chat scope after /new = %q", got)
+	}
+
+	user := services.ChatSettings{SessionScope: services.SessionScopeUser}
+	startNewSession(&user, services.SessionScopeUser, "ou_1")
+	startNewSession(&user, services.SessionScopeUser, "ou_1")
+	if got := sessionIdFor(user, "", "oc_1", "ou_1", "", "om_msg"); got != "user:oc_1:ou_1:2" {
+		t.Fatalf("user scope after /new = %q", got)
+	}
+	if got := sessionIdFor(user, "", "oc_1", "ou_2", "", "om_msg"); got != "user:oc_1:ou_2:0" {
+		t.Fatalf("other user's session changed: %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"start-feishubot/logger"
+	"start-feishubot/services"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+)
+
+// speakerName 群聊中提问人的显示名称，单聊不需要区分
+func speakerName(ctx context.Context, info *MsgInfo) string {
+	if info.handlerType != GroupHandler || info.userId == nil {
+		return ""
+	}
+	return userName(ctx, *info.userId)
+}
+
+// recordThreadMessage 群里开启话题旁听后，把话题中没有@机器人的文字消息记入上下文，不回复。
+// 只记录机器人已经参与的话题，话题外的闲聊不会保存
+func (m MessageHandler) recordThreadMessage(ctx context.Context, info *MsgInfo) {
+	// 整群或按人共用会话时话题不单独成为上下文，不旁听
+	if info.sessionId == nil || info.msgId == nil || info.rootId == "" || *info.sessionId != info.rootId {
+		return
+	}
+	if info.qParsed == "" || (info.msgType != "text" && info.msgType != "post") {
+		return
+	}
+	if !services.GetChatSettings().Get(*info.chatId).ThreadContext {
+		return
+	}
+	unlock := m.sessionCache.LockSession(*info.sessionId)
+	defer unlock()
+	msg := m.sessionCache.GetMsg(*info.sessionId)
+	if len(msg) == 0 {
+		return
+	}
+	msg = append(msg, openai.Messages{
+		Role: "user", Content: info.qParsed, FeishuMsgId: *info.msgId,
+		Speaker: speakerName(ctx, info),
+	})
+	m.sessionCache.SetMsg(*info.sessionId, msg)
+	logger.Debugf("👂 已记录话题 %s 中的消息", *info.sessionId)
+}
+
+type ThreadContextAction struct { /*话题旁听*/
+}
+
+// Execute /thread_context on|off 开关本群的话题旁听，只有群主可以设置
+func (*ThreadContextAction) Execute(a *ActionInfo) bool {
+	if a.info.handlerType != GroupHandler {
+		return true
+	}
+	if _, found := utils.EitherTrimEqual(a.info.qParsed,
+		"/thread_context", "话题旁听"); found {
+		status := "关闭"
+		if services.GetChatSettings().Get(*a.info.chatId).ThreadContext {
+			status = "开启"
+		}
+		replyMsg(*a.ctx, fmt.Sprintf("👂 话题旁听：%s\n开启后，机器人参与的话题中没有@机器人的消息也会记入上下文。\n"+
+			"群主可回复 /thread_context on 或 /thread_context off 切换", status), a.info.msgId)
+		return false
+	}
+	op, found := utils.EitherCutPrefix(a.info.qParsed, "/thread_context ", "话题旁听 ")
+	if !found {
+		return true
+	}
+	var enabled bool
+	switch strings.TrimSpace(op) {
+	case "on", "开启":
+		enabled = true
+	case "off", "关闭":
+		enabled = false
+	default:
+		replyMsg(*a.ctx, "🤖️：可选 on 或 off", a.info.msgId)
+		return false
+	}
+	if !canManageChat(*a.ctx, a.info) {
+		replyMsg(*a.ctx, "🤖️：只有群主可以设置话题旁听～", a.info.msgId)
+		return false
+	}
+	err := services.GetChatSettings().Update(*a.info.chatId, func(settings *services.ChatSettings) {
+		settings.ThreadContext = enabled
+	})
+	if err != nil {
+		replyMsg(*a.ctx, fmt.Sprintf("🤖️：保存失败～\n错误信息: %v", err), a.info.msgId)
+		return false
+	}
+	if enabled {
+		replyMsg(*a.ctx, "👂 已开启话题旁听，话题中的其他消息也会作为上下文", a.info.msgId)
+	} else {
+		replyMsg(*a.ctx, "👂 已关闭话题旁听，只记录@机器人的消息", a.info.msgId)
+	}
+	return false
+}
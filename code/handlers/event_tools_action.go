@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"start-feishubot/services"
+	"start-feishubot/services/mcp"
+	"start-feishubot/services/openai"
+	"start-feishubot/services/search"
+	"start-feishubot/utils"
+)
+
+// toolSource 一个工具来源（MCP 服务、HTTP 插件或联网搜索）在某个群里的状态
+type toolSource struct {
+	name      string
+	toolCount int
+	enabled   bool
+}
+
+// chatToolSources 列出所有工具来源及其在群里的开关状态
+func chatToolSources(chatId string) []toolSource {
+	settings := services.GetChatSettings().Get(chatId)
+	var sources []toolSource
+	for _, server := range mcp.GetManager().Servers() {
+		sources = append(sources, toolSource{
+			name:      server.Name,
+			toolCount: server.ToolCount,
+			enabled:   settings.ToolEnabled(server.Name),
+		})
+	}
+	if webSearch != nil {
+		sources = append(sources, toolSource{
+			name:      search.ToolName,
+			toolCount: 1,
+			enabled:   settings.ToolEnabled(search.ToolName),
+		})
+	}
+	for _, name := range services.GetHttpPlugins().Names() {
+		sources = append(sources, toolSource{
+			name:      name,
+			toolCount: 1,
+			enabled:   settings.ToolEnabled(name),
+		})
+	}
+	return sources
+}
+
+// chatTools 当前群可用的工具，没有可用工具时返回 nil
+func chatTools(chatId string) openai.ToolExecutor {
+	settings := services.GetChatSettings().Get(chatId)
+	var executors openai.MultiToolExecutor
+	if e := mcp.GetManager().Executor(settings.ToolEnabled); e != nil {
+		executors = append(executors, e)
+	}
+	if webSearch != nil && settings.ToolEnabled(search.ToolName) {
+		executors = append(executors, webSearch)
+	}
+	if e := services.GetHttpPlugins().Executor(settings.ToolEnabled); e != nil {
+		executors = append(executors, e)
+	}
+	if len(executors) == 0 {
+		return nil
+	}
+	return executors
+}
+
+type ToolsAction struct { /*工具设置*/
+}
+
+func (*ToolsAction) Execute(a *ActionInfo) bool {
+	if _, foundTools := utils.EitherTrimEqual(a.info.qParsed,
+		"/tools", "工具"); foundTools {
+		sources := chatToolSources(*a.info.chatId)
+		if len(sources) == 0 {
+			replyMsg(*a.ctx, "🤖️：当前没有配置任何工具～", a.info.msgId)
+			return false
+		}
+		sendToolsCard(*a.ctx, a.info.msgId, *a.info.chatId, sources)
+		return false
+	}
+	return true
+}
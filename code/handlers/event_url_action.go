@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"start-feishubot/logger"
+	"start-feishubot/services/fetch"
+	"start-feishubot/services/openai"
+)
+
+const (
+	maxFetchURLs      = 3    // 每条消息最多抓取的链接数
+	maxURLContextRune = 6000 // 每个网页写入上下文的最大字数
+)
+
+var (
+	urlFetcher     *fetch.Fetcher
+	urlFetcherOnce sync.Once
+)
+
+func getURLFetcher(a *ActionInfo) *fetch.Fetcher {
+	urlFetcherOnce.Do(func() {
+		config := a.handler.config
+		urlFetcher, _ = fetch.NewFetcher(int64(config.UrlFetchMaxBytes),
+			time.Duration(config.UrlFetchTimeout)*time.Second, config.UrlFetchAllowList)
+	})
+	return urlFetcher
+}
+
+type URLFetchAction struct { /*链接内容抓取*/
+}
+
+// Execute 消息中带链接时先抓取网页正文，交给后面的消息处理作为上下文
+func (*URLFetchAction) Execute(a *ActionInfo) bool {
+	if !a.handler.config.UrlFetch || len(a.info.urls) == 0 {
+		return true
+	}
+	urls := a.info.urls
+	if len(urls) > maxFetchURLs {
+		urls = urls[:maxFetchURLs]
+	}
+	fetcher := getURLFetcher(a)
+	parts := make([]string, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			page, err := fetcher.Fetch(*a.ctx, u)
+			if err != nil {
+				logger.Warnf("抓取链接失败 %s: %v", u, err)
+				parts[i] = fmt.Sprintf("链接 %s 无法获取：%v", u, err)
+				return
+			}
+			parts[i] = formatPage(page)
+		}(i, u)
+	}
+	wg.Wait()
+	a.info.urlContext = "以下是用户消息中链接的网页内容，回答时可以参考：\n\n" +
+		strings.Join(parts, "\n\n---\n\n")
+	logger.Infof("🔗 已抓取 %d 个链接作为上下文", len(urls))
+	return true
+}
+
+func formatPage(page *fetch.Page) string {
+	text := page.Text
+	if runes := []rune(text); len(runes) > maxURLContextRune {
+		text = string(runes[:maxURLContextRune]) + "\n（内容过长，已截断）"
+	}
+	if page.Title != "" {
+		return fmt.Sprintf("链接：%s\n标题：%s\n\n%s", page.URL, page.Title, text)
+	}
+	return fmt.Sprintf("链接：%s\n\n%s", page.URL, text)
+}
+
+// withExtraContext 把搜索结果放在用户消息之前，随会话历史保存，之后追问时仍可引用来源
+func withExtraContext(msg []openai.Messages, info *MsgInfo) []openai.Messages {
+	if info.searchContext != "" {
+		msg = append(msg, openai.Messages{Role: "system", Content: info.searchContext})
+	}
+	return msg
+}
+
+// withURLContext 把抓取到的网页内容放在本次问题之前，只用于本次请求，不写入历史，
+// 避免大段网页正文在之后的每轮对话中重复占用上下文
+func withURLContext(msg []openai.Messages, info *MsgInfo) []openai.Messages {
+	return withContextBeforeQuestion(msg, info.urlContext)
+}
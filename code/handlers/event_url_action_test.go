@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+
+	"start-feishubot/services/openai"
+)
+
+// 网页内容放在本次问题之前，只进入请求，会话历史保持不变
+func TestURLContextIsRequestOnly(t *testing.T) {
+	history := []openai.Messages{
+		{Role: "system", Content: "prompt"},
+		{Role: "user", Content: "这篇文章说了什么 https://example.com"},
+	}
+	info := &MsgInfo{urlContext: "网页内容", searchContext: "搜索结果"}
+
+	saved := withExtraContext([]openai.Messages{history[0]}, info)
+	if len(saved) != 2 || saved[1].Content != "搜索结果" {
+		t.Fatalf("expected only search results in history, got %+v", saved)
+	}
+	req := requestMessages(history, info)
+	if len(req) != 3 || req[1].Role != "system" || req[1].Content != "网页内容" ||
+		req[2].Role != "user" {
+		t.Fatalf("expected page before the question, got %+v", req)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history changed: %+v", history)
+	}
+}
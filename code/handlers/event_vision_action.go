@@ -4,12 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"start-feishubot/initialization"
 	"start-feishubot/services"
 	"start-feishubot/services/openai"
 	"start-feishubot/utils"
-
-	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 type VisionAction struct { /*图片推理*/
@@ -57,7 +54,7 @@ func initializeVisionMode(a *ActionInfo) {
 
 func (va *VisionAction) handleVisionImage(a *ActionInfo) bool {
 	detail := a.handler.sessionCache.GetVisionDetail(*a.info.sessionId)
-	base64, err := downloadAndEncodeImage(a.info.imageKey, a.info.msgId)
+	base64, err := downloadAndEncodeImage(*a.ctx, a.info.imageKey, a.info.msgId)
 	if err != nil {
 		replyWithErrorMsg(*a.ctx, err, a.info.msgId)
 		return false
@@ -74,7 +71,7 @@ func (va *VisionAction) handleVisionPost(a *ActionInfo) bool {
 		if imageKey == "" {
 			continue
 		}
-		base64, err := downloadAndEncodeImage(imageKey, a.info.msgId)
+		base64, err := downloadAndEncodeImage(*a.ctx, imageKey, a.info.msgId)
 		if err != nil {
 			replyWithErrorMsg(*a.ctx, err, a.info.msgId)
 			return false
@@ -90,17 +87,13 @@ func (va *VisionAction) handleVisionPost(a *ActionInfo) bool {
 	return va.processMultipleImagesAndReply(a, base64s, detail)
 }
 
-func downloadAndEncodeImage(imageKey string, msgId *string) (string, error) {
+func downloadAndEncodeImage(ctx context.Context, imageKey string, msgId *string) (string, error) {
 	f := fmt.Sprintf("%s.png", imageKey)
 	defer os.Remove(f)
 
-	req := larkim.NewGetMessageResourceReqBuilder().MessageId(*msgId).FileKey(imageKey).Type("image").Build()
-	resp, err := initialization.GetLarkClient().Im.MessageResource.Get(context.Background(), req)
-	if err != nil {
+	if err := downloadResource(ctx, msgId, imageKey, "image", f); err != nil {
 		return "", err
 	}
-
-	resp.WriteFile(f)
 	return openai.GetBase64FromImage(f)
 }
 
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/logger"
+	"start-feishubot/platform"
+	"start-feishubot/services/openai"
+	"start-feishubot/utils"
+
+	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
+	larkdocx "github.com/larksuite/oapi-sdk-go/v3/service/docx/v1"
+	larkdrive "github.com/larksuite/oapi-sdk-go/v3/service/drive/v1"
+)
+
+const (
+	ExportFormatFile = "file" // Markdown 文件消息
+	ExportFormatDoc  = "doc"  // 飞书文档
+)
+
+var roleNames = map[string]string{
+	"system":    "⚙️ 系统提示",
+	"user":      "🙋 用户",
+	"assistant": "🤖 AI",
+}
+
+// exportTitle 用话题的第一个问题作为导出标题
+func exportTitle(msg []openai.Messages) string {
+	for _, m := range msg {
+		if m.Role == "user" {
+			return utils.Ellipsis(m.Content, 30)
+		}
+	}
+	return "话题导出"
+}
+
+// messageHeading 每条消息的小标题，保留角色、模型和时间
+func messageHeading(m openai.Messages) string {
+	name, ok := roleNames[m.Role]
+	if !ok {
+		name = m.Role
+	}
+	if m.Model != "" {
+		name += "（" + m.Model + "）"
+	}
+	if !m.CreatedAt.IsZero() {
+		name += " · " + m.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	return name
+}
+
+// exportSummary 导出时间和消息数
+func exportSummary(msg []openai.Messages) string {
+	return fmt.Sprintf("导出时间：%s，共 %d 条消息",
+		time.Now().Format("2006-01-02 15:04:05"), len(msg))
+}
+
+// renderMarkdown 把会话历史渲染成 Markdown，保留角色、模型和时间
+func renderMarkdown(title string, msg []openai.Messages) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "> %s\n\n", exportSummary(msg))
+	for _, m := range msg {
+		b.WriteString("## " + messageHeading(m) + "\n\n")
+		b.WriteString(strings.TrimSpace(m.Content))
+		if m.Truncated {
+			b.WriteString("\n\n*（回答未完整生成）*")
+		}
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+// 文档块类型，见云文档 docx 接口的 block_type
+const (
+	docBlockText     = 2
+	docBlockHeading2 = 4
+	docBlockHeading3 = 5
+	docBlockBullet   = 12
+	docBlockOrdered  = 13
+	docBlockCode     = 14
+	docBlockQuote    = 15
+)
+
+// docBlocksPerRequest 单次创建子块的数量上限
+const docBlocksPerRequest = 50
+
+var orderedItemRegex = regexp.MustCompile(`^\d+[.)]\s+`)
+
+// docTextBlock 只有一段纯文本的文档块
+func docTextBlock(blockType int, content string) *larkdocx.Block {
+	text := larkdocx.NewTextBuilder().
+		Elements([]*larkdocx.TextElement{larkdocx.NewTextElementBuilder().
+			TextRun(larkdocx.NewTextRunBuilder().Content(content).Build()).
+			Build()}).
+		Build()
+	block := &larkdocx.Block{BlockType: &blockType}
+	switch blockType {
+	case docBlockHeading2:
+		block.Heading2 = text
+	case docBlockHeading3:
+		block.Heading3 = text
+	case docBlockBullet:
+		block.Bullet = text
+	case docBlockOrdered:
+		block.Ordered = text
+	case docBlockCode:
+		block.Code = text
+	case docBlockQuote:
+		block.Quote = text
+	default:
+		block.Text = text
+	}
+	return block
+}
+
+// markdownBlocks 把回答中常见的 Markdown 结构（标题、列表、引用、代码块）转换成文档块，
+// 行内格式保留原文
+func markdownBlocks(content string) []*larkdocx.Block {
+	var blocks []*larkdocx.Block
+	var code []string
+	inCode := false
+	flushCode := func() {
+		if len(code) > 0 {
+			blocks = append(blocks, docTextBlock(docBlockCode, strings.Join(code, "\n")))
+		}
+		code = nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				flushCode()
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			blocks = append(blocks, docTextBlock(docBlockHeading3,
+				strings.TrimSpace(strings.TrimLeft(trimmed, "#"))))
+		case strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "):
+			blocks = append(blocks, docTextBlock(docBlockBullet, strings.TrimSpace(trimmed[2:])))
+		case orderedItemRegex.MatchString(trimmed):
+			blocks = append(blocks, docTextBlock(docBlockOrdered,
+				orderedItemRegex.ReplaceAllString(trimmed, "")))
+		case strings.HasPrefix(trimmed, ">"):
+			blocks = append(blocks, docTextBlock(docBlockQuote,
+				strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))))
+		default:
+			blocks = append(blocks, docTextBlock(docBlockText, trimmed))
+		}
+	}
+	flushCode()
+	return blocks
+}
+
+// sessionDocBlocks 导出文档的正文，每条消息一个小标题
+func sessionDocBlocks(msg []openai.Messages) []*larkdocx.Block {
+	blocks := []*larkdocx.Block{docTextBlock(docBlockQuote, exportSummary(msg))}
+	for _, m := range msg {
+		blocks = append(blocks, docTextBlock(docBlockHeading2, messageHeading(m)))
+		blocks = append(blocks, markdownBlocks(m.Content)...)
+		if m.Truncated {
+			blocks = append(blocks, docTextBlock(docBlockText, "（回答未完整生成）"))
+		}
+	}
+	return blocks
+}
+
+// createSessionDoc 通过云文档 docx 接口创建飞书文档并写入会话内容，返回文档链接。
+// 应用只有 tenant_access_token，无法直接写入用户的个人空间，文档创建在 EXPORT_FOLDER_TOKEN
+// 指定的文件夹（为空时为应用的云空间），再给导出的用户授予可管理权限
+func createSessionDoc(ctx context.Context, title string, msg []openai.Messages,
+	openId string) (string, error) {
+	client := initialization.GetLarkClient()
+
+	createResp, err := client.Docx.Document.Create(ctx,
+		larkdocx.NewCreateDocumentReqBuilder().
+			Body(larkdocx.NewCreateDocumentReqBodyBuilder().
+				FolderToken(initialization.GetConfig().ExportFolderToken).
+				Title(title).
+				Build()).
+			Build())
+	if err != nil {
+		return "", err
+	}
+	if !createResp.Success() {
+		return "", fmt.Errorf("创建文档失败: %s", createResp.Msg)
+	}
+	if createResp.Data == nil || createResp.Data.Document == nil || createResp.Data.Document.DocumentId == nil {
+		return "", errors.New("创建文档失败: 没有返回文档ID")
+	}
+	documentId := *createResp.Data.Document.DocumentId
+
+	// 文档的根块ID与文档ID相同，正文按顺序追加在根块下
+	blocks := sessionDocBlocks(msg)
+	for len(blocks) > 0 {
+		n := len(blocks)
+		if n > docBlocksPerRequest {
+			n = docBlocksPerRequest
+		}
+		childResp, err := client.Docx.DocumentBlockChildren.Create(ctx,
+			larkdocx.NewCreateDocumentBlockChildrenReqBuilder().
+				DocumentId(documentId).
+				BlockId(documentId).
+				DocumentRevisionId(-1).
+				Body(larkdocx.NewCreateDocumentBlockChildrenReqBodyBuilder().
+					Children(blocks[:n]).
+					Index(-1).
+					Build()).
+				Build())
+		if err != nil {
+			return "", err
+		}
+		if !childResp.Success() {
+			return "", fmt.Errorf("写入文档内容失败: %s", childResp.Msg)
+		}
+		blocks = blocks[n:]
+	}
+
+	if openId != "" {
+		permResp, err := client.Drive.PermissionMember.Create(ctx,
+			larkdrive.NewCreatePermissionMemberReqBuilder().
+				Token(documentId).
+				Type("docx").
+				NeedNotification(true).
+				BaseMember(larkdrive.NewBaseMemberBuilder().
+					MemberType("openid").
+					MemberId(openId).
+					Perm("full_access").
+					Build()).
+				Build())
+		if err != nil {
+			logger.Errorf("文档授权失败: %v", err)
+		} else if !permResp.Success() {
+			logger.Errorf("文档授权失败: %s", permResp.Msg)
+		}
+	}
+
+	metaResp, err := client.Drive.Meta.BatchQuery(ctx,
+		larkdrive.NewBatchQueryMetaReqBuilder().
+			MetaRequest(larkdrive.NewMetaRequestBuilder().
+				RequestDocs([]*larkdrive.RequestDoc{larkdrive.NewRequestDocBuilder().
+					DocToken(documentId).
+					DocType("docx").
+					Build()}).
+				WithUrl(true).
+				Build()).
+			Build())
+	if err != nil {
+		return "", err
+	}
+	if !metaResp.Success() {
+		return "", fmt.Errorf("获取文档链接失败: %s", metaResp.Msg)
+	}
+	if len(metaResp.Data.Metas) == 0 || metaResp.Data.Metas[0].Url == nil {
+		return "", errors.New("获取文档链接失败")
+	}
+	return *metaResp.Data.Metas[0].Url, nil
+}
+
+// exportSession 导出当前分支的会话历史，结果回复到 msgId 所在的话题
+func (m MessageHandler) exportSession(ctx context.Context, sessionId string,
+	msgId *string, openId string, format string) error {
+	msg := m.sessionCache.GetMsg(sessionId)
+	if len(msg) == 0 {
+		return errors.New("当前话题还没有对话记录")
+	}
+	title := exportTitle(msg)
+	if format == ExportFormatDoc {
+		if platform.FromContext(ctx).Name() != platform.NameFeishu {
+			return errors.New("当前平台不支持导出为飞书文档，请导出为 Markdown 文件")
+		}
+		url, err := createSessionDoc(ctx, title, msg, openId)
+		if err != nil {
+			return err
+		}
+		newCard, _ := newSendCard(
+			withHeader("📝 已导出为飞书文档", larkcard.TemplateGreen),
+			withMdAndExtraBtn("**"+title+"**",
+				newUrlBtn("打开文档", url)),
+			withNote("文档已共享给你，可在云文档中继续编辑。"))
+		return replyCard(ctx, msgId, newCard)
+	}
+
+	fileKey, err := uploadFile(ctx, title+".md", []byte(renderMarkdown(title, msg)))
+	if err != nil {
+		return err
+	}
+	return replyFile(ctx, fileKey, msgId)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	larkdocx "github.com/larksuite/oapi-sdk-go/v3/service/docx/v1"
+)
+
+func blockSummary(blocks []*larkdocx.Block) []string {
+	var got []string
+	for _, b := range blocks {
+		var text *larkdocx.Text
+		for _, t := range []*larkdocx.Text{b.Text, b.Heading2, b.Heading3, b.Bullet, b.Ordered, b.Code, b.Quote} {
+			if t != nil {
+				text = t
+			}
+		}
+		got = append(got, fmt.Sprintf("%02d %s", *b.BlockType, *text.Elements[0].TextRun.Content))
+	}
+	return got
+}
+
+func TestMarkdownBlocks(t *testing.T) {
+	content := "## 步骤\n\n1. 安装\n2) 运行\n- 注意\n> 引用\n```go\nfmt.Println(1)\n\nreturn\n```\n普通段落 **加粗**"
+	want := []string{
+		"05 步骤",
+		"13 安装",
+		"13 运行",
+		"12 注意",
+		"15 引用",
+		"14 fmt.Println(1)\n\nreturn",
+		"02 普通段落 **加粗**",
+	}
+	if got := blockSummary(markdownBlocks(content)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("markdownBlocks() = %q, want %q", got, want)
+	}
+	if got := markdownBlocks("```\n```\n\n"); len(got) != 0 {
+		t.Fatalf("expected empty code block to be dropped, got %d blocks", len(got))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"start-feishubot/initialization"
+	"start-feishubot/platform"
 	"start-feishubot/services"
 	"start-feishubot/services/openai"
 
@@ -69,23 +70,63 @@ func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2
 	rootId := event.Event.Message.RootId
 	chatId := event.Event.Message.ChatId
 	mention := event.Event.Message.Mentions
+	var userId *string
+	if sender := event.Event.Sender; sender != nil && sender.SenderId != nil {
+		userId = sender.SenderId.OpenId
+	}
 
-	sessionId := rootId
-	if sessionId == nil || *sessionId == "" {
-		sessionId = msgId
+	var root string
+	if rootId != nil {
+		root = *rootId
+	}
+	var sender string
+	if userId != nil {
+		sender = *userId
 	}
+	sessionId := m.resolveSessionId(*chatId, sender, root, *msgId)
 	msgInfo := MsgInfo{
 		handlerType: handlerType,
 		msgType:     msgType,
 		msgId:       msgId,
 		chatId:      chatId,
-		qParsed:     strings.Trim(parseContent(*content, msgType), " "),
+		qParsed:     strings.Trim(parseContent(*content, msgType, mentionNames(mention, m.bot())), " "),
 		fileKey:     parseFileKey(*content),
 		imageKey:    parseImageKey(*content),
 		imageKeys:   parsePostImageKeys(*content),
-		sessionId:   sessionId,
+		sessionId:   &sessionId,
+		rootId:      root,
+		userId:      userId,
 		mention:     mention,
 	}
+	m.runActions(ctx, msgInfo)
+	// 立即返回，确保飞书webhook在3秒内收到200 OK
+	return nil
+}
+
+// platformMsgReceivedHandler 处理其他平台适配器收到的消息，与飞书消息走同一条责任链
+func (m MessageHandler) platformMsgReceivedHandler(ctx context.Context, msg platform.Message) {
+	handlerType := HandlerType(UserHandler)
+	if msg.ChatType == "group" {
+		handlerType = GroupHandler
+	}
+	sessionId := m.resolveSessionId(msg.ChatId, msg.UserId, msg.RootId, msg.MsgId)
+	msgInfo := MsgInfo{
+		handlerType: handlerType,
+		msgType:     msg.MsgType,
+		msgId:       &msg.MsgId,
+		chatId:      &msg.ChatId,
+		qParsed:     strings.TrimSpace(msg.Text),
+		fileKey:     msg.FileKey,
+		imageKey:    msg.ImageKey,
+		sessionId:   &sessionId,
+		rootId:      msg.RootId,
+		userId:      &msg.UserId,
+	}
+	m.runActions(ctx, msgInfo)
+}
+
+func (m MessageHandler) runActions(ctx context.Context, msgInfo MsgInfo) {
+	msgInfo.urls = parseURLs(msgInfo.qParsed)
 	data := &ActionInfo{
 		ctx:     &ctx,
 		handler: &m,
@@ -99,11 +140,24 @@ func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2
 		&VisionAction{},          //图片推理处理
 		&PicAction{},             //图片处理
 		&AIModeAction{},          //模式切换处理
+		&ReasoningEffortAction{}, //推理强度处理
+		&ParamsAction{},          //生成参数处理
 		&ModelAction{},           //模型管理处理
+		&BranchAction{},          //会话分支处理
+		&ExportAction{},          //话题导出处理
+		&ToolsAction{},           //工具设置处理
+		&CustomRoleAction{},      //自定义角色处理
+		&DefaultPromptAction{},   //默认提示词处理
+		&MemoryAction{},          //长期记忆处理
+		&InstructionsAction{},    //自定义指令处理
+		&ThreadContextAction{},   //话题旁听处理
+		&SessionScopeAction{},    //上下文划分处理
 		&RoleListAction{},        //角色列表处理
 		&HelpAction{},            //帮助处理
 		&BalanceAction{},         //余额处理
 		&RolePlayAction{},        //角色扮演处理
+		&SearchAction{},          //联网搜索处理
+		&URLFetchAction{},        //链接内容抓取
 		&MessageAction{},         //消息处理
 		&EmptyAction{},           //空消息处理
 		&StreamMessageAction{},   //流式消息处理
@@ -119,9 +173,6 @@ func (m MessageHandler) msgReceivedHandler(ctx context.Context, event *larkim.P2
 		}()
 		chain(data, actions...)
 	}()
-	
-	// 立即返回，确保飞书webhook在3秒内收到200 OK
-	return nil
 }
 
 var _ MessageHandlerInterface = (*MessageHandler)(nil)
@@ -136,12 +187,14 @@ func NewMessageHandler(gpt *openai.ChatGPT,
 	}
 }
 
+// bot 启动时获取到的机器人 open_id，以及配置的 BOT_NAME
+func (m MessageHandler) bot() botIdentity {
+	return botIdentity{openId: initialization.GetBotInfo().OpenId, name: m.config.FeishuBotName}
+}
+
 func (m MessageHandler) judgeIfMentionMe(mention []*larkim.
 	MentionEvent) bool {
-	if len(mention) != 1 {
-		return false
-	}
-	return *mention[0].Name == m.config.FeishuBotName
+	return m.bot().mentionedIn(mention)
 }
 
 func AzureModeCheck(a *ActionInfo) bool {
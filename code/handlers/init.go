@@ -5,6 +5,7 @@ import (
 	"start-feishubot/logger"
 
 	"start-feishubot/initialization"
+	"start-feishubot/platform"
 	"start-feishubot/services/openai"
 
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
@@ -14,6 +15,7 @@ import (
 type MessageHandlerInterface interface {
 	msgReceivedHandler(ctx context.Context, event *larkim.P2MessageReceiveV1) error
 	cardHandler(ctx context.Context, cardAction *larkcard.CardAction) (interface{}, error)
+	platformMsgReceivedHandler(ctx context.Context, msg platform.Message)
 }
 
 type HandlerType string
@@ -28,12 +30,18 @@ var handlers MessageHandlerInterface
 
 func InitHandlers(gpt *openai.ChatGPT, config initialization.Config) {
 	handlers = NewMessageHandler(gpt, config)
+	initWebSearch(config)
 }
 
 func Handler(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
 	return handlers.msgReceivedHandler(ctx, event)
 }
 
+// PlatformHandler 飞书以外的平台收到消息后调用，ctx 中需带上消息来源的平台
+func PlatformHandler(ctx context.Context, msg platform.Message) {
+	handlers.platformMsgReceivedHandler(ctx, msg)
+}
+
 func ReadHandler(ctx context.Context, event *larkim.P2MessageReadV1) error {
 	readerId := event.Event.Reader.ReaderId.OpenId
 	//fmt.Printf("msg is read by : %v \n", *readerId)
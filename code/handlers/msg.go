@@ -1,21 +1,21 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
+	"start-feishubot/initialization"
 	"start-feishubot/logger"
 
-	"start-feishubot/initialization"
+	"start-feishubot/platform"
 	"start-feishubot/services"
 	"start-feishubot/services/openai"
+	"start-feishubot/utils"
 
-	"github.com/google/uuid"
 	larkcard "github.com/larksuite/oapi-sdk-go/v3/card"
-	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 )
 
 type CardKind string
@@ -36,6 +36,18 @@ var (
 	ModelSwitchKind      = CardKind("model_switch")     // 模型切换
 	AllModelsKind        = CardKind("all_models")       // 主流模型回答
 	MoreModelsKind       = CardKind("more_models")      // 查看更多模型
+	StopStreamKind       = CardKind("stop_stream")      // 停止流式生成
+	RegenerateKind       = CardKind("regenerate")       // 重新生成最后一轮回答
+	ContinueKind         = CardKind("continue")         // 继续生成被截断的回答
+	EditResendKind       = CardKind("edit_resend")      // 编辑之前的提问并重新发送
+	BranchSwitchKind     = CardKind("branch_switch")    // 切换会话分支
+	ExportKind           = CardKind("export")           // 导出话题内容
+	ToolToggleKind       = CardKind("tool_toggle")      // 开关群内可用的工具
+	ReasoningEffortKind  = CardKind("reasoning_effort") // 推理强度选择
+	ParamsKind           = CardKind("params")           // 生成参数设置
+	RoleExampleKind      = CardKind("role_example")     // 发送角色的示例问题
+	MemoryKind           = CardKind("memory")           // 管理长期记忆
+	InstructionsKind     = CardKind("instructions")     // 编辑自定义指令
 )
 
 var (
@@ -47,8 +59,10 @@ type CardMsg struct {
 	Kind      CardKind    `json:"kind"`
 	ChatType  CardChatType `json:"chatType"`
 	Value     interface{} `json:"value"`
-	SessionId string      `json:"sessionId"` // 使用json tag确保字段名一致
-	MsgId     string      `json:"msgId"`
+	SessionId string      `json:"sessionId"` // 会话缓存的键，整群或按人共用会话时不是消息ID
+	MsgId     string      `json:"msgId"`     // 原始消息ID，回复消息用；其它按钮回复卡片本身（OpenMessageID）
+	ChatId    string      `json:"chatId"` // 卡片回调里没有群ID，需要的按钮自己带上
+	UserId    string      `json:"userId"` // 只允许本人操作的按钮带上所属用户
 }
 
 type MenuOption struct {
@@ -60,28 +74,8 @@ func replyCard(ctx context.Context,
 	msgId *string,
 	cardContent string,
 ) error {
-	client := initialization.GetLarkClient()
-	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
-		MessageId(*msgId).
-		Body(larkim.NewReplyMessageReqBodyBuilder().
-			MsgType(larkim.MsgTypeInteractive).
-			Uuid(uuid.New().String()).
-			Content(cardContent).
-			Build()).
-		Build())
-
-	// 处理错误
-	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-
-	// 服务端错误处理
-	if !resp.Success() {
-		logger.Errorf("服务端错误 resp code[%v], msg [%v] requestId [%v] ", resp.Code, resp.Msg, resp.RequestId())
-		return errors.New(resp.Msg)
-	}
-	return nil
+	_, err := platform.FromContext(ctx).ReplyCard(ctx, *msgId, cardContent)
+	return err
 }
 
 func newSendCard(
@@ -106,8 +100,8 @@ func newSendCard(
 	return cardContent, err
 }
 
-// newStreamingCard 创建支持流式更新的卡片 (遵循飞书官方标准)
-func newStreamingCard(
+// newStreamingCard 创建支持流式更新的卡片 (遵循飞书官方标准)，末尾附带"停止生成"按钮
+func newStreamingCard(sessionId *string,
 	header *larkcard.MessageCardHeader,
 	elements ...larkcard.MessageCardElement) (string, error) {
 	
@@ -121,6 +115,7 @@ func newStreamingCard(
 		
 	var aElementPool []larkcard.MessageCardElement
 	aElementPool = append(aElementPool, elements...)
+	aElementPool = append(aElementPool, withStopStreamBtn(sessionId))
 	
 	// 使用官方SDK创建标准卡片结构
 	cardContent, err := larkcard.NewMessageCard().
@@ -287,6 +282,16 @@ func newBtn(content string, value map[string]interface{},
 	return btn
 }
 
+// newUrlBtn 点击后打开链接的按钮
+func newUrlBtn(content string, url string) *larkcard.MessageCardEmbedButton {
+	return larkcard.NewMessageCardEmbedButton().
+		Type(larkcard.MessageCardButtonTypePrimary).
+		Url(url).
+		Text(larkcard.NewMessageCardPlainText().
+			Content(content).
+			Build())
+}
+
 func newMenu(
 	placeHolder string,
 	value map[string]interface{},
@@ -413,7 +418,6 @@ func withPicResolutionBtn(sessionID *string) larkcard.
 			"value":     "0",
 			"kind":      PicResolutionKind,
 			"sessionId": *sessionID,
-			"msgId":     *sessionID,
 		},
 		// dall-e-2 256, 512, 1024
 		//MenuOption{
@@ -444,7 +448,6 @@ func withPicResolutionBtn(sessionID *string) larkcard.
 			"value":     "0",
 			"kind":      PicStyleKind,
 			"sessionId": *sessionID,
-			"msgId":     *sessionID,
 		},
 		MenuOption{
 			label: "生动风格",
@@ -470,7 +473,6 @@ func withVisionDetailLevelBtn(sessionID *string) larkcard.
 			"value":     "0",
 			"kind":      VisionStyleKind,
 			"sessionId": *sessionID,
-			"msgId":     *sessionID,
 		},
 		MenuOption{
 			label: "高",
@@ -489,7 +491,7 @@ func withVisionDetailLevelBtn(sessionID *string) larkcard.
 
 	return actions
 }
-func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
+func withRoleTagsBtn(sessionID *string, chatId string, tags ...string) larkcard.
 	MessageCardElement {
 	var menuOptions []MenuOption
 
@@ -504,7 +506,7 @@ func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
 			"value":     "0",
 			"kind":      RoleTagsChooseKind,
 			"sessionId": *sessionID,
-			"msgId":     *sessionID,
+			"chatId":    chatId,
 		},
 		menuOptions...,
 	)
@@ -516,7 +518,7 @@ func withRoleTagsBtn(sessionID *string, tags ...string) larkcard.
 	return actions
 }
 
-func withRoleBtn(sessionID *string, titles ...string) larkcard.
+func withRoleBtn(sessionID *string, chatId string, titles ...string) larkcard.
 	MessageCardElement {
 	var menuOptions []MenuOption
 
@@ -526,12 +528,12 @@ func withRoleBtn(sessionID *string, titles ...string) larkcard.
 			value: tag,
 		})
 	}
-	cancelMenu := newMenu("查看内置角色",
+	cancelMenu := newMenu("查看角色",
 		map[string]interface{}{
 			"value":     "0",
 			"kind":      RoleChooseKind,
 			"sessionId": *sessionID,
-			"msgId":     *sessionID,
+			"chatId":    chatId,
 		},
 		menuOptions...,
 	)
@@ -557,7 +559,6 @@ func withAIModeBtn(sessionID *string, aiModeStrs []string) larkcard.MessageCardE
 			"value":     "0",
 			"kind":      AIModeChooseKind,
 			"sessionId": *sessionID,
-			"msgId":     *sessionID,
 		},
 		menuOptions...,
 	)
@@ -628,107 +629,154 @@ func withModelSwitchButtons(sessionID *string) larkcard.MessageCardElement {
 	return actions
 }
 
-
-func replyMsg(ctx context.Context, msg string, msgId *string) error {
-	msg, i := processMessage(msg)
-	if i != nil {
-		return i
+// withAnswerActionBtns 回答卡片上的重新生成/编辑问题/继续生成按钮，只有回答被截断时才显示继续生成；
+// 重新请求时要用群里启用的工具，按钮带上群ID
+func withAnswerActionBtns(sessionID *string, chatId string, truncated bool) larkcard.MessageCardElement {
+	regenerateBtn := newBtn("🔁 重新生成", map[string]interface{}{
+		"name":      "regenerate_btn",
+		"value":     "1",
+		"kind":      RegenerateKind,
+		"chatType":  UserChatType,
+		"sessionId": *sessionID,
+		"chatId":    chatId,
+	}, larkcard.MessageCardButtonTypeDefault)
+	editBtn := newBtn("✏️ 编辑问题", map[string]interface{}{
+		"name":      "edit_resend_btn",
+		"value":     "1",
+		"kind":      EditResendKind,
+		"chatType":  UserChatType,
+		"sessionId": *sessionID,
+	}, larkcard.MessageCardButtonTypeDefault)
+	btns := []larkcard.MessageCardActionElement{regenerateBtn, editBtn}
+	if truncated {
+		continueBtn := newBtn("▶️ 继续生成", map[string]interface{}{
+			"name":      "continue_btn",
+			"value":     "1",
+			"kind":      ContinueKind,
+			"chatType":  UserChatType,
+			"sessionId": *sessionID,
+			"chatId":    chatId,
+		}, larkcard.MessageCardButtonTypePrimary)
+		btns = append(btns, continueBtn)
 	}
-	client := initialization.GetLarkClient()
-	content := larkim.NewTextMsgBuilder().
-		Text(msg).
+	return larkcard.NewMessageCardAction().
+		Actions(btns).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
 		Build()
+}
 
-	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
-		MessageId(*msgId).
-		Body(larkim.NewReplyMessageReqBodyBuilder().
-			MsgType(larkim.MsgTypeText).
-			Uuid(uuid.New().String()).
-			Content(content).
-			Build()).
-		Build())
+// answerNote 回答卡片脚注，被截断的回答给出提示，调用过工具时附上简要记录
+func answerNote(answer openai.Messages, note string) string {
+	if answer.Truncated {
+		note = "⚠️ 回答未完整生成，可点击「继续生成」接着写。" + note
+	}
+	if answer.StructuredError != "" {
+		note = "⚠️ 回答不符合角色要求的 JSON 格式：" + answer.StructuredError + "\n" + note
+	}
+	if len(answer.ToolRecords) > 0 {
+		note = toolCallsNote(answer.ToolRecords) + "\n" + note
+	}
+	if m := modelNote(answer); m != "" {
+		note = m + "\n" + note
+	}
+	return note
+}
 
-	// 处理错误
-	if err != nil {
-		fmt.Println(err)
-		return err
+// modelNote 说明实际回答的模型，自动选择或降级时一并说明原因
+func modelNote(answer openai.Messages) string {
+	if answer.Model == "" {
+		return ""
+	}
+	note := "🤖 回答模型：" + modelDisplayName(answer.Model)
+	if answer.FallbackFrom != "" {
+		note = fmt.Sprintf("🔀 %s 暂时不可用，本次由 %s 回答",
+			modelDisplayName(answer.FallbackFrom), modelDisplayName(answer.Model))
+	}
+	if answer.AutoRoute != "" {
+		note = answer.AutoRoute + "\n" + note
 	}
+	return note
+}
 
-	// 服务端错误处理
-	if !resp.Success() {
-		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
-		return errors.New(resp.Msg)
+// modelDisplayName 模型的显示名称，不在支持列表中的模型直接显示ID
+func modelDisplayName(modelID string) string {
+	if info, ok := openai.GetModelInfo(modelID); ok {
+		return info.Name
 	}
-	return nil
+	return modelID
+}
+
+// toolCallsNote 工具调用记录，每次调用一行
+func toolCallsNote(records []openai.ToolCallRecord) string {
+	lines := make([]string, len(records))
+	for i, r := range records {
+		lines[i] = "🔧 " + r.Summary()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withStopStreamBtn 流式卡片上的停止生成按钮
+func withStopStreamBtn(sessionID *string) larkcard.MessageCardElement {
+	return withOneBtn(newBtn("⏹ 停止生成", map[string]interface{}{
+		"name":      "stop_stream_btn",
+		"value":     "1",
+		"kind":      StopStreamKind,
+		"chatType":  UserChatType,
+		"sessionId": *sessionID,
+	}, larkcard.MessageCardButtonTypeDanger))
+}
+
+func replyMsg(ctx context.Context, msg string, msgId *string) error {
+	msg = strings.TrimSpace(msg)
+	return platform.FromContext(ctx).ReplyText(ctx, *msgId, msg)
 }
 
-func uploadImage(base64Str string) (*string, error) {
+func uploadImage(ctx context.Context, base64Str string) (*string, error) {
 	imageBytes, err := base64.StdEncoding.DecodeString(base64Str)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
 	}
-	client := initialization.GetLarkClient()
-	resp, err := client.Im.Image.Create(context.Background(),
-		larkim.NewCreateImageReqBuilder().
-			Body(larkim.NewCreateImageReqBodyBuilder().
-				ImageType(larkim.ImageTypeMessage).
-				Image(bytes.NewReader(imageBytes)).
-				Build()).
-			Build())
-
-	// 处理错误
+	imageKey, err := platform.FromContext(ctx).UploadImage(ctx, imageBytes)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
-
-	// 服务端错误处理
-	if !resp.Success() {
-		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
-		return nil, errors.New(resp.Msg)
-	}
-	return resp.Data.ImageKey, nil
+	return &imageKey, nil
 }
 
-func replyImage(ctx context.Context, ImageKey *string,
-	msgId *string) error {
-	//fmt.Println("sendMsg", ImageKey, msgId)
-
-	msgImage := larkim.MessageImage{ImageKey: *ImageKey}
-	content, err := msgImage.String()
+// uploadFile 上传文件用于发送文件消息
+func uploadFile(ctx context.Context, fileName string, data []byte) (*string, error) {
+	fileKey, err := platform.FromContext(ctx).UploadFile(ctx, fileName, data)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return nil, err
 	}
-	client := initialization.GetLarkClient()
+	return &fileKey, nil
+}
 
-	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
-		MessageId(*msgId).
-		Body(larkim.NewReplyMessageReqBodyBuilder().
-			MsgType(larkim.MsgTypeImage).
-			Uuid(uuid.New().String()).
-			Content(content).
-			Build()).
-		Build())
+func replyFile(ctx context.Context, fileKey *string,
+	msgId *string) error {
+	return platform.FromContext(ctx).ReplyFile(ctx, *msgId, *fileKey)
+}
 
-	// 处理错误
+// downloadResource 下载消息中的图片或文件并保存到 path
+func downloadResource(ctx context.Context, msgId *string, fileKey string,
+	resType string, path string) error {
+	data, err := platform.FromContext(ctx).DownloadResource(ctx, *msgId, fileKey, resType)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
+	return os.WriteFile(path, data, 0644)
+}
 
-	// 服务端错误处理
-	if !resp.Success() {
-		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
-		return errors.New(resp.Msg)
-	}
-	return nil
+func replyImage(ctx context.Context, ImageKey *string,
+	msgId *string) error {
+	//fmt.Println("sendMsg", ImageKey, msgId)
+	return platform.FromContext(ctx).ReplyImage(ctx, *msgId, *ImageKey)
 }
 
 func replayImageCardByBase64(ctx context.Context, base64Str string,
 	msgId *string, sessionId *string, question string) error {
-	imageKey, err := uploadImage(base64Str)
+	imageKey, err := uploadImage(ctx, base64Str)
 	if err != nil {
 		return err
 	}
@@ -744,7 +792,7 @@ func replayImageCardByBase64(ctx context.Context, base64Str string,
 
 func replayImagePlainByBase64(ctx context.Context, base64Str string,
 	msgId *string) error {
-	imageKey, err := uploadImage(base64Str)
+	imageKey, err := uploadImage(ctx, base64Str)
 	if err != nil {
 		return err
 	}
@@ -760,7 +808,7 @@ func replayImagePlainByBase64(ctx context.Context, base64Str string,
 
 func replayVariantImageByBase64(ctx context.Context, base64Str string,
 	msgId *string, sessionId *string) error {
-	imageKey, err := uploadImage(base64Str)
+	imageKey, err := uploadImage(ctx, base64Str)
 	if err != nil {
 		return err
 	}
@@ -776,38 +824,8 @@ func replayVariantImageByBase64(ctx context.Context, base64Str string,
 
 func sendMsg(ctx context.Context, msg string, chatId *string) error {
 	//fmt.Println("sendMsg", msg, chatId)
-	msg, i := processMessage(msg)
-	if i != nil {
-		return i
-	}
-	client := initialization.GetLarkClient()
-	content := larkim.NewTextMsgBuilder().
-		Text(msg).
-		Build()
-
-	//fmt.Println("content", content)
-
-	resp, err := client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
-		ReceiveIdType(larkim.ReceiveIdTypeChatId).
-		Body(larkim.NewCreateMessageReqBodyBuilder().
-			MsgType(larkim.MsgTypeText).
-			ReceiveId(*chatId).
-			Content(content).
-			Build()).
-		Build())
-
-	// 处理错误
-	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-
-	// 服务端错误处理
-	if !resp.Success() {
-		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
-		return errors.New(resp.Msg)
-	}
-	return nil
+	msg = strings.TrimSpace(msg)
+	return platform.FromContext(ctx).SendText(ctx, *chatId, msg)
 }
 
 func sendClearCacheCheckCard(ctx context.Context,
@@ -829,6 +847,48 @@ func sendSystemInstructionCard(ctx context.Context,
 	replyCard(ctx, msgId, newCard)
 }
 
+// maxRoleExamples 角色卡片上最多展示的示例按钮数
+const maxRoleExamples = 3
+
+func withRoleExampleBtns(sessionID *string, examples []string) larkcard.MessageCardElement {
+	var actions []larkcard.MessageCardActionElement
+	for i, example := range examples {
+		if i >= maxRoleExamples {
+			break
+		}
+		actions = append(actions, newBtn("💡 "+utils.Ellipsis(example, 16), map[string]interface{}{
+			"value":     example,
+			"kind":      RoleExampleKind,
+			"chatType":  UserChatType,
+			"sessionId": *sessionID,
+		}, larkcard.MessageCardButtonTypeDefault))
+	}
+	return larkcard.NewMessageCardAction().
+		Actions(actions).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+// sendRoleInstructionCard 进入角色扮演的卡片，附上角色切换的设置和示例问题按钮
+func sendRoleInstructionCard(ctx context.Context,
+	sessionId *string, msgId *string, role initialization.Role, settings []string) {
+	elements := []larkcard.MessageCardElement{withMainMd(role.Content)}
+	if len(settings) > 0 {
+		elements = append(elements, withMainMd("⚙️ "+strings.Join(settings, " · ")))
+	}
+	if examples := role.ExampleList(); len(examples) > 0 {
+		elements = append(elements, withSplitLine(), withMainMd("**试试这些问题**"),
+			withRoleExampleBtns(sessionId, examples))
+	}
+	note := "请注意，这将开始一个全新的对话，您将无法利用之前话题的历史信息"
+	if role.Author != "" {
+		note += "\n角色作者：" + role.Author
+	}
+	elements = append(elements, withNote(note))
+	newCard, _ := newSendCard(withHeader("🥷  已进入角色扮演模式", larkcard.TemplateIndigo), elements...)
+	replyCard(ctx, msgId, newCard)
+}
+
 func sendPicCreateInstructionCard(ctx context.Context,
 	sessionId *string, msgId *string) {
 	newCard, _ := newSendCard(
@@ -867,23 +927,17 @@ func sendVisionModeCheckCard(ctx context.Context,
 }
 
 func sendNewTopicCard(ctx context.Context,
-	sessionId *string, msgId *string, content string) {
-	newCard, _ := newSendCard(
-		withHeader("🌟 已开启新的话题", larkcard.TemplateBlue),
-		withMainMd(content),
-		withModelSwitchButtons(sessionId),
-		withNote("提醒：点击按钮可切换模型回答，或继续对话保持话题连贯"))
-	replyCard(ctx, msgId, newCard)
+	sessionId *string, chatId *string, msgId *string, answer openai.Messages) (*string, error) {
+	newCard, _ := newAnswerCard(withHeader("🌟 已开启新的话题", larkcard.TemplateBlue),
+		answer, sessionId, *chatId, "提醒：点击按钮可切换模型回答，或继续对话保持话题连贯")
+	return replyCardWithBackId(ctx, msgId, newCard)
 }
 
 func sendOldTopicCard(ctx context.Context,
-	sessionId *string, msgId *string, content string) {
-	newCard, _ := newSendCard(
-		withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
-		withMainMd(content),
-		withModelSwitchButtons(sessionId),
-		withNote("提醒：点击按钮可切换模型回答，或继续对话保持话题连贯"))
-	replyCard(ctx, msgId, newCard)
+	sessionId *string, chatId *string, msgId *string, answer openai.Messages) (*string, error) {
+	newCard, _ := newAnswerCard(withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
+		answer, sessionId, *chatId, "提醒：点击按钮可切换模型回答，或继续对话保持话题连贯")
+	return replyCardWithBackId(ctx, msgId, newCard)
 }
 
 func sendVisionTopicCard(ctx context.Context,
@@ -917,17 +971,39 @@ func sendHelpCard(ctx context.Context,
 		withSplitLine(),
 		withMainMd("🥷 **角色扮演模式**\n文本回复*角色扮演* 或 */system*+空格+角色信息"),
 		withSplitLine(),
+		withMainMd("🧵 **上下文范围**\n"+" 文本回复 *上下文范围* 或 */session_scope*，群主可设置按话题、整群或按人共用上下文，回复 */new* 开启新话题"),
+		withSplitLine(),
+		withMainMd("👂 **话题旁听**\n"+" 群聊中回复 *话题旁听* 或 */thread_context*，开启后话题中没有@机器人的消息也会作为上下文"),
+		withSplitLine(),
+		withMainMd("📌 **自定义指令**\n"+" 文本回复 *自定义指令* 或 */instructions*，设置在所有对话中生效的个人要求"),
+		withSplitLine(),
+		withMainMd("🧠 **长期记忆**\n"+" 文本回复 */remember*+空格+内容 让机器人记住你的信息，*记忆* 或 */memory* 查看和删除"),
+		withSplitLine(),
+		withMainMd("📝 **默认提示词**\n"+" 文本回复 *默认提示词* 或 */prompt* 查看，群主可用 */prompt set*+空格+模板 设置本群的默认提示词"),
+		withSplitLine(),
+		withMainMd("🎭 **自定义角色**\n"+" 文本回复 */role save*+空格+名称 保存当前角色，*/role share*+名称 分享到本群，*/role delete*+名称 删除"),
+		withSplitLine(),
 		withMainMd("🎤 **AI语音对话**\n私聊模式下直接发送语音"),
 		withSplitLine(),
 		withMainMd("🎨 **图片创作模式**\n回复*图片创作* 或 */picture*"),
 		withSplitLine(),
 		withMainMd("🕵️ **图片推理模式** \n"+" 文本回复 *图片推理* 或 */vision*"),
 		withSplitLine(),
+		withMainMd("🎛 **生成参数**\n"+" 文本回复 *生成参数* 或 */params*，设置 temperature、top_p、max_tokens、stop、seed"),
+		withSplitLine(),
+		withMainMd("💭 **推理强度**\n"+" 文本回复 *推理强度* 或 */reasoning*，调整推理模型的思考程度"),
+		withSplitLine(),
 		withMainMd("🎰 **Token余额查询**\n回复*余额* 或 */balance*"),
 		withSplitLine(),
 		withMainMd("🔃️ **历史话题回档** 🚧\n"+" 进入话题的回复详情页,文本回复 *恢复* 或 */reload*"),
 		withSplitLine(),
-		withMainMd("📤 **话题内容导出** 🚧\n"+" 文本回复 *导出* 或 */export*"),
+		withMainMd("🌿 **话题分支**\n"+" 点击回答卡片上的 *编辑问题* 可修改提问并开辟新分支，文本回复 *分支列表* 或 */branches* 查看和切换分支"),
+		withSplitLine(),
+		withMainMd("📤 **话题内容导出**\n"+" 文本回复 *导出* 或 */export*，可导出为 Markdown 文件或飞书文档"),
+		withSplitLine(),
+		withMainMd("🔍 **联网搜索**\n"+" 文本回复 *搜索* 或 */search*+空格+关键词，回答会附上参考来源"),
+		withSplitLine(),
+		withMainMd("🧰 **工具设置**\n"+" 文本回复 *工具* 或 */tools*，查看和开关本群可用的外部工具"),
 		withSplitLine(),
 		withMainMd("🎰 **连续对话与多话题模式**\n"+" 点击对话框参与回复，可保持话题连贯。同时，单独提问即可开启全新新话题"),
 		withSplitLine(),
@@ -990,10 +1066,10 @@ func sendBalanceCard(ctx context.Context, msgId *string,
 }
 
 func SendRoleTagsCard(ctx context.Context,
-	sessionId *string, msgId *string, roleTags []string) {
+	sessionId *string, msgId *string, chatId string, roleTags []string) {
 	newCard, _ := newSendCard(
 		withHeader("🛖 请选择角色类别", larkcard.TemplateIndigo),
-		withRoleTagsBtn(sessionId, roleTags...),
+		withRoleTagsBtn(sessionId, chatId, roleTags...),
 		withNote("提醒：选择角色所属分类，以便我们为您推荐更多相关角色。"))
 	err := replyCard(ctx, msgId, newCard)
 	if err != nil {
@@ -1002,14 +1078,54 @@ func SendRoleTagsCard(ctx context.Context,
 }
 
 func SendRoleListCard(ctx context.Context,
-	sessionId *string, msgId *string, roleTag string, roleList []string) {
+	sessionId *string, msgId *string, chatId string, roleTag string, roleList []string) {
 	newCard, _ := newSendCard(
 		withHeader("🛖 角色列表"+" - "+roleTag, larkcard.TemplateIndigo),
-		withRoleBtn(sessionId, roleList...),
+		withRoleBtn(sessionId, chatId, roleList...),
 		withNote("提醒：选择内置场景，快速进入角色扮演模式。"))
 	replyCard(ctx, msgId, newCard)
 }
 
+// reasoningEffortLabels 推理强度的中文名，default 表示使用模型默认值
+var reasoningEffortLabels = map[string]string{
+	"default": "默认",
+	"low":     "低",
+	"medium":  "中",
+	"high":    "高",
+}
+
+func withReasoningEffortMenu(sessionID *string) larkcard.MessageCardElement {
+	menuOptions := []MenuOption{{value: "default", label: reasoningEffortLabels["default"]}}
+	for _, effort := range openai.ReasoningEfforts {
+		menuOptions = append(menuOptions, MenuOption{value: effort, label: reasoningEffortLabels[effort]})
+	}
+	menu := newMenu("选择推理强度",
+		map[string]interface{}{
+			"value":     "0",
+			"kind":      ReasoningEffortKind,
+			"sessionId": *sessionID,
+		},
+		menuOptions...,
+	)
+	return larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{menu}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+func sendReasoningEffortCard(ctx context.Context,
+	sessionId *string, msgId *string, current string) {
+	if current == "" {
+		current = "default"
+	}
+	newCard, _ := newSendCard(
+		withHeader("💭 推理强度", larkcard.TemplateIndigo),
+		withMainMd("当前推理强度："+reasoningEffortLabels[current]),
+		withReasoningEffortMenu(sessionId),
+		withNote("仅对支持推理的模型生效，强度越高思考越充分，但回答更慢、消耗更多 token。"))
+	replyCard(ctx, msgId, newCard)
+}
+
 func SendAIModeListsCard(ctx context.Context,
 	sessionId *string, msgId *string, aiModeStrs []string) {
 	newCard, _ := newSendCard(
@@ -1019,17 +1135,280 @@ func SendAIModeListsCard(ctx context.Context,
 	replyCard(ctx, msgId, newCard)
 }
 
+// withBranchMenu 会话分支选择菜单
+func withBranchMenu(sessionID *string, branches []services.Branch) larkcard.MessageCardElement {
+	var menuOptions []MenuOption
+	for i, branch := range branches {
+		label := fmt.Sprintf("分支%d：%s", i+1, utils.Ellipsis(branch.LastQuestion, 20))
+		if branch.Current {
+			label += "（当前）"
+		}
+		menuOptions = append(menuOptions, MenuOption{
+			label: label,
+			value: branch.LeafID,
+		})
+	}
+	branchMenu := newMenu("切换到分支",
+		map[string]interface{}{
+			"value":     "0",
+			"kind":      BranchSwitchKind,
+			"sessionId": *sessionID,
+		},
+		menuOptions...,
+	)
+	return larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{branchMenu}).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+func sendBranchListCard(ctx context.Context,
+	sessionId *string, msgId *string, branches []services.Branch) {
+	var lines []string
+	for i, branch := range branches {
+		line := fmt.Sprintf("**分支%d** · %d条消息 · %s", i+1, branch.Length,
+			utils.Ellipsis(branch.LastQuestion, 40))
+		if branch.Current {
+			line = "👉 " + line
+		}
+		lines = append(lines, line)
+	}
+	newCard, _ := newSendCard(
+		withHeader("🌿 话题分支", larkcard.TemplateTurquoise),
+		withMainMd(strings.Join(lines, "\n")),
+		withBranchMenu(sessionId, branches),
+		withNote("提醒：点击回答卡片上的「编辑问题」可以开辟新分支，切换分支后继续提问将沿着该分支对话。"))
+	replyCard(ctx, msgId, newCard)
+}
+
+// sendEditQuestionCard 编辑问题的引导卡片，附上原问题方便复制修改
+func sendEditQuestionCard(ctx context.Context, msgId *string, question string) {
+	newCard, _ := newSendCard(
+		withHeader("✏️ 编辑问题", larkcard.TemplateTurquoise),
+		withMainMd("已回到这个问题之前，请在话题中发送修改后的问题，将开辟一个新的分支：\n\n"+
+			"> "+strings.ReplaceAll(question, "\n", "\n> ")),
+		withNote("原来的对话会保留为另一个分支，可以通过 *分支列表* 或 */branches* 切换回去。"))
+	replyCard(ctx, msgId, newCard)
+}
+
+// withExportBtns 导出格式选择按钮
+func withExportBtns(sessionID *string) larkcard.MessageCardElement {
+	fileBtn := newBtn("📄 Markdown 文件", map[string]interface{}{
+		"name":      "export_file_btn",
+		"value":     ExportFormatFile,
+		"kind":      ExportKind,
+		"chatType":  UserChatType,
+		"sessionId": *sessionID,
+	}, larkcard.MessageCardButtonTypeDefault)
+	docBtn := newBtn("📝 飞书文档", map[string]interface{}{
+		"name":      "export_doc_btn",
+		"value":     ExportFormatDoc,
+		"kind":      ExportKind,
+		"chatType":  UserChatType,
+		"sessionId": *sessionID,
+	}, larkcard.MessageCardButtonTypePrimary)
+	return larkcard.NewMessageCardAction().
+		Actions([]larkcard.MessageCardActionElement{fileBtn, docBtn}).
+		Layout(larkcard.MessageCardActionLayoutBisected.Ptr()).
+		Build()
+}
+
+func sendExportCard(ctx context.Context,
+	sessionId *string, msgId *string, count int) {
+	newCard, _ := newSendCard(
+		withHeader("📤 导出话题", larkcard.TemplateBlue),
+		withMainMd(fmt.Sprintf("当前话题共 %d 条消息，请选择导出格式：", count)),
+		withExportBtns(sessionId),
+		withNote("导出内容包含角色、模型和时间，只导出当前分支。"))
+	replyCard(ctx, msgId, newCard)
+}
+
+// withToolToggleBtns 每个工具来源一个开关按钮
+func withToolToggleBtns(chatId string, sources []toolSource) larkcard.MessageCardElement {
+	var btns []larkcard.MessageCardActionElement
+	for _, source := range sources {
+		label := "✅ " + source.name
+		btnType := larkcard.MessageCardButtonTypePrimary
+		if !source.enabled {
+			label = "⛔ " + source.name
+			btnType = larkcard.MessageCardButtonTypeDefault
+		}
+		btns = append(btns, newBtn(label, map[string]interface{}{
+			"name":     "tool_toggle_btn",
+			"value":    source.name,
+			"kind":     ToolToggleKind,
+			"chatType": UserChatType,
+			"chatId":   chatId,
+		}, btnType))
+	}
+	return larkcard.NewMessageCardAction().
+		Actions(btns).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+func newToolsCard(chatId string, sources []toolSource) string {
+	var lines []string
+	for _, source := range sources {
+		status := "已启用"
+		if !source.enabled {
+			status = "已关闭"
+		}
+		lines = append(lines, fmt.Sprintf("- **%s**：%d 个工具，%s", source.name, source.toolCount, status))
+	}
+	newCard, _ := newSendCard(
+		withHeader("🧰 工具设置", larkcard.TemplateBlue),
+		withMainMd(strings.Join(lines, "\n")),
+		withToolToggleBtns(chatId, sources),
+		withNote("点击按钮开关对应的工具，设置对本群所有话题生效。"))
+	return newCard
+}
+
+func sendToolsCard(ctx context.Context, msgId *string, chatId string, sources []toolSource) {
+	replyCard(ctx, msgId, newToolsCard(chatId, sources))
+}
+
+// maxMemoryCardFacts 记忆卡片上最多列出的条数，更早的记忆只展示数量
+const maxMemoryCardFacts = 20
+
+func withMemoryBtns(userId string, memory services.UserMemory) larkcard.MessageCardElement {
+	value := func(op string) map[string]interface{} {
+		return map[string]interface{}{
+			"value":    op,
+			"kind":     MemoryKind,
+			"chatType": UserChatType,
+			"userId":   userId,
+		}
+	}
+	var btns []larkcard.MessageCardActionElement
+	facts := memory.Facts
+	if len(facts) > maxMemoryCardFacts {
+		facts = facts[len(facts)-maxMemoryCardFacts:]
+	}
+	for i, fact := range facts {
+		btns = append(btns, newBtn(fmt.Sprintf("🗑️ %d", i+1), value("delete:"+fact.ID),
+			larkcard.MessageCardButtonTypeDefault))
+	}
+	if memory.Enabled {
+		btns = append(btns, newBtn("关闭记忆", value("off"), larkcard.MessageCardButtonTypeDefault))
+	} else {
+		btns = append(btns, newBtn("开启记忆", value("on"), larkcard.MessageCardButtonTypePrimary))
+	}
+	if len(memory.Facts) > 0 {
+		btns = append(btns, newBtn("清空记忆", value("clear"), larkcard.MessageCardButtonTypeDanger))
+	}
+	return larkcard.NewMessageCardAction().
+		Actions(btns).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+// newMemoryCard 长期记忆卡片，列出记忆并提供删除、开关按钮
+func newMemoryCard(userId string, memory services.UserMemory) string {
+	status := "✅ 已开启，回答时会参考相关的记忆"
+	if !memory.Enabled {
+		status = "⛔ 未开启，回复 */memory on* 或 */remember*+空格+内容 开启"
+	}
+	lines := []string{status}
+	facts := memory.Facts
+	if skipped := len(facts) - maxMemoryCardFacts; skipped > 0 {
+		lines = append(lines, fmt.Sprintf("（另有 %d 条更早的记忆未列出）", skipped))
+		facts = facts[skipped:]
+	}
+	for i, fact := range facts {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, fact.Text))
+	}
+	if len(memory.Facts) == 0 {
+		lines = append(lines, "还没有任何记忆")
+	}
+	newCard, _ := newSendCard(
+		withHeader("🧠 长期记忆", larkcard.TemplateTurquoise),
+		withMainMd(strings.Join(lines, "\n")),
+		withMemoryBtns(userId, memory),
+		withNote("记忆只属于你本人，跨话题生效。点击 🗑️ 删除对应的记忆。"))
+	return newCard
+}
+
+func sendMemoryCard(ctx context.Context, msgId *string, userId string, memory services.UserMemory) {
+	replyCard(ctx, msgId, newMemoryCard(userId, memory))
+}
+
+// paramPresets 设置卡片上各参数的可选值，stop 和 seed 只能通过命令设置
+var paramPresets = []struct {
+	name    string
+	options []string
+}{
+	{"temperature", []string{"0", "0.3", "0.7", "1", "1.5"}},
+	{"top_p", []string{"1", "0.9", "0.5"}},
+	{"max_tokens", []string{"500", "1000", "2000", "4000", "8000"}},
+}
+
+func withParamsMenus(sessionID string) larkcard.MessageCardElement {
+	var actions []larkcard.MessageCardActionElement
+	for _, preset := range paramPresets {
+		menuOptions := []MenuOption{{value: "default", label: preset.name + " 默认"}}
+		for _, option := range preset.options {
+			menuOptions = append(menuOptions, MenuOption{value: option, label: preset.name + " " + option})
+		}
+		actions = append(actions, newMenu(preset.name,
+			map[string]interface{}{
+				"value":     preset.name,
+				"kind":      ParamsKind,
+				"sessionId": sessionID,
+			},
+			menuOptions...,
+		))
+	}
+	actions = append(actions, newBtn("恢复默认", map[string]interface{}{
+		"value":     "reset",
+		"kind":      ParamsKind,
+		"sessionId": sessionID,
+	}, larkcard.MessageCardButtonTypeDefault))
+	return larkcard.NewMessageCardAction().
+		Actions(actions).
+		Layout(larkcard.MessageCardActionLayoutFlow.Ptr()).
+		Build()
+}
+
+// newParamsCard 生成参数设置卡片，展示当前值和当前模型的参数上限
+func newParamsCard(sessionID string, params openai.GenParams, model string) string {
+	content := "```\n" + params.String() + "\n```"
+	if model != openai.AutoModel {
+		maxTemperature, maxOutputTokens := openai.ParamLimits(model)
+		limit := fmt.Sprintf("当前模型 %s：temperature ≤ %g", modelDisplayName(model), maxTemperature)
+		if maxOutputTokens > 0 {
+			limit += fmt.Sprintf("，max_tokens ≤ %d", maxOutputTokens)
+		}
+		content += "\n" + limit
+	}
+	if _, notes := params.Clamp(model); len(notes) > 0 {
+		content += "\n⚠️ " + strings.Join(notes, "；")
+	}
+	newCard, _ := newSendCard(
+		withHeader("🎛 生成参数", larkcard.TemplateIndigo),
+		withMainMd(content),
+		withParamsMenus(sessionID),
+		withNote("设置只对当前话题生效，超出模型上限的值按上限发送。"+
+			"stop 和 seed 请用命令设置，例如 /params stop=END seed=42"))
+	return newCard
+}
+
+func sendParamsCard(ctx context.Context, msgId *string, sessionID string,
+	params openai.GenParams, model string) {
+	replyCard(ctx, msgId, newParamsCard(sessionID, params, model))
+}
+
 func sendOnProcessCard(ctx context.Context,
 	sessionId *string, msgId *string, ifNewTopic bool) (*string,
 	error) {
 	var newCard string
 	// 使用流式卡片创建初始"正在处理"状态的卡片
 	if ifNewTopic {
-		newCard, _ = newStreamingCard(
+		newCard, _ = newStreamingCard(sessionId,
 			withHeader("🌟 已开启新的话题", larkcard.TemplateBlue),
 			withNote("正在思考，请稍等..."))
 	} else {
-		newCard, _ = newStreamingCard(
+		newCard, _ = newStreamingCard(sessionId,
 			withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
 			withNote("正在思考，请稍等..."))
 	}
@@ -1042,16 +1421,16 @@ func sendOnProcessCard(ctx context.Context,
 }
 
 func updateTextCard(ctx context.Context, msg string,
-	msgId *string, ifNewTopic bool) error {
+	msgId *string, sessionId *string, ifNewTopic bool) error {
 	var newCard string
 	// 使用流式卡片更新中间状态
 	if ifNewTopic {
-		newCard, _ = newStreamingCard(
+		newCard, _ = newStreamingCard(sessionId,
 			withHeader("🌟 已开启新的话题", larkcard.TemplateBlue),
 			withMainMd(msg),
 			withNote("正在生成，请稍等..."))
 	} else {
-		newCard, _ = newStreamingCard(
+		newCard, _ = newStreamingCard(sessionId,
 			withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue),
 			withMainMd(msg),
 			withNote("正在生成，请稍等..."))
@@ -1122,6 +1501,216 @@ func updateFinalCardWithSession(
 	return nil
 }
 
+// newAnswerCard 带重新生成/继续生成按钮的回答卡片，工具返回了参考来源时附在回答后面
+func newAnswerCard(header *larkcard.MessageCardHeader, answer openai.Messages,
+	sessionId *string, chatId string, note string) (string, error) {
+	var elements []larkcard.MessageCardElement
+	if answer.Reasoning != "" {
+		elements = append(elements, withReasoningPanel(answer.Reasoning))
+	}
+	elements = append(elements, withAnswerContent(answer))
+	if refs := openai.References(answer.ToolRecords); len(refs) > 0 {
+		elements = append(elements, withSplitLine(), withReferences(refs))
+	}
+	elements = append(elements,
+		withAnswerActionBtns(sessionId, chatId, answer.Truncated),
+		withModelSwitchButtons(sessionId),
+		withNote(answerNote(answer, note)))
+	return newSendCard(header, elements...)
+}
+
+// collapsiblePanel 折叠面板，SDK 中没有对应的组件，按卡片 JSON 结构直接输出
+type collapsiblePanel struct {
+	title   string
+	content string
+}
+
+func (p *collapsiblePanel) Tag() string {
+	return "collapsible_panel"
+}
+
+func (p *collapsiblePanel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"tag":      p.Tag(),
+		"expanded": false,
+		"header": map[string]interface{}{
+			"title": map[string]string{"tag": "markdown", "content": p.title},
+		},
+		"border": map[string]string{"color": "grey"},
+		"elements": []map[string]string{
+			{"tag": "markdown", "content": p.content},
+		},
+	})
+}
+
+// cardTable 飞书卡片的表格组件，larkcard 中没有对应的类型
+type cardTable struct {
+	columns []string
+	rows    [][]string
+}
+
+func (t *cardTable) Tag() string {
+	return "table"
+}
+
+func (t *cardTable) MarshalJSON() ([]byte, error) {
+	columns := make([]map[string]string, len(t.columns))
+	for i, c := range t.columns {
+		columns[i] = map[string]string{
+			"name": fmt.Sprintf("c%d", i), "display_name": c, "data_type": "text",
+		}
+	}
+	rows := make([]map[string]string, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = make(map[string]string, len(row))
+		for j, cell := range row {
+			rows[i][fmt.Sprintf("c%d", j)] = cell
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"tag":          t.Tag(),
+		"page_size":    10,
+		"row_height":   "low",
+		"header_style": map[string]interface{}{"bold": true, "background_style": "grey"},
+		"columns":      columns,
+		"rows":         rows,
+	})
+}
+
+// cardForm 飞书卡片的表单容器，提交按钮点击时一并回传表单中各输入框的值，larkcard 中没有对应的类型
+type cardForm struct {
+	name     string
+	elements []interface{}
+}
+
+func (f *cardForm) Tag() string {
+	return "form"
+}
+
+func (f *cardForm) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"tag":      f.Tag(),
+		"name":     f.name,
+		"elements": f.elements,
+	})
+}
+
+// instructionsInputName 自定义指令输入框在表单中的字段名
+const instructionsInputName = "instructions"
+
+func withInstructionsForm(userId string, instructions string) larkcard.MessageCardElement {
+	btnValue := func(op string) map[string]interface{} {
+		return map[string]interface{}{
+			"value":    op,
+			"kind":     InstructionsKind,
+			"chatType": UserChatType,
+			"userId":   userId,
+		}
+	}
+	return &cardForm{
+		name: "instructions_form",
+		elements: []interface{}{
+			map[string]interface{}{
+				"tag":           "input",
+				"name":          instructionsInputName,
+				"input_type":    "multiline_text",
+				"rows":          5,
+				"max_length":    services.MaxInstructionRunes,
+				"default_value": instructions,
+				"placeholder": map[string]string{
+					"tag": "plain_text", "content": "例如：用英文回答，尽量简洁，对比类内容用表格",
+				},
+			},
+			map[string]interface{}{
+				"tag":         "button",
+				"name":        "instructions_save",
+				"action_type": "form_submit",
+				"type":        larkcard.MessageCardButtonTypePrimary,
+				"text":        map[string]string{"tag": "plain_text", "content": "保存"},
+				"value":       btnValue("save"),
+			},
+			map[string]interface{}{
+				"tag":         "button",
+				"name":        "instructions_clear",
+				"action_type": "form_submit",
+				"type":        larkcard.MessageCardButtonTypeDanger,
+				"text":        map[string]string{"tag": "plain_text", "content": "清除"},
+				"value":       btnValue("clear"),
+			},
+		},
+	}
+}
+
+// newInstructionsCard 自定义指令编辑卡片
+func newInstructionsCard(userId string, instructions string, note string) string {
+	newCard, _ := newSendCard(
+		withHeader("📌 自定义指令", larkcard.TemplateBlue),
+		withMainMd("写下希望机器人一直遵守的要求，会在你的每次提问中生效，和角色、系统提示词一起使用。"),
+		withInstructionsForm(userId, instructions),
+		withNote(note))
+	return newCard
+}
+
+func sendInstructionsCard(ctx context.Context, msgId *string, userId string, instructions string) {
+	replyCard(ctx, msgId, newInstructionsCard(userId, instructions,
+		"只有你本人可以修改，也可以回复 /instructions set+空格+内容 直接设置。"))
+}
+
+// withAnswerContent 回答正文，结构化结果能整理成表格时用表格展示，否则展示格式化的 JSON
+func withAnswerContent(answer openai.Messages) larkcard.MessageCardElement {
+	if answer.Structured == nil {
+		return withMainMd(answer.Content)
+	}
+	columns, rows, ok := tabulate(answer.Structured, answer.Content)
+	if !ok {
+		return withMainMd("```json\n" + answer.Content + "\n```")
+	}
+	if len(rows) > maxTableRows {
+		rows = rows[:maxTableRows]
+	}
+	return &cardTable{columns: columns, rows: rows}
+}
+
+// withReasoningPanel 推理模型的思考过程，默认折叠
+func withReasoningPanel(reasoning string) larkcard.MessageCardElement {
+	return &collapsiblePanel{
+		title:   "💭 思考过程",
+		content: strings.TrimSpace(reasoning),
+	}
+}
+
+// withReferences 参考来源列表，编号与回答中的 [编号] 对应
+func withReferences(refs []openai.Reference) larkcard.MessageCardElement {
+	lines := []string{"**📚 参考来源**"}
+	for i, ref := range refs {
+		title := ref.Title
+		if title == "" {
+			title = ref.URL
+		}
+		lines = append(lines, fmt.Sprintf("[%d] [%s](%s)", i+1,
+			strings.NewReplacer("[", "", "]", "").Replace(utils.Ellipsis(title, 40)), ref.URL))
+	}
+	return withMainMd(strings.Join(lines, "\n"))
+}
+
+// updateAnswerCard 流式回答结束后，用完整回答和操作按钮更新卡片
+func updateAnswerCard(
+	ctx context.Context,
+	answer openai.Messages,
+	msgId *string,
+	sessionId *string,
+	chatId *string,
+	ifNewSession bool,
+) error {
+	header := withHeader("🔃️ 上下文的话题", larkcard.TemplateBlue)
+	if ifNewSession {
+		header = withHeader("🌟 已开启新的话题", larkcard.TemplateBlue)
+	}
+	newCard, _ := newAnswerCard(header, answer, sessionId, *chatId,
+		"已完成，点击按钮可切换模型回答，或继续提问保持话题连贯。")
+	return PatchCard(ctx, msgId, newCard)
+}
+
 func newSendCardWithOutHeader(
 	elements ...larkcard.MessageCardElement) (string, error) {
 	config := larkcard.NewMessageCardConfig().
@@ -1143,61 +1732,16 @@ func newSendCardWithOutHeader(
 
 func PatchCard(ctx context.Context, msgId *string,
 	cardContent string) error {
-	client := initialization.GetLarkClient()
-
-	// 按照飞书API规范执行PATCH更新
-	resp, err := client.Im.Message.Patch(ctx, larkim.NewPatchMessageReqBuilder().
-		MessageId(*msgId).
-		Body(larkim.NewPatchMessageReqBodyBuilder().
-			Content(cardContent).
-			Build()).
-		Build())
-
-	// 处理网络错误
-	if err != nil {
-		return fmt.Errorf("飞书API调用失败: %v", err)
-	}
-
-	// 处理飞书服务端错误，包括API限流
-	if !resp.Success() {
-		// 检查是否是API限流错误 (通常返回码为99991400)
-		if resp.Code == 99991400 {
-			return fmt.Errorf("飞书API限流，请降低更新频率: %s", resp.Msg)
-		}
-		return fmt.Errorf("飞书服务端错误 [%v]: %s (RequestId: %v)", 
-			resp.Code, resp.Msg, resp.RequestId())
-	}
-	return nil
+	return platform.FromContext(ctx).PatchCard(ctx, *msgId, cardContent)
 }
 
 func replyCardWithBackId(ctx context.Context,
 	msgId *string,
 	cardContent string,
 ) (*string, error) {
-	client := initialization.GetLarkClient()
-	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
-		MessageId(*msgId).
-		Body(larkim.NewReplyMessageReqBodyBuilder().
-			MsgType(larkim.MsgTypeInteractive).
-			Uuid(uuid.New().String()).
-			Content(cardContent).
-			Build()).
-		Build())
-
-	// 处理错误
+	cardId, err := platform.FromContext(ctx).ReplyCard(ctx, *msgId, cardContent)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
-
-	// 服务端错误处理
-	if !resp.Success() {
-		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
-		return nil, errors.New(resp.Msg)
-	}
-
-	//ctx = context.WithValue(ctx, "SendMsgId", *resp.Data.MessageId)
-	//SendMsgId := ctx.Value("SendMsgId")
-	//pp.Println(SendMsgId)
-	return resp.Data.MessageId, nil
+	return &cardId, nil
 }
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"start-feishubot/logger"
+	"start-feishubot/services/openai"
+)
+
+// maxTableRows 表格卡片最多展示的行数，完整结果可以用 JSON 文件查看
+const maxTableRows = 100
+
+// applyResponseSchema 角色要求结构化输出时，解析并校验回答，通过后把回答整理成格式化的 JSON
+func applyResponseSchema(answer *openai.Messages, schema *openai.ResponseSchema) {
+	answer.Structured, answer.StructuredError = nil, ""
+	if schema == nil || answer.Content == "" {
+		return
+	}
+	value, text, err := openai.ParseStructured(schema.Schema, answer.Content)
+	if err != nil {
+		answer.StructuredError = err.Error()
+		return
+	}
+	answer.Structured = value
+	// 用 json.Indent 格式化，保留模型输出的字段顺序
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(text), "", "  "); err == nil {
+		answer.Content = pretty.String()
+	}
+}
+
+// replyStructuredFile 角色声明 output: file 时，把结构化结果作为 JSON 文件发送
+func replyStructuredFile(ctx context.Context, msgId *string, answer openai.Messages,
+	schema *openai.ResponseSchema) {
+	if schema == nil || schema.Output != openai.OutputFile || answer.Structured == nil {
+		return
+	}
+	fileName := "result-" + time.Now().Format("20060102-150405") + ".json"
+	fileKey, err := uploadFile(ctx, fileName, []byte(answer.Content))
+	if err != nil {
+		logger.Errorf("上传结构化结果失败: %v", err)
+		return
+	}
+	if err := replyFile(ctx, fileKey, msgId); err != nil {
+		logger.Errorf("发送结构化结果失败: %v", err)
+	}
+}
+
+// tabulate 把结构化结果整理成表格：对象数组每个对象一行；
+// 只有一个数组字段的对象取该数组；其它对象按 字段/值 两列展示
+func tabulate(value interface{}, raw string) (columns []string, rows [][]string, ok bool) {
+	if obj, isObj := value.(map[string]interface{}); isObj {
+		var arrays []interface{}
+		for _, v := range obj {
+			if arr, isArr := v.([]interface{}); isArr {
+				arrays = append(arrays, arr)
+			}
+		}
+		if len(arrays) == 1 && len(obj) == 1 {
+			value = arrays[0]
+		} else {
+			keys := orderedKeys(obj, raw)
+			for _, k := range keys {
+				rows = append(rows, []string{k, cellText(obj[k])})
+			}
+			return []string{"字段", "值"}, rows, len(rows) > 0
+		}
+	}
+	items, isArr := value.([]interface{})
+	if !isArr || len(items) == 0 {
+		return nil, nil, false
+	}
+	union := make(map[string]interface{})
+	for _, item := range items {
+		obj, isObj := item.(map[string]interface{})
+		if !isObj {
+			// 简单值数组按一列展示
+			columns = []string{"值"}
+			for _, item := range items {
+				rows = append(rows, []string{cellText(item)})
+			}
+			return columns, rows, true
+		}
+		for k, v := range obj {
+			union[k] = v
+		}
+	}
+	columns = orderedKeys(union, raw)
+	for _, item := range items {
+		obj := item.(map[string]interface{})
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			if v, exists := obj[c]; exists {
+				row[i] = cellText(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, true
+}
+
+// orderedKeys 字段按在模型原始输出中出现的顺序排列，JSON 解析后 map 不保留顺序
+func orderedKeys(obj map[string]interface{}, raw string) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	pos := func(k string) int {
+		if i := strings.Index(raw, `"`+k+`"`); i >= 0 {
+			return i
+		}
+		return len(raw)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if pi, pj := pos(keys[i]), pos(keys[j]); pi != pj {
+			return pi < pj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func cellText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,68 @@
+package initialization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"start-feishubot/logger"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+)
+
+// BotInfo 机器人自身的信息，用于判断消息是否@了机器人
+type BotInfo struct {
+	OpenId  string `json:"open_id"`
+	AppName string `json:"app_name"`
+}
+
+var (
+	botMu   sync.RWMutex
+	botInfo BotInfo
+)
+
+// LoadBotInfo 启动时通过机器人信息接口获取机器人的 open_id，失败时退回按 BOT_NAME 匹配
+func LoadBotInfo() {
+	info, err := fetchBotInfo(context.Background())
+	if err != nil {
+		logger.Errorf("获取机器人信息失败，将按 BOT_NAME 判断是否@机器人: %v", err)
+		return
+	}
+	botMu.Lock()
+	botInfo = info
+	botMu.Unlock()
+	logger.Infof("🤖 机器人 %s 的 open_id: %s", info.AppName, info.OpenId)
+}
+
+// GetBotInfo 未获取到时 OpenId 为空
+func GetBotInfo() BotInfo {
+	botMu.RLock()
+	defer botMu.RUnlock()
+	return botInfo
+}
+
+func fetchBotInfo(ctx context.Context) (BotInfo, error) {
+	if larkClient == nil {
+		return BotInfo{}, fmt.Errorf("飞书客户端未初始化")
+	}
+	resp, err := larkClient.Get(ctx, "/open-apis/bot/v3/info", nil, larkcore.AccessTokenTypeTenant)
+	if err != nil {
+		return BotInfo{}, err
+	}
+	var result struct {
+		Code int     `json:"code"`
+		Msg  string  `json:"msg"`
+		Bot  BotInfo `json:"bot"`
+	}
+	if err := json.Unmarshal(resp.RawBody, &result); err != nil {
+		return BotInfo{}, err
+	}
+	if result.Code != 0 {
+		return BotInfo{}, fmt.Errorf("code %d: %s", result.Code, result.Msg)
+	}
+	if result.Bot.OpenId == "" {
+		return BotInfo{}, fmt.Errorf("返回结果中没有 open_id")
+	}
+	return result.Bot, nil
+}
@@ -31,6 +31,8 @@ type Config struct {
 	OpenaiModel                string
 	OpenAIHttpClientTimeOut    int
 	OpenaiMaxTokens            int
+	ModelFallbacks             []string // 模型降级链，每条形如 a>b>c，所选模型请求失败时依次尝试后面的模型
+	AutoRouterModel            string   // 自动选择模型时用于问题分类的低成本模型，为空时只按规则判断
 	HttpProxy                  string
 	AzureOn                    bool
 	AzureApiVersion            string
@@ -42,8 +44,49 @@ type Config struct {
 	UseOpenRouter              bool
 	OpenRouterSiteUrl          string
 	OpenRouterSiteName         string
+	// 话题导出为飞书文档时存放的文件夹，为空则放在应用的云空间根目录；应用没有用户授权，不能直接写入用户的个人空间
+	ExportFolderToken          string
+	// 企业微信自建应用配置，WecomCorpId 为空时不启用
+	WecomApiUrl                string
+	WecomCorpId                string
+	WecomAgentId               int
+	WecomSecret                string
+	WecomToken                 string
+	WecomEncodingAESKey        string
+	// OpenAI 兼容网关的团队配置文件，为空时不启用网关
+	GatewayConfigFile          string
+	// 网关用量日志文件，每次请求追加一行 JSON，为空时只打印日志
+	GatewayUsageLog            string
+	// MCP 服务配置文件，为空时不启用 MCP 工具
+	McpConfigFile              string
+	// HTTP 插件配置文件，为空时不启用插件工具
+	PluginConfigFile           string
+	// 自动抓取消息中的链接作为上下文，需显式开启
+	UrlFetch                   bool
+	UrlFetchMaxBytes           int
+	UrlFetchTimeout            int
+	// 允许抓取的内网地址或主机名，默认拒绝所有内网地址
+	UrlFetchAllowList          []string
+	// 联网搜索：searxng、bing 或 custom，为空时不启用
+	SearchProvider             string
+	SearchApiUrl               string
+	SearchApiKey               string
+	SearchMaxResults           int
+	// 群设置等需要持久化的数据存放目录
+	DataDir                    string
+	// 内置角色列表文件，修改后自动重新加载
+	RolesFile                  string
+	// 没有设置角色时的默认系统提示词，支持 {{date}} {{timezone}} {{user_name}} {{chat_name}}，群主可在群里覆盖
+	DefaultPrompt              string
+	// 提示词中日期和时区使用的时区，为空时使用服务器时区
+	Timezone                   string
+	// 默认的上下文划分方式：thread 按话题、chat 整群共用、user 群里每人一个，群主可在群里覆盖
+	SessionScope               string
 }
 
+// DefaultPrompt 未配置 DEFAULT_PROMPT 时使用的默认系统提示词
+const DefaultPrompt = "你是一个智能助手，请默认使用中文回答用户的问题，除非用户明确要求使用其他语言。请尽可能详细和准确地回答用户的问题。当前日期：{{date}}"
+
 var (
 	cfg    = pflag.StringP("config", "c", "./config.yaml", "apiserver config file path.")
 	config *Config
@@ -97,6 +140,32 @@ func LoadConfig(cfg string) *Config {
 		UseOpenRouter:              getViperBoolValue("USE_OPENROUTER", true),
 		OpenRouterSiteUrl:          getViperStringValue("OPENROUTER_SITE_URL", ""),
 		OpenRouterSiteName:         getViperStringValue("OPENROUTER_SITE_NAME", "Feishu OpenAI Bot"),
+		ExportFolderToken:          getViperStringValue("EXPORT_FOLDER_TOKEN", ""),
+		WecomApiUrl:                getViperStringValue("WECOM_API_URL", "https://qyapi.weixin.qq.com"),
+		WecomCorpId:                getViperStringValue("WECOM_CORP_ID", ""),
+		WecomAgentId:               getViperIntValue("WECOM_AGENT_ID", 0),
+		WecomSecret:                getViperStringValue("WECOM_SECRET", ""),
+		WecomToken:                 getViperStringValue("WECOM_TOKEN", ""),
+		WecomEncodingAESKey:        getViperStringValue("WECOM_ENCODING_AES_KEY", ""),
+		GatewayConfigFile:          getViperStringValue("GATEWAY_CONFIG", ""),
+		GatewayUsageLog:            getViperStringValue("GATEWAY_USAGE_LOG", ""),
+		McpConfigFile:              getViperStringValue("MCP_CONFIG", ""),
+		PluginConfigFile:           getViperStringValue("PLUGIN_CONFIG", ""),
+		UrlFetch:                   getViperBoolValue("URL_FETCH", false),
+		UrlFetchMaxBytes:           getViperIntValue("URL_FETCH_MAX_BYTES", 2*1024*1024),
+		UrlFetchTimeout:            getViperIntValue("URL_FETCH_TIMEOUT", 10),
+		UrlFetchAllowList:          getViperListValue("URL_FETCH_ALLOWLIST"),
+		SearchProvider:             getViperStringValue("SEARCH_PROVIDER", ""),
+		SearchApiUrl:               getViperStringValue("SEARCH_API_URL", ""),
+		SearchApiKey:               getViperStringValue("SEARCH_API_KEY", ""),
+		SearchMaxResults:           getViperIntValue("SEARCH_MAX_RESULTS", 5),
+		DataDir:                    getViperStringValue("DATA_DIR", "./data"),
+		RolesFile:                  getViperStringValue("ROLES_FILE", "role_list.yaml"),
+		DefaultPrompt:              getViperStringValue("DEFAULT_PROMPT", DefaultPrompt),
+		Timezone:                   getViperStringValue("TIMEZONE", ""),
+		SessionScope:               getViperStringValue("SESSION_SCOPE", "thread"),
+		ModelFallbacks:             getViperFallbacks("MODEL_FALLBACKS"),
+		AutoRouterModel:            getViperStringValue("AUTO_ROUTER_MODEL", ""),
 	}
 
 	return config
@@ -121,6 +190,32 @@ func getViperStringArray(key string, defaultValue []string) []string {
 	return filterFormatKey(raw)
 }
 
+// URL_FETCH_ALLOWLIST: 10.1.0.0/16,wiki.internal
+// result:[10.1.0.0/16 wiki.internal]
+func getViperListValue(key string) []string {
+	var result []string
+	for _, item := range strings.Split(viper.GetString(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// MODEL_FALLBACKS 可以写成逗号分隔的字符串，也可以写成 YAML 列表
+// result:[anthropic/claude-sonnet-4>openai/gpt-4o *>deepseek/deepseek-chat-v3-0324:free]
+func getViperFallbacks(key string) []string {
+	var result []string
+	for _, item := range viper.GetStringSlice(key) {
+		for _, chain := range strings.Split(item, ",") {
+			if chain = strings.TrimSpace(chain); chain != "" {
+				result = append(result, chain)
+			}
+		}
+	}
+	return result
+}
+
 func getViperIntValue(key string, defaultValue int) int {
 	value := viper.GetString(key)
 	if value == "" {
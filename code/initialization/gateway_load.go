@@ -0,0 +1,47 @@
+package initialization
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// GatewayTeam 网关的一个团队，凭 Token 调用，配额按自然日计算，0 表示不限
+type GatewayTeam struct {
+	Name          string   `yaml:"name"`
+	Token         string   `yaml:"token"`
+	DailyRequests int      `yaml:"daily_requests"`
+	DailyTokens   int      `yaml:"daily_tokens"`
+	Models        []string `yaml:"models"` // 允许使用的模型，为空表示不限
+}
+
+type GatewayConfig struct {
+	Teams []GatewayTeam `yaml:"teams"`
+	// ModelAlias 模型别名，例如 gpt-4o: openai/gpt-4o
+	ModelAlias map[string]string `yaml:"model_alias"`
+}
+
+// LoadGatewayConfig 加载网关团队配置
+func LoadGatewayConfig(path string) (*GatewayConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config GatewayConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]bool)
+	for i, team := range config.Teams {
+		if team.Name == "" || team.Token == "" {
+			return nil, fmt.Errorf("第 %d 个团队缺少 name 或 token", i+1)
+		}
+		if tokens[team.Token] {
+			return nil, errors.New("团队 " + team.Name + " 的 token 与其他团队重复")
+		}
+		tokens[team.Token] = true
+	}
+	return &config, nil
+}
@@ -0,0 +1,61 @@
+package initialization
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// McpServer 一个 MCP 服务：配置 command 时以子进程（stdio）方式启动，配置 url 时走 HTTP
+type McpServer struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// Timeout 单次工具调用的超时时间（秒），默认 60
+	Timeout int `yaml:"timeout"`
+}
+
+type McpConfig struct {
+	Servers []McpServer `yaml:"servers"`
+}
+
+// LoadMcpConfig 加载 MCP 服务配置，env 和 headers 中的 ${VAR} 会替换为环境变量
+func LoadMcpConfig(path string) (*McpConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config McpConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i := range config.Servers {
+		server := &config.Servers[i]
+		if server.Name == "" {
+			return nil, fmt.Errorf("第 %d 个 MCP 服务缺少 name", i+1)
+		}
+		if (server.Command == "") == (server.Url == "") {
+			return nil, fmt.Errorf("MCP 服务 %s 需要且只能配置 command 或 url 其中之一", server.Name)
+		}
+		if names[server.Name] {
+			return nil, fmt.Errorf("MCP 服务 %s 重复", server.Name)
+		}
+		names[server.Name] = true
+		for k, v := range server.Env {
+			server.Env[k] = os.ExpandEnv(v)
+		}
+		for k, v := range server.Headers {
+			server.Headers[k] = os.ExpandEnv(v)
+		}
+		if server.Timeout <= 0 {
+			server.Timeout = 60
+		}
+	}
+	return &config, nil
+}
@@ -0,0 +1,112 @@
+package initialization
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// HttpPlugin 一个以 HTTP 接口实现的工具
+type HttpPlugin struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Method      string `yaml:"method"`
+	// Endpoint 接口地址，路径中的 {参数名} 会替换为同名参数
+	Endpoint string `yaml:"endpoint"`
+	// Params 参数的 JSON Schema，原样提供给模型
+	Params  map[string]interface{} `yaml:"params"`
+	Headers map[string]string      `yaml:"headers"`
+	Auth    HttpPluginAuth         `yaml:"auth"`
+	// Timeout 请求超时时间（秒），默认 10
+	Timeout int `yaml:"timeout"`
+
+	// ParamsJSON 由 Params 转换得到的 JSON
+	ParamsJSON json.RawMessage `yaml:"-"`
+}
+
+// HttpPluginAuth 鉴权头，值从环境变量读取，避免把密钥写进配置文件
+type HttpPluginAuth struct {
+	Header string `yaml:"header"`
+	Env    string `yaml:"env"`
+	Prefix string `yaml:"prefix"`
+}
+
+type PluginConfig struct {
+	Plugins []HttpPlugin `yaml:"plugins"`
+}
+
+var pluginNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// LoadPluginConfig 加载 HTTP 插件配置
+func LoadPluginConfig(path string) (*PluginConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config PluginConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i := range config.Plugins {
+		plugin := &config.Plugins[i]
+		if !pluginNamePattern.MatchString(plugin.Name) {
+			return nil, fmt.Errorf("第 %d 个插件的 name 只能包含字母、数字、下划线和短横线", i+1)
+		}
+		if names[plugin.Name] {
+			return nil, fmt.Errorf("插件 %s 重复", plugin.Name)
+		}
+		names[plugin.Name] = true
+		if plugin.Endpoint == "" {
+			return nil, fmt.Errorf("插件 %s 缺少 endpoint", plugin.Name)
+		}
+		plugin.Method = strings.ToUpper(plugin.Method)
+		switch plugin.Method {
+		case "":
+			plugin.Method = http.MethodGet
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return nil, fmt.Errorf("插件 %s 的 method %s 不支持", plugin.Name, plugin.Method)
+		}
+		if plugin.Params == nil {
+			plugin.Params = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		plugin.ParamsJSON, err = json.Marshal(yamlToJSON(plugin.Params))
+		if err != nil {
+			return nil, fmt.Errorf("插件 %s 的 params 无法转换为 JSON Schema: %v", plugin.Name, err)
+		}
+		if plugin.Timeout <= 0 {
+			plugin.Timeout = 10
+		}
+	}
+	return &config, nil
+}
+
+// yamlToJSON yaml.v2 解析出的 map 键是 interface{}，转换后才能序列化为 JSON
+func yamlToJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = yamlToJSON(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = yamlToJSON(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = yamlToJSON(val)
+		}
+		return v
+	}
+	return v
+}
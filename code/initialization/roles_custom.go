@@ -0,0 +1,139 @@
+package initialization
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"start-feishubot/services/store"
+)
+
+// 自定义角色的分类，和内置角色的标签一起出现在角色列表中
+const (
+	PrivateRoleTag = "我的角色"
+	SharedRoleTag  = "群共享角色"
+)
+
+const maxRoleTitleLength = 30
+
+// RoleScope 查询角色时所在的用户和群，用于合并该用户的私有角色和该群的共享角色
+type RoleScope struct {
+	UserId string
+	ChatId string
+}
+
+var (
+	customRoleStore     *store.Store
+	customRoleStoreOnce sync.Once
+)
+
+// customRoles 自定义角色保存在 DATA_DIR/roles.json
+func customRoles() *store.Store {
+	customRoleStoreOnce.Do(func() {
+		path := filepath.Join(GetConfig().DataDir, "roles.json")
+		customRoleStore = store.OpenOrMemory(path, "自定义角色")
+	})
+	return customRoleStore
+}
+
+func privateRolePrefix(userId string) string { return "role:user:" + userId + ":" }
+func sharedRolePrefix(chatId string) string  { return "role:chat:" + chatId + ":" }
+
+// scopedRoles 用户的私有角色在前，群共享角色在后
+func scopedRoles(scopes []RoleScope) []Role {
+	var roles []Role
+	for _, scope := range scopes {
+		var prefixes []string
+		if scope.UserId != "" {
+			prefixes = append(prefixes, privateRolePrefix(scope.UserId))
+		}
+		if scope.ChatId != "" {
+			prefixes = append(prefixes, sharedRolePrefix(scope.ChatId))
+		}
+		for _, prefix := range prefixes {
+			for _, key := range customRoles().Keys(prefix) {
+				var role Role
+				if customRoles().Get(key, &role) {
+					roles = append(roles, role)
+				}
+			}
+		}
+	}
+	return roles
+}
+
+// errNoRoleOwner 无法识别发送者时不能保存私有角色，否则所有无身份的人会共用同一份角色
+var errNoRoleOwner = errors.New("无法识别发送者身份，不能管理自定义角色")
+
+func validRoleTitle(title string) error {
+	if title == "" {
+		return errors.New("角色名称不能为空")
+	}
+	if utf8.RuneCountInString(title) > maxRoleTitleLength {
+		return errors.New("角色名称不能超过 30 个字")
+	}
+	return nil
+}
+
+// SavePrivateRole 保存用户的私有角色，同名时覆盖
+func SavePrivateRole(userId string, title string, content string) error {
+	if userId == "" {
+		return errNoRoleOwner
+	}
+	title = strings.TrimSpace(title)
+	if err := validRoleTitle(title); err != nil {
+		return err
+	}
+	if strings.TrimSpace(content) == "" {
+		return errors.New("当前话题没有系统提示词，可以先用 /system 设置")
+	}
+	return customRoles().Set(privateRolePrefix(userId)+title, Role{
+		Title: title, Content: content, Tags: []string{PrivateRoleTag}, Owner: userId,
+	})
+}
+
+// ShareRole 把用户的私有角色分享到群，群内所有人都可以选择
+func ShareRole(userId string, chatId string, title string) error {
+	if userId == "" {
+		return errNoRoleOwner
+	}
+	var shared Role
+	return customRoles().Update(sharedRolePrefix(chatId)+title, &shared, func() error {
+		if shared.Owner != "" && shared.Owner != userId {
+			return errors.New("群里已有同名的共享角色")
+		}
+		var role Role
+		if !customRoles().Get(privateRolePrefix(userId)+title, &role) {
+			return errors.New("没有找到名为「" + title + "」的私有角色，请先用 /role save 保存")
+		}
+		role.Tags = []string{SharedRoleTag}
+		shared = role
+		return nil
+	})
+}
+
+// DeleteRole 删除用户的私有角色；没有私有角色时删除本人分享到群里的同名角色
+func DeleteRole(userId string, chatId string, title string) (shared bool, err error) {
+	if userId == "" {
+		return false, errNoRoleOwner
+	}
+	err = customRoles().Atomic(func() error {
+		var role Role
+		if customRoles().Get(privateRolePrefix(userId)+title, &role) {
+			return customRoles().Delete(privateRolePrefix(userId) + title)
+		}
+		shared = true
+		key := sharedRolePrefix(chatId) + title
+		if !customRoles().Get(key, &role) {
+			shared = false
+			return errors.New("没有找到名为「" + title + "」的自定义角色")
+		}
+		if role.Owner != userId {
+			return errors.New("只能删除自己分享的角色")
+		}
+		return customRoles().Delete(key)
+	})
+	return shared, err
+}
@@ -1,51 +1,184 @@
 package initialization
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"strings"
+	"sync"
+
+	"start-feishubot/logger"
 
 	"github.com/duke-git/lancet/v2/slice"
 	"github.com/duke-git/lancet/v2/validator"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 type Role struct {
 	Title   string   `yaml:"title"`
 	Content string   `yaml:"content"`
 	Tags    []string `yaml:"tags"`
+	// Example 示例问题，Examples 可以再提供多个，选择角色后展示为"试试这个"按钮
+	Example  string   `yaml:"example"`
+	Examples []string `yaml:"examples"`
+	Author   string   `yaml:"author"`
+	// 选择角色时一并切换的模型、发散模式（严谨、简洁、标准、发散）和最大输出长度，留空则不切换
+	Model     string `yaml:"model"`
+	AIMode    string `yaml:"ai_mode"`
+	MaxTokens int    `yaml:"max_tokens"`
+	// Schema 可选的 JSON Schema，声明后回答按结构化 JSON 输出并校验
+	Schema interface{} `yaml:"schema"`
+	// Output 结构化结果的展示方式：table 表格卡片（默认）或 file JSON 文件
+	Output string `yaml:"output"`
+	// SchemaJSON 由 Schema 转换得到的 JSON
+	SchemaJSON json.RawMessage `yaml:"-"`
+	// Owner 自定义角色创建者的 open_id，内置角色为空
+	Owner string `yaml:"-"`
 }
 
-var RoleList *[]Role
+var (
+	// roleMu 保护内置角色列表，重新加载时整体替换
+	roleMu   sync.RWMutex
+	roleList []Role
+)
 
-// InitRoleList 加载Prompt
-func InitRoleList() *[]Role {
-	data, err := ioutil.ReadFile("role_list.yaml")
+// InitRoleList 加载内置角色，文件有误时不退出，以空列表启动，修正后由 WatchRoleList 重新加载
+func InitRoleList(path string) []Role {
+	roles, err := LoadRoleList(path)
 	if err != nil {
-		log.Fatal(err)
+		logger.Errorf("❌ 加载角色列表失败，暂不提供内置角色:\n%v", err)
+		return nil
 	}
+	setRoleList(roles)
+	logger.Infof("🎭 已加载 %d 个内置角色", len(roles))
+	return roles
+}
+
+func setRoleList(roles []Role) {
+	roleMu.Lock()
+	defer roleMu.Unlock()
+	roleList = roles
+}
 
-	err = yaml.Unmarshal(data, &RoleList)
+// LoadRoleList 读取并校验角色列表，每个错误都带上文件名和行号
+func LoadRoleList(path string) ([]Role, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return RoleList
+	return parseRoleList(path, data)
 }
 
-func GetRoleList() *[]Role {
-	return RoleList
+func parseRoleList(path string, data []byte) ([]Role, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%s: 文件为空", path)
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s:%d: 角色列表应为数组", path, root.Line)
+	}
+	var roles []Role
+	var problems []string
+	titles := make(map[string]int)
+	for _, node := range root.Content {
+		var role Role
+		if err := node.Decode(&role); err != nil {
+			problems = append(problems, fmt.Sprintf("%s:%d: %v", path, node.Line, err))
+			continue
+		}
+		for _, p := range validateRole(&role, node, titles) {
+			problems = append(problems, fmt.Sprintf("%s:%d: %s", path, p.line, p.message))
+		}
+		roles = append(roles, role)
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return roles, nil
 }
-func GetAllUniqueTags() *[]string {
+
+type roleProblem struct {
+	line    int
+	message string
+}
+
+// validateRole 校验一个角色，并把 schema 转换为 JSON
+func validateRole(role *Role, node *yaml.Node, titles map[string]int) []roleProblem {
+	var problems []roleProblem
+	add := func(key string, format string, args ...interface{}) {
+		problems = append(problems, roleProblem{fieldLine(node, key), fmt.Sprintf(format, args...)})
+	}
+	role.Title = strings.TrimSpace(role.Title)
+	if role.Title == "" {
+		add("title", "角色缺少 title")
+	} else if line, ok := titles[role.Title]; ok {
+		add("title", "角色 %s 与第 %d 行的角色重名", role.Title, line)
+	} else {
+		titles[role.Title] = fieldLine(node, "title")
+	}
+	if strings.TrimSpace(role.Content) == "" {
+		add("content", "角色 %s 缺少 content", role.Title)
+	}
+	if len(role.Tags) == 0 {
+		add("tags", "角色 %s 至少需要一个 tag", role.Title)
+	}
+	if role.MaxTokens < 0 {
+		add("max_tokens", "角色 %s 的 max_tokens 不能为负数", role.Title)
+	}
+	if role.Output != "" && role.Output != "table" && role.Output != "file" {
+		add("output", "角色 %s 的 output 只能是 table 或 file", role.Title)
+	}
+	if role.Schema != nil {
+		schema, ok := yamlToJSON(role.Schema).(map[string]interface{})
+		if !ok || schema["type"] != "object" {
+			add("schema", "角色 %s 的 schema 根节点需为 type: object", role.Title)
+		} else if data, err := json.Marshal(schema); err != nil {
+			add("schema", "角色 %s 的 schema 无效: %v", role.Title, err)
+		} else {
+			role.SchemaJSON = data
+		}
+	}
+	return problems
+}
+
+// fieldLine 字段所在的行，字段不存在时返回角色开始的行
+func fieldLine(node *yaml.Node, key string) int {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i].Line
+			}
+		}
+	}
+	return node.Line
+}
+
+// GetRoleList 内置角色，传入 scope 时在前面合并该用户的私有角色和该群的共享角色
+func GetRoleList(scopes ...RoleScope) *[]Role {
+	roles := scopedRoles(scopes)
+	roleMu.RLock()
+	roles = append(roles, roleList...)
+	roleMu.RUnlock()
+	return &roles
+}
+
+func GetAllUniqueTags(scopes ...RoleScope) *[]string {
 	tags := make([]string, 0)
-	for _, role := range *RoleList {
+	for _, role := range *GetRoleList(scopes...) {
 		tags = append(tags, role.Tags...)
 	}
 	result := slice.Union(tags)
 	return &result
 }
 
-func GetRoleByTitle(title string) *Role {
-	for _, role := range *RoleList {
+// GetRoleByTitle 同名时私有角色优先，其次是群共享角色，最后是内置角色
+func GetRoleByTitle(title string, scopes ...RoleScope) *Role {
+	for _, role := range *GetRoleList(scopes...) {
 		if role.Title == title {
 			return &role
 		}
@@ -53,10 +186,9 @@ func GetRoleByTitle(title string) *Role {
 	return nil
 }
 
-func GetTitleListByTag(tags string) *[]string {
+func GetTitleListByTag(tags string, scopes ...RoleScope) *[]string {
 	roles := make([]string, 0)
-	//pp.Println(RoleList)
-	for _, role := range *RoleList {
+	for _, role := range *GetRoleList(scopes...) {
 		for _, roleTag := range role.Tags {
 			if roleTag == tags && !validator.IsEmptyString(role.
 				Title) {
@@ -67,11 +199,25 @@ func GetTitleListByTag(tags string) *[]string {
 	return &roles
 }
 
-func GetFirstRoleContentByTitle(title string) (string, error) {
-	for _, role := range *RoleList {
+func GetFirstRoleContentByTitle(title string, scopes ...RoleScope) (string, error) {
+	for _, role := range *GetRoleList(scopes...) {
 		if role.Title == title {
 			return role.Content, nil
 		}
 	}
 	return "", errors.New("role not found")
 }
+
+// ExampleList 角色的所有示例问题，去掉空值和重复
+func (r Role) ExampleList() []string {
+	var examples []string
+	seen := make(map[string]bool)
+	for _, e := range append([]string{r.Example}, r.Examples...) {
+		e = strings.TrimSpace(e)
+		if e != "" && !seen[e] {
+			seen[e] = true
+			examples = append(examples, e)
+		}
+	}
+	return examples
+}
@@ -0,0 +1,77 @@
+package initialization
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRoleList(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr []string
+	}{
+		{
+			name: "valid list",
+			data: "- title: a\n  content: ca\n  tags: [t]\n" +
+				"- title: b\n  content: cb\n  tags: [t]\n  schema:\n    type: object\n",
+			want: 2,
+		},
+		{
+			name:    "not a list",
+			data:    "title: a\n",
+			wantErr: []string{"roles.yaml:1: 角色列表应为数组"},
+		},
+		{
+			name:    "empty file",
+			data:    "",
+			wantErr: []string{"roles.yaml: 文件为空"},
+		},
+		{
+			name: "duplicate title points at both lines",
+			data: "- title: a\n  content: c\n  tags: [t]\n" +
+				"- title: a\n  content: c\n  tags: [t]\n",
+			wantErr: []string{"roles.yaml:4: 角色 a 与第 1 行的角色重名"},
+		},
+		{
+			name: "every problem with its own line",
+			data: "- title: a\n  tags: [t]\n" +
+				"- content: c\n  tags: [t]\n" +
+				"- title: c\n  content: c\n  tags: [t]\n  max_tokens: -1\n  output: pdf\n" +
+				"- title: d\n  content: c\n  tags: [t]\n  schema:\n    type: array\n",
+			wantErr: []string{
+				"roles.yaml:1: 角色 a 缺少 content",
+				"roles.yaml:3: 角色缺少 title",
+				"roles.yaml:8: 角色 c 的 max_tokens 不能为负数",
+				"roles.yaml:9: 角色 c 的 output 只能是 table 或 file",
+				"roles.yaml:13: 角色 d 的 schema 根节点需为 type: object",
+			},
+		},
+		{
+			name:    "missing tags",
+			data:    "- title: a\n  content: c\n",
+			wantErr: []string{"roles.yaml:1: 角色 a 至少需要一个 tag"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, err := parseRoleList("roles.yaml", []byte(tt.data))
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("parseRoleList() expected error, got %d roles", len(roles))
+				}
+				if got := strings.Split(err.Error(), "\n"); strings.Join(got, "|") != strings.Join(tt.wantErr, "|") {
+					t.Fatalf("parseRoleList() error = %q, want %q", got, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRoleList() unexpected error: %v", err)
+			}
+			if len(roles) != tt.want {
+				t.Fatalf("parseRoleList() got %d roles, want %d", len(roles), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package initialization
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"start-feishubot/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// roleReloadDelay 编辑器保存时往往连续触发多个事件，等文件稳定后再加载
+const roleReloadDelay = 300 * time.Millisecond
+
+// WatchRoleList 监听角色文件，修改后重新加载并整体替换内置角色；
+// 新内容有误时记录错误，继续使用上一次成功加载的列表
+func WatchRoleList(path string) (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// 监听所在目录，编辑器"写临时文件再改名"和挂载的配置卷替换文件时也能收到事件
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	last, _ := ioutil.ReadFile(path)
+	reload := make(chan struct{}, 1)
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// 目录中其它文件的变化不触发重新加载
+				if !roleFileNames(path)[filepath.Base(event.Name)] {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(roleReloadDelay, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			case <-reload:
+				data, err := ioutil.ReadFile(path)
+				if err != nil || bytes.Equal(data, last) {
+					continue
+				}
+				last = data
+				roles, err := parseRoleList(path, data)
+				if err != nil {
+					logger.Errorf("❌ 角色列表有误，继续使用上一次加载的角色:\n%v", err)
+					continue
+				}
+				setRoleList(roles)
+				logger.Infof("🎭 角色列表已重新加载，共 %d 个角色", len(roles))
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnf("监听角色列表出错: %v", err)
+			}
+		}
+	}()
+	return func() { watcher.Close() }, nil
+}
+
+// roleFileNames 目录中与角色文件有关的名字：文件本身，以及它是符号链接时链接目标在该目录下的第一级
+// （如 Kubernetes 配置卷替换文件时改名的 ..data）
+func roleFileNames(path string) map[string]bool {
+	names := map[string]bool{filepath.Base(path): true}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return names
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return names
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return names
+	}
+	names[strings.Split(rel, string(filepath.Separator))[0]] = true
+	return names
+}
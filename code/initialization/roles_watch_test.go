@@ -0,0 +1,82 @@
+package initialization
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func roleTitles() []string {
+	var titles []string
+	for _, role := range *GetRoleList() {
+		titles = append(titles, role.Title)
+	}
+	return titles
+}
+
+// waitRoleTitle 等待重新加载，超时返回 false
+func waitRoleTitle(title string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if titles := roleTitles(); len(titles) == 1 && titles[0] == title {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+// 新内容有误时保留上一次成功加载的列表，修正后重新加载
+func TestWatchRoleListKeepsLastGoodList(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "role_list.yaml")
+	write := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("- title: a\n  content: c\n  tags: [t]\n")
+	defer setRoleList(nil)
+	InitRoleList(path)
+	stop, err := WatchRoleList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	write("- title: b\n  content: c\n  tags: [t]\n- title: b\n  content: c\n  tags: [t]\n")
+	time.Sleep(4 * roleReloadDelay)
+	if titles := roleTitles(); len(titles) != 1 || titles[0] != "a" {
+		t.Fatalf("bad reload replaced the list: %v", titles)
+	}
+
+	write("- title: c\n  content: c\n  tags: [t]\n")
+	if !waitRoleTitle("c", 3*time.Second) {
+		t.Fatalf("fixed list was not reloaded: %v", roleTitles())
+	}
+}
+
+// 只关心角色文件本身，以及符号链接目标在同一目录下的第一级
+func TestRoleFileNames(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "..data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "..data", "role_list.yaml")
+	if err := ioutil.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "role_list.yaml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlink not supported:", err)
+	}
+	names := roleFileNames(link)
+	if len(names) != 2 || !names["role_list.yaml"] || !names["..data"] {
+		t.Fatalf("unexpected names %v", names)
+	}
+	if names := roleFileNames(filepath.Join(dir, "other.yaml")); len(names) != 1 || !names["other.yaml"] {
+		t.Fatalf("unexpected names %v", names)
+	}
+}
@@ -38,6 +38,14 @@ func Debugf(format string, args ...interface{}) {
 	}
 }
 
+// Infof logs a message at level Info on the standard logger.
+func Infof(format string, args ...interface{}) {
+	if logger.Level >= logrus.InfoLevel {
+		entry := logger.WithFields(logrus.Fields{})
+		entry.Infof(format, args...)
+	}
+}
+
 // Warnf logs a message at level Warn on the standard logger.
 func Warnf(format string, args ...interface{}) {
 	if logger.Level >= logrus.WarnLevel {
@@ -10,9 +10,13 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"start-feishubot/gateway"
 	"start-feishubot/handlers"
 	"start-feishubot/initialization"
 	"start-feishubot/logger"
+	"start-feishubot/platform"
+	"start-feishubot/services"
+	"start-feishubot/services/mcp"
 
 	"github.com/gin-gonic/gin"
 	sdkginext "github.com/larksuite/oapi-sdk-gin"
@@ -161,10 +165,16 @@ func createCardHandlerWithLogging() func(ctx context.Context, cardAction *larkca
 }
 
 func main() {
-	initialization.InitRoleList()
 	pflag.Parse()
 	config := initialization.GetConfig()
+	initialization.InitRoleList(config.RolesFile)
+	if stop, err := initialization.WatchRoleList(config.RolesFile); err != nil {
+		logger.Warnf("无法监听角色列表 %s，修改后需重启生效: %v", config.RolesFile, err)
+	} else {
+		defer stop()
+	}
 	initialization.LoadLarkClient(*config)
+	initialization.LoadBotInfo()
 	gpt := openai.NewChatGPT(*config)
 	handlers.InitHandlers(gpt, *config)
 
@@ -193,6 +203,46 @@ func main() {
 	r.POST("/webhook/card",
 		handleCardCallback(config, cardHandler))
 
+	// OpenAI 兼容网关，配置了 GATEWAY_CONFIG 才启用
+	if config.GatewayConfigFile != "" {
+		gatewayConfig, err := initialization.LoadGatewayConfig(config.GatewayConfigFile)
+		if err != nil {
+			logger.Fatalf("failed to load gateway config: %v", err)
+		}
+		gateway.NewGateway(gpt, gatewayConfig, config.GatewayUsageLog).Register(r)
+	}
+
+	// MCP 工具服务，配置了 MCP_CONFIG 才启用，连接失败的服务会被跳过
+	if config.McpConfigFile != "" {
+		mcpConfig, err := initialization.LoadMcpConfig(config.McpConfigFile)
+		if err != nil {
+			logger.Errorf("failed to load mcp config: %v", err)
+		} else {
+			defer mcp.Init(mcpConfig).Close()
+		}
+	}
+
+	// HTTP 插件，配置了 PLUGIN_CONFIG 才启用
+	if config.PluginConfigFile != "" {
+		pluginConfig, err := initialization.LoadPluginConfig(config.PluginConfigFile)
+		if err != nil {
+			logger.Errorf("failed to load plugin config: %v", err)
+		} else {
+			services.InitHttpPlugins(pluginConfig)
+			logger.Infof("🧩 已加载 %d 个 HTTP 插件", len(pluginConfig.Plugins))
+		}
+	}
+
+	// 企业微信自建应用，配置了 WECOM_CORP_ID 才启用
+	if config.WecomCorpId != "" {
+		wecom, err := platform.NewWeCom(*config)
+		if err != nil {
+			logger.Fatalf("failed to init wecom: %v", err)
+		}
+		r.GET("/webhook/wecom", wecom.Handler(handlers.PlatformHandler))
+		r.POST("/webhook/wecom", wecom.Handler(handlers.PlatformHandler))
+	}
+
 	if err := initialization.StartServer(*config, r); err != nil {
 		logger.Fatalf("failed to start server: %v", err)
 	}
@@ -0,0 +1,254 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"start-feishubot/initialization"
+	"start-feishubot/logger"
+
+	"github.com/google/uuid"
+	larkcontact "github.com/larksuite/oapi-sdk-go/v3/service/contact/v3"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// Feishu 飞书适配器，使用 initialization 中加载的飞书客户端
+type Feishu struct{}
+
+func (*Feishu) Name() string {
+	return NameFeishu
+}
+
+// textContent 文本消息内容，json 编码负责转义换行和引号
+func textContent(text string) (string, error) {
+	content, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (f *Feishu) reply(ctx context.Context, msgId string, msgType string,
+	content string) (string, error) {
+	client := initialization.GetLarkClient()
+	resp, err := client.Im.Message.Reply(ctx, larkim.NewReplyMessageReqBuilder().
+		MessageId(msgId).
+		Body(larkim.NewReplyMessageReqBodyBuilder().
+			MsgType(msgType).
+			Uuid(uuid.New().String()).
+			Content(content).
+			Build()).
+		Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		logger.Errorf("服务端错误 resp code[%v], msg [%v] requestId [%v] ", resp.Code, resp.Msg, resp.RequestId())
+		return "", errors.New(resp.Msg)
+	}
+	return *resp.Data.MessageId, nil
+}
+
+func (f *Feishu) ReplyText(ctx context.Context, msgId string, text string) error {
+	content, err := textContent(text)
+	if err != nil {
+		return err
+	}
+	_, err = f.reply(ctx, msgId, larkim.MsgTypeText, content)
+	return err
+}
+
+func (f *Feishu) SendText(ctx context.Context, chatId string, text string) error {
+	content, err := textContent(text)
+	if err != nil {
+		return err
+	}
+	client := initialization.GetLarkClient()
+	resp, err := client.Im.Message.Create(ctx, larkim.NewCreateMessageReqBuilder().
+		ReceiveIdType(larkim.ReceiveIdTypeChatId).
+		Body(larkim.NewCreateMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeText).
+			ReceiveId(chatId).
+			Content(content).
+			Build()).
+		Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return errors.New(resp.Msg)
+	}
+	return nil
+}
+
+func (f *Feishu) ReplyCard(ctx context.Context, msgId string, card string) (string, error) {
+	return f.reply(ctx, msgId, larkim.MsgTypeInteractive, card)
+}
+
+func (f *Feishu) PatchCard(ctx context.Context, cardId string, card string) error {
+	client := initialization.GetLarkClient()
+
+	// 按照飞书API规范执行PATCH更新
+	resp, err := client.Im.Message.Patch(ctx, larkim.NewPatchMessageReqBuilder().
+		MessageId(cardId).
+		Body(larkim.NewPatchMessageReqBodyBuilder().
+			Content(card).
+			Build()).
+		Build())
+
+	// 处理网络错误
+	if err != nil {
+		return fmt.Errorf("飞书API调用失败: %v", err)
+	}
+
+	// 处理飞书服务端错误，包括API限流
+	if !resp.Success() {
+		// 检查是否是API限流错误 (通常返回码为99991400)
+		if resp.Code == 99991400 {
+			return fmt.Errorf("飞书API限流，请降低更新频率: %s", resp.Msg)
+		}
+		return fmt.Errorf("飞书服务端错误 [%v]: %s (RequestId: %v)",
+			resp.Code, resp.Msg, resp.RequestId())
+	}
+	return nil
+}
+
+func (f *Feishu) DownloadResource(ctx context.Context, msgId string, fileKey string,
+	resType string) ([]byte, error) {
+	req := larkim.NewGetMessageResourceReqBuilder().MessageId(
+		msgId).FileKey(fileKey).Type(resType).Build()
+	resp, err := initialization.GetLarkClient().Im.MessageResource.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success() {
+		return nil, errors.New(resp.Msg)
+	}
+	return io.ReadAll(resp.File)
+}
+
+func (f *Feishu) UploadImage(ctx context.Context, data []byte) (string, error) {
+	client := initialization.GetLarkClient()
+	resp, err := client.Im.Image.Create(ctx,
+		larkim.NewCreateImageReqBuilder().
+			Body(larkim.NewCreateImageReqBodyBuilder().
+				ImageType(larkim.ImageTypeMessage).
+				Image(bytes.NewReader(data)).
+				Build()).
+			Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return "", errors.New(resp.Msg)
+	}
+	return *resp.Data.ImageKey, nil
+}
+
+func (f *Feishu) ReplyImage(ctx context.Context, msgId string, imageKey string) error {
+	msgImage := larkim.MessageImage{ImageKey: imageKey}
+	content, err := msgImage.String()
+	if err != nil {
+		return err
+	}
+	_, err = f.reply(ctx, msgId, larkim.MsgTypeImage, content)
+	return err
+}
+
+func (f *Feishu) UploadFile(ctx context.Context, fileName string, data []byte) (string, error) {
+	client := initialization.GetLarkClient()
+	resp, err := client.Im.File.Create(ctx,
+		larkim.NewCreateFileReqBuilder().
+			Body(larkim.NewCreateFileReqBodyBuilder().
+				FileType(larkim.FileTypeStream).
+				FileName(fileName).
+				File(bytes.NewReader(data)).
+				Build()).
+			Build())
+
+	// 处理错误
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+
+	// 服务端错误处理
+	if !resp.Success() {
+		fmt.Println(resp.Code, resp.Msg, resp.RequestId())
+		return "", errors.New(resp.Msg)
+	}
+	return *resp.Data.FileKey, nil
+}
+
+func (f *Feishu) ReplyFile(ctx context.Context, msgId string, fileKey string) error {
+	msgFile := larkim.MessageFile{FileKey: fileKey}
+	content, err := msgFile.String()
+	if err != nil {
+		return err
+	}
+	_, err = f.reply(ctx, msgId, larkim.MsgTypeFile, content)
+	return err
+}
+
+// ChatInfo 需要应用有获取群组信息的权限
+func (f *Feishu) ChatInfo(ctx context.Context, chatId string) (ChatInfo, error) {
+	resp, err := initialization.GetLarkClient().Im.Chat.Get(ctx, larkim.NewGetChatReqBuilder().
+		ChatId(chatId).
+		UserIdType(larkim.UserIdTypeOpenId).
+		Build())
+	if err != nil {
+		return ChatInfo{}, err
+	}
+	if !resp.Success() {
+		return ChatInfo{}, fmt.Errorf("获取群信息失败 [%v]: %s", resp.Code, resp.Msg)
+	}
+	var info ChatInfo
+	if resp.Data.Name != nil {
+		info.Name = *resp.Data.Name
+	}
+	if resp.Data.OwnerId != nil {
+		info.OwnerId = *resp.Data.OwnerId
+	}
+	return info, nil
+}
+
+// UserName 需要应用有获取通讯录用户基本信息的权限，userId 为 open_id
+func (f *Feishu) UserName(ctx context.Context, userId string) (string, error) {
+	resp, err := initialization.GetLarkClient().Contact.User.Get(ctx, larkcontact.NewGetUserReqBuilder().
+		UserId(userId).
+		UserIdType(larkcontact.UserIdTypeOpenId).
+		Build())
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success() {
+		return "", fmt.Errorf("获取用户信息失败 [%v]: %s", resp.Code, resp.Msg)
+	}
+	if resp.Data.User == nil || resp.Data.User.Name == nil {
+		return "", nil
+	}
+	return *resp.Data.User.Name, nil
+}
+
+var _ Platform = (*Feishu)(nil)
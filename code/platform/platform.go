@@ -0,0 +1,76 @@
+package platform
+
+import (
+	"context"
+)
+
+const (
+	NameFeishu = "feishu"
+	NameWeCom  = "wecom"
+)
+
+// Platform 即时通讯平台适配器。消息处理链只通过这组方法收发消息，
+// 卡片统一使用飞书消息卡片 JSON 描述，不支持卡片的平台自行降级展示
+type Platform interface {
+	Name() string
+	// ReplyText 回复一条文本消息
+	ReplyText(ctx context.Context, msgId string, text string) error
+	// SendText 向会话发送一条文本消息
+	SendText(ctx context.Context, chatId string, text string) error
+	// ReplyCard 回复一张卡片，返回卡片消息ID，用于之后更新卡片
+	ReplyCard(ctx context.Context, msgId string, card string) (string, error)
+	// PatchCard 更新已发送的卡片
+	PatchCard(ctx context.Context, cardId string, card string) error
+	// DownloadResource 下载消息中的图片、语音等资源，resType 为 image 或 file
+	DownloadResource(ctx context.Context, msgId string, fileKey string, resType string) ([]byte, error)
+	// UploadImage 上传图片，返回用于发送的图片key
+	UploadImage(ctx context.Context, data []byte) (string, error)
+	ReplyImage(ctx context.Context, msgId string, imageKey string) error
+	// UploadFile 上传文件，返回用于发送的文件key
+	UploadFile(ctx context.Context, fileName string, data []byte) (string, error)
+	ReplyFile(ctx context.Context, msgId string, fileKey string) error
+	// ChatInfo 查询群名称和群主，单聊时返回空信息
+	ChatInfo(ctx context.Context, chatId string) (ChatInfo, error)
+	// UserName 查询用户的显示名称
+	UserName(ctx context.Context, userId string) (string, error)
+}
+
+// ChatInfo 群的基本信息，OwnerId 为群主的用户ID，群主是机器人时为空
+type ChatInfo struct {
+	Name    string
+	OwnerId string
+}
+
+// Message 平台收到的一条消息，由适配器从各自的回调中解析得到
+type Message struct {
+	MsgId    string
+	ChatId   string
+	ChatType string // p2p 或 group
+	UserId   string
+	MsgType  string // text、image、audio
+	Text     string
+	ImageKey string
+	FileKey  string
+	// RootId 为话题ID，同一话题共享上下文；为空时以消息本身开启新话题
+	RootId string
+}
+
+type contextKey struct{}
+
+// Default 未指定平台时使用飞书
+var Default Platform = &Feishu{}
+
+// WithPlatform 把消息来源的平台放进 ctx，之后的回复都发往这个平台
+func WithPlatform(ctx context.Context, p Platform) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext 取出 ctx 中的平台，没有时返回飞书
+func FromContext(ctx context.Context) Platform {
+	if ctx != nil {
+		if p, ok := ctx.Value(contextKey{}).(Platform); ok {
+			return p
+		}
+	}
+	return Default
+}
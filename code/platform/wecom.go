@@ -0,0 +1,482 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
+)
+
+// wecomPatchDelay 企业微信的消息发出后不能修改，卡片更新只在最后一次更新后停顿这么久才发出，
+// 流式回答因此只会收到最终结果
+const wecomPatchDelay = 3 * time.Second
+
+// wecomMarkdownLimit 企业微信 markdown 消息内容上限为4096字节
+const wecomMarkdownLimit = 4000
+
+// WeCom 企业微信自建应用适配器。企业微信没有话题和可更新的卡片：
+// 同一个用户的消息共享一个会话，卡片降级为 markdown 消息，按钮不可用
+type WeCom struct {
+	apiUrl  string
+	corpId  string
+	agentId int
+	secret  string
+	crypt   *wecomCrypt
+	client  *http.Client
+
+	tokenMu     sync.Mutex
+	accessToken string
+	expireAt    time.Time
+
+	// targets 记录消息ID、卡片ID对应的用户，回复时发给这个用户
+	targets *cache.Cache
+
+	patchMu sync.Mutex
+	patches map[string]*wecomPatch
+}
+
+type wecomPatch struct {
+	timer *time.Timer
+	card  string
+}
+
+func NewWeCom(config initialization.Config) (*WeCom, error) {
+	crypt, err := newWecomCrypt(config.WecomToken, config.WecomEncodingAESKey, config.WecomCorpId)
+	if err != nil {
+		return nil, err
+	}
+	return &WeCom{
+		apiUrl:  strings.TrimSuffix(config.WecomApiUrl, "/"),
+		corpId:  config.WecomCorpId,
+		agentId: config.WecomAgentId,
+		secret:  config.WecomSecret,
+		crypt:   crypt,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		targets: cache.New(12*time.Hour, time.Hour),
+		patches: make(map[string]*wecomPatch),
+	}, nil
+}
+
+func (*WeCom) Name() string {
+	return NameWeCom
+}
+
+type wecomResp struct {
+	ErrCode     int    `json:"errcode"`
+	ErrMsg      string `json:"errmsg"`
+	AccessToken string `json:"access_token,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+	MediaId     string `json:"media_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+func (r *wecomResp) err() error {
+	if r.ErrCode != 0 {
+		return fmt.Errorf("企业微信接口错误 [%d]: %s", r.ErrCode, r.ErrMsg)
+	}
+	return nil
+}
+
+func (w *WeCom) token(ctx context.Context) (string, error) {
+	w.tokenMu.Lock()
+	defer w.tokenMu.Unlock()
+	if w.accessToken != "" && time.Now().Before(w.expireAt) {
+		return w.accessToken, nil
+	}
+	query := url.Values{"corpid": {w.corpId}, "corpsecret": {w.secret}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		w.apiUrl+"/cgi-bin/gettoken?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	var resp wecomResp
+	if err := w.do(req, &resp); err != nil {
+		return "", err
+	}
+	w.accessToken = resp.AccessToken
+	// 提前5分钟刷新
+	w.expireAt = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - 5*time.Minute)
+	return w.accessToken, nil
+}
+
+func (w *WeCom) do(req *http.Request, out *wecomResp) error {
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return err
+	}
+	return out.err()
+}
+
+// post 调用需要 access_token 的接口，body 为 JSON 或 multipart
+func (w *WeCom) post(ctx context.Context, path string, query url.Values,
+	contentType string, body []byte) (*wecomResp, error) {
+	token, err := w.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("access_token", token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		w.apiUrl+path+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	var resp wecomResp
+	return &resp, w.do(req, &resp)
+}
+
+func (w *WeCom) send(ctx context.Context, user string, msgType string,
+	content interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"touser":  user,
+		"msgtype": msgType,
+		"agentid": w.agentId,
+		msgType:   content,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.post(ctx, "/cgi-bin/message/send", nil, "application/json", body)
+	return err
+}
+
+func (w *WeCom) target(id string) (string, error) {
+	user, ok := w.targets.Get(id)
+	if !ok {
+		return "", fmt.Errorf("找不到消息 %s 的接收人", id)
+	}
+	return user.(string), nil
+}
+
+func (w *WeCom) ReplyText(ctx context.Context, msgId string, text string) error {
+	user, err := w.target(msgId)
+	if err != nil {
+		return err
+	}
+	return w.SendText(ctx, user, text)
+}
+
+// SendText 企业微信的会话ID就是用户ID
+func (w *WeCom) SendText(ctx context.Context, chatId string, text string) error {
+	return w.send(ctx, chatId, "text", map[string]string{"content": text})
+}
+
+func (w *WeCom) sendCard(ctx context.Context, user string, card string) error {
+	return w.send(ctx, user, "markdown", map[string]string{"content": cardToMarkdown(card)})
+}
+
+func (w *WeCom) ReplyCard(ctx context.Context, msgId string, card string) (string, error) {
+	user, err := w.target(msgId)
+	if err != nil {
+		return "", err
+	}
+	if err := w.sendCard(ctx, user, card); err != nil {
+		return "", err
+	}
+	cardId := "wecom_card_" + uuid.New().String()
+	w.targets.SetDefault(cardId, user)
+	return cardId, nil
+}
+
+func (w *WeCom) PatchCard(ctx context.Context, cardId string, card string) error {
+	user, err := w.target(cardId)
+	if err != nil {
+		return err
+	}
+	w.patchMu.Lock()
+	defer w.patchMu.Unlock()
+	if p, ok := w.patches[cardId]; ok && p.timer.Stop() {
+		p.card = card
+		p.timer.Reset(wecomPatchDelay)
+		return nil
+	}
+	p := &wecomPatch{card: card}
+	p.timer = time.AfterFunc(wecomPatchDelay, func() {
+		w.patchMu.Lock()
+		card := p.card
+		if w.patches[cardId] == p {
+			delete(w.patches, cardId)
+		}
+		w.patchMu.Unlock()
+		if err := w.sendCard(context.Background(), user, card); err != nil {
+			logger.Errorf("企业微信发送卡片失败: %v", err)
+		}
+	})
+	w.patches[cardId] = p
+	return nil
+}
+
+func (w *WeCom) DownloadResource(ctx context.Context, msgId string, fileKey string,
+	resType string) ([]byte, error) {
+	token, err := w.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"access_token": {token}, "media_id": {fileKey}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		w.apiUrl+"/cgi-bin/media/get?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// 出错时返回的是 JSON
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var errResp wecomResp
+		if err := json.Unmarshal(data, &errResp); err == nil && errResp.err() != nil {
+			return nil, errResp.err()
+		}
+	}
+	return data, nil
+}
+
+func (w *WeCom) upload(ctx context.Context, mediaType string, fileName string,
+	data []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("media", fileName)
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	resp, err := w.post(ctx, "/cgi-bin/media/upload", url.Values{"type": {mediaType}},
+		writer.FormDataContentType(), body.Bytes())
+	if err != nil {
+		return "", err
+	}
+	return resp.MediaId, nil
+}
+
+func (w *WeCom) UploadImage(ctx context.Context, data []byte) (string, error) {
+	return w.upload(ctx, "image", "image.png", data)
+}
+
+func (w *WeCom) ReplyImage(ctx context.Context, msgId string, imageKey string) error {
+	user, err := w.target(msgId)
+	if err != nil {
+		return err
+	}
+	return w.send(ctx, user, "image", map[string]string{"media_id": imageKey})
+}
+
+func (w *WeCom) UploadFile(ctx context.Context, fileName string, data []byte) (string, error) {
+	return w.upload(ctx, "file", fileName, data)
+}
+
+func (w *WeCom) ReplyFile(ctx context.Context, msgId string, fileKey string) error {
+	user, err := w.target(msgId)
+	if err != nil {
+		return err
+	}
+	return w.send(ctx, user, "file", map[string]string{"media_id": fileKey})
+}
+
+// ChatInfo 企业微信只有单聊，没有群信息
+func (w *WeCom) ChatInfo(ctx context.Context, chatId string) (ChatInfo, error) {
+	return ChatInfo{}, nil
+}
+
+func (w *WeCom) UserName(ctx context.Context, userId string) (string, error) {
+	token, err := w.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{"access_token": {token}, "userid": {userId}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		w.apiUrl+"/cgi-bin/user/get?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	var resp wecomResp
+	if err := w.do(req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Name, nil
+}
+
+type wecomEnvelope struct {
+	XMLName    xml.Name `xml:"xml"`
+	ToUserName string   `xml:"ToUserName"`
+	Encrypt    string   `xml:"Encrypt"`
+}
+
+type wecomMessage struct {
+	XMLName      xml.Name `xml:"xml"`
+	FromUserName string   `xml:"FromUserName"`
+	MsgType      string   `xml:"MsgType"`
+	Content      string   `xml:"Content"`
+	MediaId      string   `xml:"MediaId"`
+	MsgId        string   `xml:"MsgId"`
+}
+
+// parseMessage 把企业微信消息转换为通用消息，不支持的消息类型返回 false
+func (w *WeCom) parseMessage(raw []byte) (Message, bool) {
+	var m wecomMessage
+	if err := xml.Unmarshal(raw, &m); err != nil {
+		logger.Errorf("解析企业微信消息失败: %v", err)
+		return Message{}, false
+	}
+	if m.MsgId == "" || m.FromUserName == "" {
+		return Message{}, false
+	}
+	msg := Message{
+		MsgId:    m.MsgId,
+		ChatId:   m.FromUserName,
+		ChatType: "p2p",
+		UserId:   m.FromUserName,
+		// 没有话题，同一个用户的消息在同一个会话中，回复 /clear 开启新话题
+		RootId: "wecom_" + m.FromUserName,
+	}
+	switch m.MsgType {
+	case "text":
+		msg.MsgType = "text"
+		msg.Text = m.Content
+	case "image":
+		msg.MsgType = "image"
+		msg.ImageKey = m.MediaId
+	default:
+		return Message{}, false
+	}
+	return msg, true
+}
+
+// Handler 企业微信回调地址：GET 为URL验证，POST 为消息推送
+func (w *WeCom) Handler(onMessage func(ctx context.Context, msg Message)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		signature := c.Query("msg_signature")
+		timestamp := c.Query("timestamp")
+		nonce := c.Query("nonce")
+
+		if c.Request.Method == http.MethodGet {
+			echoStr := c.Query("echostr")
+			if !w.crypt.verify(signature, timestamp, nonce, echoStr) {
+				c.String(http.StatusUnauthorized, "invalid signature")
+				return
+			}
+			plain, err := w.crypt.decrypt(echoStr)
+			if err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			c.String(http.StatusOK, string(plain))
+			return
+		}
+
+		var envelope wecomEnvelope
+		if err := xml.NewDecoder(c.Request.Body).Decode(&envelope); err != nil {
+			c.String(http.StatusBadRequest, "invalid body")
+			return
+		}
+		if !w.crypt.verify(signature, timestamp, nonce, envelope.Encrypt) {
+			c.String(http.StatusUnauthorized, "invalid signature")
+			return
+		}
+		plain, err := w.crypt.decrypt(envelope.Encrypt)
+		if err != nil {
+			logger.Errorf("企业微信消息解密失败: %v", err)
+			c.String(http.StatusBadRequest, "decrypt failed")
+			return
+		}
+		if msg, ok := w.parseMessage(plain); ok {
+			w.targets.SetDefault(msg.MsgId, msg.UserId)
+			onMessage(WithPlatform(context.Background(), w), msg)
+		}
+		// 企业微信要求5秒内响应，消息处理在 onMessage 中异步进行
+		c.String(http.StatusOK, "")
+	}
+}
+
+type larkCardText struct {
+	Content string `json:"content"`
+}
+
+type larkCardElement struct {
+	Tag      string            `json:"tag"`
+	Text     *larkCardText     `json:"text,omitempty"`
+	Content  string            `json:"content,omitempty"`
+	Fields   []larkCardElement `json:"fields,omitempty"`
+	Elements []larkCardText    `json:"elements,omitempty"`
+}
+
+type larkCard struct {
+	Header *struct {
+		Title larkCardText `json:"title"`
+	} `json:"header,omitempty"`
+	Elements []larkCardElement `json:"elements"`
+}
+
+// cardToMarkdown 把飞书消息卡片降级为 markdown 文本，丢弃按钮、菜单和图片
+func cardToMarkdown(card string) string {
+	var c larkCard
+	if err := json.Unmarshal([]byte(card), &c); err != nil {
+		return card
+	}
+	var parts []string
+	if c.Header != nil && c.Header.Title.Content != "" {
+		parts = append(parts, "**"+c.Header.Title.Content+"**")
+	}
+	for _, e := range c.Elements {
+		switch e.Tag {
+		case "div":
+			if e.Text != nil && e.Text.Content != "" {
+				parts = append(parts, e.Text.Content)
+			}
+			for _, f := range e.Fields {
+				if f.Text != nil && f.Text.Content != "" {
+					parts = append(parts, f.Text.Content)
+				}
+			}
+		case "markdown":
+			parts = append(parts, e.Content)
+		case "hr":
+			parts = append(parts, "---")
+		case "note":
+			var notes []string
+			for _, n := range e.Elements {
+				notes = append(notes, n.Content)
+			}
+			if len(notes) > 0 {
+				parts = append(parts, "> "+strings.Join(notes, " "))
+			}
+		}
+	}
+	md := strings.Join(parts, "\n\n")
+	if len(md) > wecomMarkdownLimit {
+		md = strings.ToValidUTF8(md[:wecomMarkdownLimit], "") + "…"
+	}
+	return md
+}
+
+var _ Platform = (*WeCom)(nil)
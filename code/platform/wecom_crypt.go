@@ -0,0 +1,106 @@
+package platform
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 企业微信回调加解密，算法见企业微信开发文档「加解密方案说明」：
+// AES-256-CBC，密钥为 EncodingAESKey 补一个 = 后 base64 解码，IV 取密钥前16字节，
+// 明文为 16字节随机串 + 4字节网络序长度 + 消息 + ReceiveId
+
+type wecomCrypt struct {
+	token     string
+	key       []byte
+	receiveId string
+}
+
+func newWecomCrypt(token string, encodingAESKey string, receiveId string) (*wecomCrypt, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("EncodingAESKey 格式错误: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("EncodingAESKey 长度错误")
+	}
+	return &wecomCrypt{token: token, key: key, receiveId: receiveId}, nil
+}
+
+// signature 对 token、时间戳、随机串和密文字典序排序后做 sha1
+func (c *wecomCrypt) signature(timestamp, nonce, encrypt string) string {
+	strs := []string{c.token, timestamp, nonce, encrypt}
+	sort.Strings(strs)
+	sum := sha1.Sum([]byte(strings.Join(strs, "")))
+	return fmt.Sprintf("%x", sum)
+}
+
+func (c *wecomCrypt) verify(msgSignature, timestamp, nonce, encrypt string) bool {
+	return c.signature(timestamp, nonce, encrypt) == msgSignature
+}
+
+func (c *wecomCrypt) decrypt(encrypt string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("密文长度错误")
+	}
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, c.key[:aes.BlockSize]).CryptBlocks(plain, data)
+
+	// 企业微信按32字节块做 PKCS7 填充
+	padding := int(plain[len(plain)-1])
+	if padding < 1 || padding > 32 || padding > len(plain) {
+		return nil, errors.New("填充错误")
+	}
+	plain = plain[:len(plain)-padding]
+	if len(plain) < 20 {
+		return nil, errors.New("明文长度错误")
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if 20+msgLen > len(plain) {
+		return nil, errors.New("消息长度错误")
+	}
+	msg := plain[20 : 20+msgLen]
+	if string(plain[20+msgLen:]) != c.receiveId {
+		return nil, errors.New("ReceiveId 不匹配")
+	}
+	return msg, nil
+}
+
+func (c *wecomCrypt) encrypt(msg []byte) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	buf.Write(random)
+	binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+	buf.Write(msg)
+	buf.WriteString(c.receiveId)
+
+	padding := 32 - buf.Len()%32
+	buf.Write(bytes.Repeat([]byte{byte(padding)}, padding))
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return "", err
+	}
+	data := buf.Bytes()
+	cipher.NewCBCEncrypter(block, c.key[:aes.BlockSize]).CryptBlocks(data, data)
+	return base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,105 @@
+package platform
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+)
+
+// 企业微信文档中的示例 EncodingAESKey
+const testAESKey = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+
+func newTestWeCom(t *testing.T) *WeCom {
+	crypt, err := newWecomCrypt("token", testAESKey, "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WeCom{crypt: crypt, targets: cache.New(cache.NoExpiration, 0),
+		patches: make(map[string]*wecomPatch)}
+}
+
+func TestWecomCryptRoundTrip(t *testing.T) {
+	w := newTestWeCom(t)
+	encrypted, err := w.crypt.encrypt([]byte("<xml>你好</xml>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := w.crypt.decrypt(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "<xml>你好</xml>" {
+		t.Fatalf("got %q", plain)
+	}
+
+	other, _ := newWecomCrypt("token", testAESKey, "other_corp")
+	if _, err := other.decrypt(encrypted); err == nil {
+		t.Fatal("expected ReceiveId mismatch")
+	}
+}
+
+func TestWecomHandlerParsesTextMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := newTestWeCom(t)
+	encrypted, _ := w.crypt.encrypt([]byte(`<xml><ToUserName>corp</ToUserName>` +
+		`<FromUserName>zhangsan</FromUserName><MsgType>text</MsgType>` +
+		`<Content>/help</Content><MsgId>123</MsgId></xml>`))
+	query := url.Values{
+		"msg_signature": {w.crypt.signature("1", "n", encrypted)},
+		"timestamp":     {"1"},
+		"nonce":         {"n"},
+	}
+
+	var got Message
+	var gotPlatform Platform
+	r := gin.New()
+	r.POST("/webhook/wecom", w.Handler(func(ctx context.Context, msg Message) {
+		got = msg
+		gotPlatform = FromContext(ctx)
+	}))
+	body := "<xml><ToUserName>corp</ToUserName><Encrypt>" + encrypted + "</Encrypt></xml>"
+	req := httptest.NewRequest(http.MethodPost, "/webhook/wecom?"+query.Encode(),
+		strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got.Text != "/help" || got.UserId != "zhangsan" || got.RootId != "wecom_zhangsan" {
+		t.Fatalf("unexpected message %+v", got)
+	}
+	if gotPlatform != w {
+		t.Fatal("expected wecom platform in ctx")
+	}
+	if user, err := w.target("123"); err != nil || user != "zhangsan" {
+		t.Fatalf("expected reply target to be recorded, got %q %v", user, err)
+	}
+
+	// 签名不对的请求直接拒绝
+	query.Set("msg_signature", "bad")
+	req = httptest.NewRequest(http.MethodPost, "/webhook/wecom?"+query.Encode(),
+		strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestCardToMarkdown(t *testing.T) {
+	card := `{"header":{"title":{"tag":"plain_text","content":"🌟 已开启新的话题"}},` +
+		`"elements":[{"tag":"div","text":{"tag":"lark_md","content":"回答内容"}},` +
+		`{"tag":"action","actions":[{"tag":"button"}]},{"tag":"hr"},` +
+		`{"tag":"note","elements":[{"tag":"plain_text","content":"提醒"}]}]}`
+	want := "**🌟 已开启新的话题**\n\n回答内容\n\n---\n\n> 提醒"
+	if got := cardToMarkdown(card); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"path/filepath"
+	"sync"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/store"
+)
+
+// ChatSettings 群（或单聊）级别的设置，与会话不同，重启后仍然保留
+type ChatSettings struct {
+	// DisabledTools 在本群关闭的工具来源（MCP 服务、插件等）
+	DisabledTools []string `json:"disabled_tools,omitempty"`
+	// DefaultPrompt 本群的默认系统提示词模板，为空时使用全局配置
+	DefaultPrompt string `json:"default_prompt,omitempty"`
+	// ThreadContext 话题中没有@机器人的消息也记入上下文
+	ThreadContext bool `json:"thread_context,omitempty"`
+	// SessionScope 上下文的划分方式，为空时使用全局配置
+	SessionScope string `json:"session_scope,omitempty"`
+	// SessionEpochs /new 开启新话题的次数，整群共用一个会话时键为空字符串，按人划分时键为用户ID
+	SessionEpochs map[string]int `json:"session_epochs,omitempty"`
+}
+
+// 上下文划分方式
+const (
+	SessionScopeThread = "thread" // 每个话题一个会话
+	SessionScopeChat   = "chat"   // 整个群（或单聊）共用一个持续的会话
+	SessionScopeUser   = "user"   // 群里每个人各自一个持续的会话
+)
+
+// ValidSessionScope 是否为支持的上下文划分方式
+func ValidSessionScope(scope string) bool {
+	switch scope {
+	case SessionScopeThread, SessionScopeChat, SessionScopeUser:
+		return true
+	}
+	return false
+}
+
+// ToolEnabled 工具来源在本群是否启用
+func (c ChatSettings) ToolEnabled(source string) bool {
+	for _, s := range c.DisabledTools {
+		if s == source {
+			return false
+		}
+	}
+	return true
+}
+
+type ChatSettingsInterface interface {
+	Get(chatId string) ChatSettings
+	Update(chatId string, update func(*ChatSettings)) error
+}
+
+type ChatSettingsService struct {
+	store *store.Store
+}
+
+var (
+	chatSettingsService     *ChatSettingsService
+	chatSettingsServiceOnce sync.Once
+)
+
+// GetChatSettings 群设置保存在 DATA_DIR/chat_settings.json
+func GetChatSettings() ChatSettingsInterface {
+	chatSettingsServiceOnce.Do(func() {
+		path := filepath.Join(initialization.GetConfig().DataDir, "chat_settings.json")
+		chatSettingsService = &ChatSettingsService{store: store.OpenOrMemory(path, "群设置")}
+	})
+	return chatSettingsService
+}
+
+func (c *ChatSettingsService) Get(chatId string) ChatSettings {
+	var settings ChatSettings
+	c.store.Get("chat:"+chatId, &settings)
+	return settings
+}
+
+func (c *ChatSettingsService) Update(chatId string, update func(*ChatSettings)) error {
+	var settings ChatSettings
+	return c.store.Update("chat:"+chatId, &settings, func() error {
+		update(&settings)
+		return nil
+	})
+}
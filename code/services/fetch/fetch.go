@@ -0,0 +1,180 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Page 抓取到的网页
+type Page struct {
+	URL   string
+	Title string
+	Text  string
+}
+
+// Fetcher 抓取网页并提取正文文本。只允许 http/https，
+// 默认拒绝访问内网、回环等地址，避免被利用来探测内部服务
+type Fetcher struct {
+	// MaxBytes 响应体读取上限
+	MaxBytes int64
+	// Timeout 整个请求（含重定向）的超时时间
+	Timeout time.Duration
+	// MaxRedirects 最多跟随的重定向次数
+	MaxRedirects int
+
+	allowNets  []*net.IPNet
+	allowHosts map[string]bool
+	client     *http.Client
+}
+
+// ErrBlocked 目标地址不允许访问
+var ErrBlocked = errors.New("目标地址属于内网或保留地址，不允许访问")
+
+// NewFetcher allowList 中可以是 CIDR（如 10.1.0.0/16）或主机名，命中的内网地址允许访问
+func NewFetcher(maxBytes int64, timeout time.Duration, allowList []string) (*Fetcher, error) {
+	f := &Fetcher{
+		MaxBytes:     maxBytes,
+		Timeout:      timeout,
+		MaxRedirects: 5,
+		allowHosts:   make(map[string]bool),
+	}
+	for _, item := range allowList {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(item); err == nil {
+			f.allowNets = append(f.allowNets, ipNet)
+		} else if ip := net.ParseIP(item); ip != nil {
+			f.allowNets = append(f.allowNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else {
+			f.allowHosts[strings.ToLower(item)] = true
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := &http.Transport{
+		Proxy: nil, // 不走代理，否则无法校验真实连接的地址
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			if f.allowHosts[strings.ToLower(host)] {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			// 在建立连接时校验解析后的 IP，防止 DNS 重绑定绕过
+			d := *dialer
+			d.Control = func(network, address string, c syscall.RawConn) error {
+				ipStr, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !f.ipAllowed(net.ParseIP(ipStr)) {
+					return ErrBlocked
+				}
+				return nil
+			}
+			return d.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.MaxRedirects {
+				return errors.New("重定向次数过多")
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	return f, nil
+}
+
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func (f *Fetcher) ipAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range f.allowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() || cgnat.Contains(ip))
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("不支持的协议: %s", u.Scheme)
+	}
+	return nil
+}
+
+// Fetch 抓取网页，HTML 提取标题和正文，纯文本类型原样返回，其它类型报错
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; FeishuBot/1.0)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.5")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlocked) {
+			return nil, ErrBlocked
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isHTML := mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	if !isHTML && !strings.HasPrefix(mediaType, "text/") && mediaType != "application/json" {
+		return nil, fmt.Errorf("不支持的内容类型: %s", mediaType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.MaxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{URL: resp.Request.URL.String()}
+	if isHTML {
+		page.Title, page.Text = htmlToText(string(data))
+	} else {
+		page.Text = strings.TrimSpace(string(data))
+	}
+	return page, nil
+}
@@ -0,0 +1,43 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchBlocksPrivateUnlessAllowed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>发布说明</title><script>var x=1</script></head>
+<body><nav>首页 | 关于</nav><h1>v2.0</h1><p>支持   <b>分支</b>会话</p><ul><li>导出</li></ul></body></html>`))
+	}))
+	defer server.Close()
+
+	blocked, _ := NewFetcher(1<<20, 5*time.Second, nil)
+	if _, err := blocked.Fetch(context.Background(), server.URL); err != ErrBlocked {
+		t.Fatalf("expected loopback to be blocked, got %v", err)
+	}
+	if _, err := blocked.Fetch(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Fatal("expected non-http scheme to be rejected")
+	}
+
+	allowed, _ := NewFetcher(1<<20, 5*time.Second, []string{"127.0.0.0/8"})
+	page, err := allowed.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "发布说明" {
+		t.Fatalf("unexpected title %q", page.Title)
+	}
+	if strings.Contains(page.Text, "var x") || strings.Contains(page.Text, "首页") {
+		t.Fatalf("script and nav should be stripped: %q", page.Text)
+	}
+	if !strings.Contains(page.Text, "v2.0") || !strings.Contains(page.Text, "支持 分支 会话") ||
+		!strings.Contains(page.Text, "- 导出") {
+		t.Fatalf("unexpected text %q", page.Text)
+	}
+}
@@ -0,0 +1,85 @@
+package fetch
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// skipTags 不包含正文的标签，连同内容一起丢弃
+var skipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"head": true, "nav": true, "footer": true, "iframe": true, "form": true, "button": true,
+}
+
+// blockTags 块级标签，前后换行
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "section": true, "article": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "blockquote": true, "table": true, "ul": true, "ol": true, "header": true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// htmlToText 提取网页标题和可读文本
+func htmlToText(doc string) (title string, text string) {
+	z := html.NewTokenizer(strings.NewReader(doc))
+	var b strings.Builder
+	skipDepth := 0
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return strings.TrimSpace(title), cleanText(b.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if tag == "title" {
+				inTitle = true
+				continue
+			}
+			if skipTags[tag] && tt == html.StartTagToken {
+				skipDepth++
+			}
+			if blockTags[tag] {
+				b.WriteString("\n")
+			}
+			if tag == "li" {
+				b.WriteString("- ")
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if tag == "title" {
+				inTitle = false
+				continue
+			}
+			if skipTags[tag] && skipDepth > 0 {
+				skipDepth--
+			}
+			if blockTags[tag] {
+				b.WriteString("\n")
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			b.WriteString(strings.Join(strings.Fields(string(z.Text())), " "))
+			b.WriteString(" ")
+		}
+	}
+}
+
+func cleanText(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+)
+
+// maxPluginResponse 插件响应读取的上限，超出部分丢弃
+const maxPluginResponse = 64 * 1024
+
+// HttpPluginExecutor 通用 HTTP 执行器，把 YAML 中声明的接口作为工具提供给模型
+type HttpPluginExecutor struct {
+	plugins map[string]initialization.HttpPlugin
+	client  *http.Client
+}
+
+var httpPlugins *HttpPluginExecutor
+
+func NewHttpPluginExecutor(plugins []initialization.HttpPlugin) *HttpPluginExecutor {
+	e := &HttpPluginExecutor{
+		plugins: make(map[string]initialization.HttpPlugin),
+		client:  &http.Client{},
+	}
+	for _, p := range plugins {
+		e.plugins[p.Name] = p
+	}
+	return e
+}
+
+// InitHttpPlugins 设置全局插件，未调用时 GetHttpPlugins 返回 nil
+func InitHttpPlugins(config *initialization.PluginConfig) *HttpPluginExecutor {
+	httpPlugins = NewHttpPluginExecutor(config.Plugins)
+	return httpPlugins
+}
+
+func GetHttpPlugins() *HttpPluginExecutor {
+	return httpPlugins
+}
+
+// Names 所有插件名，按字典序排列
+func (e *HttpPluginExecutor) Names() []string {
+	if e == nil {
+		return nil
+	}
+	names := make([]string, 0, len(e.plugins))
+	for name := range e.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Executor 只包含 enabled 返回 true 的插件；没有可用插件时返回 nil
+func (e *HttpPluginExecutor) Executor(enabled func(name string) bool) openai.ToolExecutor {
+	if e == nil {
+		return nil
+	}
+	filtered := &HttpPluginExecutor{plugins: make(map[string]initialization.HttpPlugin), client: e.client}
+	for name, p := range e.plugins {
+		if enabled == nil || enabled(name) {
+			filtered.plugins[name] = p
+		}
+	}
+	if len(filtered.plugins) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+func (e *HttpPluginExecutor) Tools() []openai.Tool {
+	var tools []openai.Tool
+	for _, name := range e.Names() {
+		p := e.plugins[name]
+		tools = append(tools, openai.Tool{
+			Type: "function",
+			Function: openai.ToolFunction{
+				Name:        p.Name,
+				Description: p.Description,
+				Parameters:  p.ParamsJSON,
+			},
+		})
+	}
+	return tools
+}
+
+// Call 按插件声明发起请求：路径参数替换到 endpoint 中，
+// 其余参数 GET/DELETE 放在查询串，其它方法作为 JSON 请求体
+func (e *HttpPluginExecutor) Call(ctx context.Context, name string, arguments string) (string, error) {
+	p, ok := e.plugins[name]
+	if !ok {
+		return "", fmt.Errorf("未知插件: %s", name)
+	}
+	args := make(map[string]interface{})
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("插件参数不是合法的 JSON 对象: %v", err)
+		}
+	}
+
+	endpoint := p.Endpoint
+	for k, v := range args {
+		placeholder := "{" + k + "}"
+		if strings.Contains(endpoint, placeholder) {
+			endpoint = strings.ReplaceAll(endpoint, placeholder, url.PathEscape(fmt.Sprint(v)))
+			delete(args, k)
+		}
+	}
+	if strings.Contains(endpoint, "{") {
+		return "", fmt.Errorf("缺少路径参数: %s", endpoint)
+	}
+
+	var body io.Reader
+	if p.Method == http.MethodGet || p.Method == http.MethodDelete {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		for k, v := range args {
+			query.Set(k, fmt.Sprint(v))
+		}
+		u.RawQuery = query.Encode()
+		endpoint = u.String()
+	} else {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.Timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, p.Method, endpoint, body)
+	if err != nil {
+		return "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range p.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	if p.Auth.Header != "" {
+		token := os.Getenv(p.Auth.Env)
+		if token == "" {
+			return "", errors.New("插件 " + p.Name + " 的鉴权环境变量 " + p.Auth.Env + " 未设置")
+		}
+		req.Header.Set(p.Auth.Header, p.Auth.Prefix+token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPluginResponse))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, data)
+	}
+	return string(data), nil
+}
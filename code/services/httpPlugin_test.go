@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"start-feishubot/initialization"
+)
+
+func TestHttpPluginCall(t *testing.T) {
+	var gotPath, gotQuery, gotAuth string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotAuth = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization")
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		if r.URL.Path == "/tickets/missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("TEST_TICKET_TOKEN", "secret")
+	defer os.Unsetenv("TEST_TICKET_TOKEN")
+	path := filepath.Join(t.TempDir(), "plugins.yaml")
+	ioutil.WriteFile(path, []byte(`
+plugins:
+  - name: get_ticket
+    description: 查询工单
+    endpoint: `+server.URL+`/tickets/{id}
+    params:
+      type: object
+      properties:
+        id: {type: string}
+        fields: {type: string}
+      required: [id]
+    auth: {header: Authorization, env: TEST_TICKET_TOKEN, prefix: "Bearer "}
+  - name: create_ticket
+    method: post
+    endpoint: `+server.URL+`/tickets
+`), 0644)
+	config, err := initialization.LoadPluginConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewHttpPluginExecutor(config.Plugins)
+
+	tools := e.Tools()
+	if len(tools) != 2 || tools[1].Function.Name != "get_ticket" ||
+		!strings.Contains(string(tools[1].Function.Parameters), `"required":["id"]`) {
+		t.Fatalf("unexpected tools %+v", tools)
+	}
+
+	result, err := e.Call(context.Background(), "get_ticket", `{"id":"T 1","fields":"title"}`)
+	if err != nil || result != `{"ok":true}` {
+		t.Fatalf("unexpected result %q, %v", result, err)
+	}
+	if gotPath != "/tickets/T 1" || gotQuery != "fields=title" || gotAuth != "Bearer secret" {
+		t.Fatalf("unexpected request path=%q query=%q auth=%q", gotPath, gotQuery, gotAuth)
+	}
+
+	if _, err := e.Call(context.Background(), "create_ticket", `{"title":"disk full"}`); err != nil {
+		t.Fatal(err)
+	}
+	if gotBody["title"] != "disk full" {
+		t.Fatalf("expected JSON body, got %v", gotBody)
+	}
+
+	if _, err := e.Call(context.Background(), "get_ticket", `{"id":"missing"}`); err == nil ||
+		!strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+)
+
+// Tool MCP 服务提供的一个工具
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// Client 一个已初始化的 MCP 服务连接
+type Client struct {
+	Name    string
+	Tools   []Tool
+	t       transport
+	timeout time.Duration
+}
+
+// Connect 连接 MCP 服务，完成初始化握手并拉取工具列表
+func Connect(ctx context.Context, server initialization.McpServer) (*Client, error) {
+	var t transport
+	if server.Command != "" {
+		stdio, err := newStdioTransport(server.Name, server.Command, server.Args, server.Env)
+		if err != nil {
+			return nil, err
+		}
+		t = stdio
+	} else {
+		t = newHttpTransport(server.Url, server.Headers)
+	}
+	c := &Client{Name: server.Name, t: t, timeout: time.Duration(server.Timeout) * time.Second}
+	if err := c.initialize(ctx); err != nil {
+		t.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	_, err := c.t.call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "feishu-openai-bot", "version": "1.0.0"},
+	})
+	if err != nil {
+		return fmt.Errorf("initialize: %v", err)
+	}
+	if err := c.t.notify(ctx, "notifications/initialized", nil); err != nil {
+		return err
+	}
+	return c.listTools(ctx)
+}
+
+func (c *Client) listTools(ctx context.Context) error {
+	c.Tools = nil
+	cursor := ""
+	for {
+		var params map[string]string
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		raw, err := c.t.call(ctx, "tools/list", params)
+		if err != nil {
+			return fmt.Errorf("tools/list: %v", err)
+		}
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return err
+		}
+		c.Tools = append(c.Tools, result.Tools...)
+		if result.NextCursor == "" {
+			return nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool 调用工具，返回结果中的文本内容
+func (c *Client) CallTool(ctx context.Context, name string, arguments string) (string, error) {
+	args := json.RawMessage(arguments)
+	if strings.TrimSpace(arguments) == "" {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return "", errors.New("工具参数不是合法的 JSON")
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	raw, err := c.t.call(ctx, "tools/call", map[string]interface{}{
+		"name": name, "arguments": args,
+	})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Content []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			MimeType string `json:"mimeType"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s %s]", content.Type, content.MimeType))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+func (c *Client) Close() error {
+	return c.t.close()
+}
@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"start-feishubot/initialization"
+)
+
+// fakeServer 最小的 MCP 服务实现：一个 echo 工具
+func fakeServer(req rpcMessage, params json.RawMessage) interface{} {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{"protocolVersion": protocolVersion, "capabilities": map[string]interface{}{}}
+	case "tools/list":
+		return map[string]interface{}{"tools": []map[string]interface{}{
+			{"name": "echo", "description": "echo text", "inputSchema": map[string]interface{}{"type": "object"}},
+		}}
+	case "tools/call":
+		var p struct {
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(params, &p)
+		return map[string]interface{}{"content": []map[string]string{{"type": "text", "text": "echo: " + p.Arguments.Text}}}
+	}
+	return nil
+}
+
+type fakeRequest struct {
+	rpcMessage
+	Params json.RawMessage `json:"params"`
+}
+
+// 以子进程方式运行测试二进制自身，充当 stdio MCP 服务
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_MCP_SERVER") == "1" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			var req fakeRequest
+			json.Unmarshal(scanner.Bytes(), &req)
+			if len(req.ID) == 0 {
+				continue
+			}
+			data, _ := json.Marshal(rpcResponse{JSONRPC: "2.0", ID: req.ID,
+				Result: fakeServer(req.rpcMessage, req.Params)})
+			fmt.Println(string(data))
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStdioClient(t *testing.T) {
+	client, err := Connect(context.Background(), initialization.McpServer{
+		Name: "fake", Command: os.Args[0], Env: map[string]string{"FAKE_MCP_SERVER": "1"}, Timeout: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	m := &Manager{tools: make(map[string]toolRef)}
+	m.add(client)
+
+	e := m.Executor(nil)
+	if tools := e.Tools(); len(tools) != 1 || tools[0].Function.Name != "fake__echo" {
+		t.Fatalf("unexpected tools %+v", tools)
+	}
+	got, err := e.Call(context.Background(), "fake__echo", `{"text":"hi"}`)
+	if err != nil || got != "echo: hi" {
+		t.Fatalf("unexpected result %q, %v", got, err)
+	}
+	if m.Executor(func(string) bool { return false }) != nil {
+		t.Fatal("expected no executor when the server is disabled")
+	}
+}
+
+func TestHttpClientWithSSEResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req fakeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "s1")
+		} else if r.Header.Get("Mcp-Session-Id") != "s1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		if len(req.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(rpcResponse{JSONRPC: "2.0", ID: req.ID,
+			Result: fakeServer(req.rpcMessage, req.Params)})
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	}))
+	defer server.Close()
+
+	client, err := Connect(context.Background(), initialization.McpServer{
+		Name: "remote", Url: server.URL, Timeout: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.CallTool(context.Background(), "echo", `{"text":"hello"}`)
+	if err != nil || got != "echo: hello" {
+		t.Fatalf("unexpected result %q, %v", got, err)
+	}
+}
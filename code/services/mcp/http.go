@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// httpTransport Streamable HTTP 方式连接 MCP 服务：每个请求一次 POST，
+// 响应可能是 JSON，也可能是 SSE 流
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	nextID    int64
+	mu        sync.Mutex
+	sessionID string
+}
+
+func newHttpTransport(url string, headers map[string]string) *httpTransport {
+	return &httpTransport{url: url, headers: headers, client: &http.Client{}}
+}
+
+func (t *httpTransport) post(ctx context.Context, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		errBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, errBody)
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := atomic.AddInt64(&t.nextID, 1)
+	resp, err := t.post(ctx, rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var msg rpcMessage
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		msg, err = readSSEResponse(resp, id)
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+// readSSEResponse 从 SSE 流中找到对应请求的响应，期间的通知直接忽略
+func readSSEResponse(resp *http.Response, id int64) (rpcMessage, error) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		// 空行表示一个事件结束
+		var msg rpcMessage
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err != nil || !msg.isResponse() {
+			continue
+		}
+		if got, ok := msg.responseID(); ok && got == id {
+			return msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return rpcMessage{}, err
+	}
+	// 最后一个事件后面可能没有空行
+	var msg rpcMessage
+	if json.Unmarshal([]byte(data.String()), &msg) == nil && msg.isResponse() {
+		if got, ok := msg.responseID(); ok && got == id {
+			return msg, nil
+		}
+	}
+	return rpcMessage{}, errors.New("响应流结束，未收到结果")
+}
+
+func (t *httpTransport) notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := t.post(ctx, rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// protocolVersion 客户端支持的 MCP 协议版本
+const protocolVersion = "2024-11-05"
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcMessage 收到的消息，可能是响应，也可能是服务端发来的请求或通知
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// isResponse 是否为对我方请求的响应
+func (m rpcMessage) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// responseID 响应对应的请求 ID，我方发出的 ID 都是整数
+func (m rpcMessage) responseID() (int64, bool) {
+	var id int64
+	if err := json.Unmarshal(m.ID, &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// reply 服务端发来的请求：只支持 ping，其它一律返回方法不存在
+func (m rpcMessage) reply() rpcResponse {
+	if m.Method == "ping" {
+		return rpcResponse{JSONRPC: "2.0", ID: m.ID, Result: struct{}{}}
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: m.ID,
+		Error: &rpcError{Code: -32601, Message: "method not found: " + m.Method}}
+}
+
+// transport 与 MCP 服务之间的连接
+type transport interface {
+	call(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+	notify(ctx context.Context, method string, params interface{}) error
+	close() error
+}
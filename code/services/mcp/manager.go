@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/logger"
+	"start-feishubot/services/openai"
+)
+
+// Manager 管理所有 MCP 服务连接，把它们的工具以 服务名__工具名 的形式提供给模型
+type Manager struct {
+	clients []*Client
+	tools   map[string]toolRef
+}
+
+type toolRef struct {
+	client *Client
+	name   string
+	tool   openai.Tool
+}
+
+var manager *Manager
+
+// Init 按配置连接所有 MCP 服务。单个服务连接失败只记录日志，不影响其它服务和机器人启动
+func Init(config *initialization.McpConfig) *Manager {
+	m := &Manager{tools: make(map[string]toolRef)}
+	for _, server := range config.Servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		client, err := Connect(ctx, server)
+		cancel()
+		if err != nil {
+			logger.Errorf("❌ MCP 服务 %s 连接失败: %v", server.Name, err)
+			continue
+		}
+		m.add(client)
+		logger.Infof("🔌 MCP 服务 %s 已连接，提供 %d 个工具", server.Name, len(client.Tools))
+	}
+	manager = m
+	return m
+}
+
+// GetManager 未配置 MCP 时返回 nil
+func GetManager() *Manager {
+	return manager
+}
+
+var invalidToolName = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// toolName 模型要求工具名只包含字母数字、下划线和短横线，且不超过 64 个字符
+func toolName(server, tool string) string {
+	name := invalidToolName.ReplaceAllString(server+"__"+tool, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func (m *Manager) add(client *Client) {
+	m.clients = append(m.clients, client)
+	for _, tool := range client.Tools {
+		name := toolName(client.Name, tool.Name)
+		if _, ok := m.tools[name]; ok {
+			logger.Warnf("MCP 工具名 %s 重复，已忽略", name)
+			continue
+		}
+		params := tool.InputSchema
+		if len(params) == 0 {
+			params = []byte(`{"type":"object","properties":{}}`)
+		}
+		m.tools[name] = toolRef{client: client, name: tool.Name, tool: openai.Tool{
+			Type: "function",
+			Function: openai.ToolFunction{
+				Name:        name,
+				Description: tool.Description,
+				Parameters:  params,
+			},
+		}}
+	}
+}
+
+// Servers 已连接的服务及其工具数
+func (m *Manager) Servers() []ServerInfo {
+	if m == nil {
+		return nil
+	}
+	var servers []ServerInfo
+	for _, c := range m.clients {
+		servers = append(servers, ServerInfo{Name: c.Name, ToolCount: len(c.Tools)})
+	}
+	return servers
+}
+
+type ServerInfo struct {
+	Name      string
+	ToolCount int
+}
+
+// Executor 返回提供给模型的工具，enabled 判断某个服务在当前会话是否启用；没有可用工具时返回 nil
+func (m *Manager) Executor(enabled func(server string) bool) openai.ToolExecutor {
+	if m == nil {
+		return nil
+	}
+	e := executor{}
+	for name, ref := range m.tools {
+		if enabled == nil || enabled(ref.client.Name) {
+			e[name] = ref
+		}
+	}
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (m *Manager) Close() {
+	if m == nil {
+		return
+	}
+	for _, c := range m.clients {
+		c.Close()
+	}
+}
+
+type executor map[string]toolRef
+
+func (e executor) Tools() []openai.Tool {
+	tools := make([]openai.Tool, 0, len(e))
+	for _, ref := range e {
+		tools = append(tools, ref.tool)
+	}
+	// 固定顺序，便于上游复用提示词缓存
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Function.Name < tools[j].Function.Name
+	})
+	return tools
+}
+
+func (e executor) Call(ctx context.Context, name string, arguments string) (string, error) {
+	ref, ok := e[name]
+	if !ok {
+		return "", fmt.Errorf("未知工具: %s", name)
+	}
+	return ref.client.CallTool(ctx, ref.name, arguments)
+}
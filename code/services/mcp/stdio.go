@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"start-feishubot/logger"
+)
+
+// stdioTransport 以子进程方式启动 MCP 服务，通过标准输入输出逐行收发 JSON-RPC 消息
+type stdioTransport struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan rpcMessage
+	closed  error
+}
+
+func newStdioTransport(name, command string, args []string, env map[string]string) (*stdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	t := &stdioTransport{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan rpcMessage),
+	}
+	go t.readLoop(stdout)
+	go t.logStderr(stderr)
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			logger.Debugf("MCP %s 输出了无法解析的内容: %s", t.name, scanner.Text())
+			continue
+		}
+		if msg.isResponse() {
+			id, ok := msg.responseID()
+			if !ok {
+				continue
+			}
+			t.mu.Lock()
+			ch := t.pending[id]
+			delete(t.pending, id)
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+			continue
+		}
+		if len(msg.ID) > 0 {
+			t.write(msg.reply())
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	t.mu.Lock()
+	t.closed = fmt.Errorf("MCP 服务 %s 已退出: %v", t.name, err)
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+	t.mu.Unlock()
+}
+
+func (t *stdioTransport) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.Debugf("MCP %s: %s", t.name, scanner.Text())
+	}
+}
+
+func (t *stdioTransport) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	t.mu.Lock()
+	if t.closed != nil {
+		t.mu.Unlock()
+		return nil, t.closed
+	}
+	t.nextID++
+	id := t.nextID
+	ch := make(chan rpcMessage, 1)
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	if err := t.write(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return nil, err
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			t.mu.Lock()
+			err := t.closed
+			t.mu.Unlock()
+			return nil, err
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		t.write(rpcRequest{JSONRPC: "2.0", Method: "notifications/cancelled",
+			Params: map[string]interface{}{"requestId": id, "reason": "timeout"}})
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, method string, params interface{}) error {
+	return t.write(rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	if t.cmd.Process == nil {
+		return errors.New("process not started")
+	}
+	t.cmd.Process.Kill()
+	return t.cmd.Wait()
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+	"start-feishubot/services/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxMemoryFacts 每个用户最多保存的记忆条数，超出时丢弃最早的
+	MaxMemoryFacts = 50
+	// MaxMemoryFactRunes 单条记忆的长度上限
+	MaxMemoryFactRunes = 200
+	// MemoryToolName 模型保存记忆时调用的工具
+	MemoryToolName = "remember"
+)
+
+// MemoryFact 一条关于用户的长期记忆
+type MemoryFact struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserMemory 用户的长期记忆，跨话题生效，需要用户主动开启
+type UserMemory struct {
+	Enabled bool         `json:"enabled"`
+	Facts   []MemoryFact `json:"facts,omitempty"`
+}
+
+type MemoryInterface interface {
+	Get(userId string) UserMemory
+	SetEnabled(userId string, enabled bool) error
+	// Remember 保存一条记忆并开启记忆功能，相同内容只保存一次
+	Remember(userId string, text string) (MemoryFact, error)
+	Forget(userId string, id string) (bool, error)
+	Clear(userId string) error
+	// Relevant 取出与问题最相关的记忆，未开启时返回空
+	Relevant(userId string, query string, limit int) []MemoryFact
+	// Tool 供模型保存记忆的工具，未开启时返回 nil
+	Tool(userId string) openai.ToolExecutor
+}
+
+type MemoryService struct {
+	store *store.Store
+}
+
+var (
+	memoryService     *MemoryService
+	memoryServiceOnce sync.Once
+)
+
+// GetMemory 长期记忆保存在 DATA_DIR/memory.json
+func GetMemory() MemoryInterface {
+	memoryServiceOnce.Do(func() {
+		path := filepath.Join(initialization.GetConfig().DataDir, "memory.json")
+		memoryService = &MemoryService{store: store.OpenOrMemory(path, "长期记忆")}
+	})
+	return memoryService
+}
+
+func (m *MemoryService) Get(userId string) UserMemory {
+	var memory UserMemory
+	m.store.Get("memory:"+userId, &memory)
+	return memory
+}
+
+func (m *MemoryService) update(userId string, update func(*UserMemory) error) error {
+	var memory UserMemory
+	return m.store.Update("memory:"+userId, &memory, func() error {
+		return update(&memory)
+	})
+}
+
+func (m *MemoryService) SetEnabled(userId string, enabled bool) error {
+	return m.update(userId, func(memory *UserMemory) error {
+		memory.Enabled = enabled
+		return nil
+	})
+}
+
+func (m *MemoryService) Remember(userId string, text string) (MemoryFact, error) {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return MemoryFact{}, errors.New("记忆内容不能为空")
+	}
+	if utf8.RuneCountInString(text) > MaxMemoryFactRunes {
+		return MemoryFact{}, fmt.Errorf("单条记忆不能超过 %d 个字", MaxMemoryFactRunes)
+	}
+	var fact MemoryFact
+	err := m.update(userId, func(memory *UserMemory) error {
+		memory.Enabled = true
+		for _, f := range memory.Facts {
+			if strings.EqualFold(f.Text, text) {
+				fact = f
+				return nil
+			}
+		}
+		fact = MemoryFact{ID: uuid.New().String()[:8], Text: text, CreatedAt: time.Now()}
+		memory.Facts = append(memory.Facts, fact)
+		if len(memory.Facts) > MaxMemoryFacts {
+			memory.Facts = memory.Facts[len(memory.Facts)-MaxMemoryFacts:]
+		}
+		return nil
+	})
+	return fact, err
+}
+
+func (m *MemoryService) Forget(userId string, id string) (bool, error) {
+	found := false
+	err := m.update(userId, func(memory *UserMemory) error {
+		var facts []MemoryFact
+		for _, f := range memory.Facts {
+			if f.ID == id {
+				found = true
+				continue
+			}
+			facts = append(facts, f)
+		}
+		memory.Facts = facts
+		return nil
+	})
+	return found, err
+}
+
+func (m *MemoryService) Clear(userId string) error {
+	return m.update(userId, func(memory *UserMemory) error {
+		memory.Facts = nil
+		return nil
+	})
+}
+
+// Relevant 按与问题共有的词打分，相关的排在前面，不足 limit 条时用最近的记忆补齐，
+// 结果按保存顺序返回
+func (m *MemoryService) Relevant(userId string, query string, limit int) []MemoryFact {
+	memory := m.Get(userId)
+	if !memory.Enabled || len(memory.Facts) == 0 || limit <= 0 {
+		return nil
+	}
+	if len(memory.Facts) <= limit {
+		return memory.Facts
+	}
+	queryTerms := make(map[string]bool)
+	for _, term := range memoryTerms(query) {
+		queryTerms[term] = true
+	}
+	type scored struct {
+		index int
+		score int
+	}
+	ranked := make([]scored, len(memory.Facts))
+	for i, f := range memory.Facts {
+		ranked[i].index = i
+		for _, term := range memoryTerms(f.Text) {
+			if queryTerms[term] {
+				ranked[i].score++
+			}
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].index > ranked[j].index
+	})
+	picked := make([]int, 0, limit)
+	for _, r := range ranked[:limit] {
+		picked = append(picked, r.index)
+	}
+	sort.Ints(picked)
+	facts := make([]MemoryFact, 0, limit)
+	for _, i := range picked {
+		facts = append(facts, memory.Facts[i])
+	}
+	return facts
+}
+
+// memoryTerms 英文和数字按单词切分，中文按相邻两个字切分
+func memoryTerms(text string) []string {
+	var terms []string
+	var word []rune
+	var prevHan rune
+	flush := func() {
+		if len(word) >= 2 {
+			terms = append(terms, string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			if prevHan != 0 {
+				terms = append(terms, string([]rune{prevHan, r}))
+			}
+			prevHan = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		default:
+			flush()
+		}
+		prevHan = 0
+	}
+	flush()
+	return terms
+}
+
+func (m *MemoryService) Tool(userId string) openai.ToolExecutor {
+	if userId == "" || !m.Get(userId).Enabled {
+		return nil
+	}
+	return &memoryTool{service: m, userId: userId}
+}
+
+// memoryTool 让模型在对话中记下用户明确提到的长期信息
+type memoryTool struct {
+	service *MemoryService
+	userId  string
+}
+
+func (t *memoryTool) Tools() []openai.Tool {
+	return []openai.Tool{{
+		Type: "function",
+		Function: openai.ToolFunction{
+			Name: MemoryToolName,
+			Description: "记住关于用户的长期信息，例如所在团队、职责、偏好的语言或回答风格。" +
+				"只在用户明确表达这类信息时使用，不要记录一次性的问题内容",
+			Parameters: json.RawMessage(`{"type":"object","properties":{"fact":` +
+				`{"type":"string","description":"用一句话描述的事实，例如：用户在支付团队工作"}},"required":["fact"]}`),
+		},
+	}}
+}
+
+func (t *memoryTool) Call(ctx context.Context, name string, arguments string) (string, error) {
+	if name != MemoryToolName {
+		return "", fmt.Errorf("未知工具: %s", name)
+	}
+	var args struct {
+		Fact string `json:"fact"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("参数格式错误: %v", err)
+	}
+	fact, err := t.service.Remember(t.userId, args.Fact)
+	if err != nil {
+		return "", err
+	}
+	return "已记住：" + fact.Text, nil
+}
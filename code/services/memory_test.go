@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"start-feishubot/services/store"
+)
+
+func TestMemoryRememberDedupAndLimit(t *testing.T) {
+	m := &MemoryService{store: store.Memory()}
+	if m.Tool("ou_1") != nil {
+		t.Fatal("memory tool should be off until the user opts in")
+	}
+	first, err := m.Remember("ou_1", "我在支付团队工作")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := m.Remember("ou_1", " 我在支付团队工作 ")
+	if again.ID != first.ID || len(m.Get("ou_1").Facts) != 1 {
+		t.Fatalf("duplicate fact should not be saved twice: %+v", m.Get("ou_1"))
+	}
+	if !m.Get("ou_1").Enabled || m.Tool("ou_1") == nil {
+		t.Fatal("remembering a fact should opt the user in")
+	}
+	for i := 0; i < MaxMemoryFacts; i++ {
+		m.Remember("ou_1", fmt.Sprintf("fact %d", i))
+	}
+	facts := m.Get("ou_1").Facts
+	if len(facts) != MaxMemoryFacts || facts[0].Text != "fact 0" {
+		t.Fatalf("oldest facts should be dropped, got %d facts starting with %q", len(facts), facts[0].Text)
+	}
+	if ok, _ := m.Forget("ou_1", facts[0].ID); !ok || len(m.Get("ou_1").Facts) != MaxMemoryFacts-1 {
+		t.Fatal("forget should remove the fact")
+	}
+}
+
+func TestMemoryRelevant(t *testing.T) {
+	m := &MemoryService{store: store.Memory()}
+	for _, text := range []string{"我在支付团队工作", "喜欢用 Go 写示例", "周五下午不开会", "住在杭州"} {
+		m.Remember("ou_1", text)
+	}
+	facts := m.Relevant("ou_1", "给我一个 Go 的 HTTP 示例", 2)
+	if len(facts) != 2 || facts[0].Text != "喜欢用 Go 写示例" || facts[1].Text != "住在杭州" {
+		t.Fatalf("expected the Go preference and the latest fact, got %+v", facts)
+	}
+	facts = m.Relevant("ou_1", "支付团队的值班安排", 1)
+	if len(facts) != 1 || facts[0].Text != "我在支付团队工作" {
+		t.Fatalf("expected the payments fact, got %+v", facts)
+	}
+	m.SetEnabled("ou_1", false)
+	if len(m.Relevant("ou_1", "Go", 2)) != 0 {
+		t.Fatal("disabled memory should not be retrieved")
+	}
+}
+
+func TestMemoryTool(t *testing.T) {
+	m := &MemoryService{store: store.Memory()}
+	m.SetEnabled("ou_1", true)
+	result, err := m.Tool("ou_1").Call(context.Background(), MemoryToolName, `{"fact":"偏好简洁的回答"}`)
+	if err != nil || result != "已记住：偏好简洁的回答" {
+		t.Fatalf("unexpected tool result %q, %v", result, err)
+	}
+	if facts := m.Get("ou_1").Facts; len(facts) != 1 {
+		t.Fatalf("tool call should save the fact, got %+v", facts)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"start-feishubot/services/openai"
+)
+
+// MsgNode 会话树上的一条消息
+type MsgNode struct {
+	ID       string          `json:"id"`
+	ParentID string          `json:"parent_id,omitempty"`
+	Msg      openai.Messages `json:"msg"`
+}
+
+// MsgTree 以树的形式保存会话的全部历史：编辑之前的问题或重新生成回答都会开辟新的分支，
+// 旧分支不会丢失。Head 指向当前分支的最后一条消息
+type MsgTree struct {
+	Nodes    map[string]*MsgNode `json:"nodes"`
+	Children map[string][]string `json:"children"`
+	Head     string              `json:"head"`
+	seq      int
+}
+
+// Branch 会话中的一个分支，以叶子节点标识
+type Branch struct {
+	LeafID       string
+	Length       int
+	LastQuestion string
+	Current      bool
+}
+
+func newMsgTree() *MsgTree {
+	return &MsgTree{
+		Nodes:    make(map[string]*MsgNode),
+		Children: make(map[string][]string),
+	}
+}
+
+// sync 把当前分支的消息写入树中：没有编号的消息作为新节点挂在前一条消息之下，
+// 已有编号的消息更新内容（例如续写）。msg 中的编号会被原地补全
+func (t *MsgTree) sync(msg []openai.Messages) {
+	parent := ""
+	for i := range msg {
+		m := &msg[i]
+		if _, ok := t.Nodes[m.ID]; m.ID == "" || !ok {
+			t.seq++
+			m.ID = "m" + strconv.Itoa(t.seq)
+			t.Nodes[m.ID] = &MsgNode{ID: m.ID, ParentID: parent}
+			t.Children[parent] = append(t.Children[parent], m.ID)
+		}
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = time.Now()
+		}
+		t.Nodes[m.ID].Msg = *m
+		parent = m.ID
+	}
+	t.Head = parent
+}
+
+// Path 返回从根到指定节点的完整消息列表
+func (t *MsgTree) Path(id string) []openai.Messages {
+	var path []openai.Messages
+	for id != "" {
+		node, ok := t.Nodes[id]
+		if !ok {
+			break
+		}
+		path = append(path, node.Msg)
+		id = node.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Branches 列出所有分支，按创建顺序排列
+func (t *MsgTree) Branches() []Branch {
+	var leaves []string
+	for id := range t.Nodes {
+		if len(t.Children[id]) == 0 {
+			leaves = append(leaves, id)
+		}
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return nodeSeq(leaves[i]) < nodeSeq(leaves[j])
+	})
+
+	// 当前分支可能停在一个有子节点的位置（刚切换到编辑点），它也算一个分支
+	if t.Head != "" && len(t.Children[t.Head]) > 0 {
+		leaves = append(leaves, t.Head)
+	}
+
+	branches := make([]Branch, 0, len(leaves))
+	for _, leaf := range leaves {
+		path := t.Path(leaf)
+		branch := Branch{LeafID: leaf, Length: len(path), Current: leaf == t.Head}
+		for i := len(path) - 1; i >= 0; i-- {
+			if path[i].Role == "user" {
+				branch.LastQuestion = path[i].Content
+				break
+			}
+		}
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+// findQuestion 根据飞书消息ID找到对应的提问节点，回答消息会返回它所回答的问题
+func (t *MsgTree) findQuestion(feishuMsgId string) (*MsgNode, bool) {
+	for _, node := range t.Nodes {
+		if node.Msg.FeishuMsgId != feishuMsgId {
+			continue
+		}
+		if node.Msg.Role == "assistant" {
+			node = t.Nodes[node.ParentID]
+		}
+		if node == nil || node.Msg.Role != "user" {
+			return nil, false
+		}
+		return node, true
+	}
+	return nil, false
+}
+
+func nodeSeq(id string) int {
+	seq, _ := strconv.Atoi(strings.TrimPrefix(id, "m"))
+	return seq
+}
@@ -21,6 +21,10 @@ type PlatForm string
 const (
 	MaxRetries = 3
 )
+
+// retryInterval 请求失败后重试的等待间隔，第 n 次重试等待 n 倍
+var retryInterval = time.Second
+
 const (
 	AzureApiUrlV1 = "openai.azure.com/openai/deployments/"
 )
@@ -53,6 +57,10 @@ type ChatGPT struct {
 	Platform         PlatForm
 	AzureConfig      AzureConfig
 	OpenRouterConfig OpenRouterConfig
+	// Fallbacks 模型降级链，所选模型请求失败时依次尝试
+	Fallbacks map[string][]string
+	// RouterModel 自动选择模型时用于问题分类的模型，为空时只按规则判断
+	RouterModel string
 }
 type requestBodyType int
 
@@ -126,21 +134,7 @@ func (gpt *ChatGPT) doAPIRequestWithRetry(url, method string,
 	}
 	
 	// 设置认证头
-	switch gpt.Platform {
-	case OpenAI, OpenRouter:
-		req.Header.Set("Authorization", "Bearer "+api.Key)
-		// OpenRouter特有的headers
-		if gpt.Platform == OpenRouter {
-			if gpt.OpenRouterConfig.SiteUrl != "" {
-				req.Header.Set("HTTP-Referer", gpt.OpenRouterConfig.SiteUrl)
-			}
-			if gpt.OpenRouterConfig.SiteName != "" {
-				req.Header.Set("X-Title", gpt.OpenRouterConfig.SiteName)
-			}
-		}
-	case Azure:
-		req.Header.Set("api-key", gpt.AzureConfig.ApiToken)
-	}
+	gpt.setAuthHeader(req, api.Key)
 
 	var response *http.Response
 	var retry int
@@ -156,28 +150,31 @@ func (gpt *ChatGPT) doAPIRequestWithRetry(url, method string,
 		logger.Debug("req", req.Header)
 
 		logger.Debugf("response %v", response)
+		// 连接失败（服务不可达、连接被关闭）时没有响应，直接返回，由调用方换用降级模型
+		if err != nil {
+			return fmt.Errorf("%s api request failed: %v", strings.ToUpper(method), err)
+		}
 		// read body
-		if err != nil || response.StatusCode < 200 || response.StatusCode >= 300 {
+		if response.StatusCode < 200 || response.StatusCode >= 300 {
 
 			body, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
 			fmt.Println("body", string(body))
 
 			gpt.Lb.SetAvailability(api.Key, false)
 			if retry == maxRetries {
 				break
 			}
-			time.Sleep(time.Duration(retry+1) * time.Second)
+			time.Sleep(time.Duration(retry+1) * retryInterval)
 		} else {
 			break
 		}
 	}
-	if response != nil {
-		defer response.Body.Close()
-	}
-
-	if response == nil || response.StatusCode < 200 || response.StatusCode >= 300 {
-		return fmt.Errorf("%s api failed after %d retries", strings.ToUpper(method), retry)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("%s api failed after %d retries: status %d",
+			strings.ToUpper(method), retry, response.StatusCode)
 	}
+	defer response.Body.Close()
 
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
@@ -193,6 +190,25 @@ func (gpt *ChatGPT) doAPIRequestWithRetry(url, method string,
 	return nil
 }
 
+// setAuthHeader 按平台设置认证头
+func (gpt *ChatGPT) setAuthHeader(req *http.Request, key string) {
+	switch gpt.Platform {
+	case OpenAI, OpenRouter:
+		req.Header.Set("Authorization", "Bearer "+key)
+		// OpenRouter特有的headers
+		if gpt.Platform == OpenRouter {
+			if gpt.OpenRouterConfig.SiteUrl != "" {
+				req.Header.Set("HTTP-Referer", gpt.OpenRouterConfig.SiteUrl)
+			}
+			if gpt.OpenRouterConfig.SiteName != "" {
+				req.Header.Set("X-Title", gpt.OpenRouterConfig.SiteName)
+			}
+		}
+	case Azure:
+		req.Header.Set("api-key", gpt.AzureConfig.ApiToken)
+	}
+}
+
 func (gpt *ChatGPT) sendRequestWithBodyType(link, method string,
 	bodyType requestBodyType,
 	requestBody interface{}, responseBody interface{}) error {
@@ -246,6 +262,8 @@ func NewChatGPT(config initialization.Config) *ChatGPT {
 			SiteUrl:  config.OpenRouterSiteUrl,
 			SiteName: config.OpenRouterSiteName,
 		},
+		Fallbacks:   ParseFallbacks(config.ModelFallbacks),
+		RouterModel: config.AutoRouterModel,
 	}
 }
 
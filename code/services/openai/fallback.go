@@ -0,0 +1,47 @@
+package openai
+
+import (
+	"strings"
+
+	"start-feishubot/logger"
+)
+
+// DefaultFallbackKey 对所有没有单独配置降级链的模型生效
+const DefaultFallbackKey = "*"
+
+// ParseFallbacks 解析降级链配置，每条形如 "a>b>c"，表示 a 失败时依次尝试 b、c；
+// 以 "*" 开头的链作为所有模型的默认降级
+func ParseFallbacks(chains []string) map[string][]string {
+	fallbacks := make(map[string][]string)
+	for _, chain := range chains {
+		var models []string
+		for _, m := range strings.Split(chain, ">") {
+			if m = strings.TrimSpace(m); m != "" {
+				models = append(models, m)
+			}
+		}
+		if len(models) < 2 {
+			logger.Warnf("忽略无效的模型降级配置: %s", chain)
+			continue
+		}
+		fallbacks[models[0]] = models[1:]
+	}
+	return fallbacks
+}
+
+// ModelChain 返回依次尝试的模型：所选模型在前，后面是去重后的降级模型
+func (gpt *ChatGPT) ModelChain(model string) []string {
+	next, ok := gpt.Fallbacks[model]
+	if !ok {
+		next = gpt.Fallbacks[DefaultFallbackKey]
+	}
+	chain := []string{model}
+	seen := map[string]bool{model: true}
+	for _, m := range next {
+		if !seen[m] {
+			seen[m] = true
+			chain = append(chain, m)
+		}
+	}
+	return chain
+}
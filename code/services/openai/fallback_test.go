@@ -0,0 +1,130 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"start-feishubot/services/loadbalancer"
+)
+
+func TestModelChain(t *testing.T) {
+	gpt := &ChatGPT{Fallbacks: ParseFallbacks([]string{
+		"a>b>a>c", "*>free", "invalid",
+	})}
+	if got := gpt.ModelChain("a"); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected chain %v", got)
+	}
+	if got := gpt.ModelChain("x"); !reflect.DeepEqual(got, []string{"x", "free"}) {
+		t.Fatalf("expected default chain, got %v", got)
+	}
+	if _, ok := gpt.Fallbacks["invalid"]; ok {
+		t.Fatal("single-model chain should be ignored")
+	}
+}
+
+// 所选模型被内容过滤拒绝（400）时换用降级模型，并记录实际回答的模型
+func TestStreamChatFallsBack(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var body ChatGPTRequestBody
+		json.Unmarshal(data, &body)
+		models = append(models, body.Model)
+		if body.Model == "primary" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"ok"},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	gpt := &ChatGPT{
+		Lb:        loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:    server.URL,
+		Platform:  OpenRouter,
+		Fallbacks: map[string][]string{"primary": {"backup"}},
+	}
+
+	stream := make(chan string, 10)
+	result, err := gpt.StreamChatWithOptions(context.Background(),
+		[]Messages{{Role: "user", Content: "hi"}}, Balance, "primary", stream, ChatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Model != "backup" || result.FallbackFrom != "primary" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if !reflect.DeepEqual(models, []string{"primary", "backup"}) {
+		t.Fatalf("unexpected requests %v", models)
+	}
+
+	models = nil
+	_, err = gpt.StreamChatWithOptions(context.Background(),
+		[]Messages{{Role: "user", Content: "hi"}}, Balance, "primary", stream, ChatOptions{NoFallback: true})
+	if err == nil || len(models) != 1 {
+		t.Fatalf("expected no fallback, got err=%v requests=%v", err, models)
+	}
+}
+
+// 非流式请求在连接被断开（没有响应）或限流、服务端出错时换用降级模型，
+// 每个模型的请求体都按该模型重新调整，不受前一个模型的影响
+func TestCompletionsFallsBack(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = time.Millisecond
+
+	for name, fail := range map[string]func(w http.ResponseWriter){
+		"transport error": func(w http.ResponseWriter) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		},
+		"rate limited": func(w http.ResponseWriter) { w.WriteHeader(http.StatusTooManyRequests) },
+		"server error": func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var bodies []ChatGPTRequestBody
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				var body ChatGPTRequestBody
+				json.Unmarshal(data, &body)
+				bodies = append(bodies, body)
+				if body.Model != "openai/gpt-4o" {
+					fail(w)
+					return
+				}
+				fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+			}))
+			defer server.Close()
+			gpt := &ChatGPT{
+				Lb:        loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+				ApiUrl:    server.URL,
+				Platform:  OpenRouter,
+				MaxTokens: 2000,
+				Fallbacks: map[string][]string{"anthropic/claude-sonnet-4": {"openai/gpt-4o"}},
+			}
+			temperature := 1.5
+			schema := &ResponseSchema{Name: "role_output", Schema: json.RawMessage(todoSchema)}
+			resp, err := gpt.CompletionsWithOptions(context.Background(),
+				[]Messages{{Role: "user", Content: "hi"}}, Balance, "anthropic/claude-sonnet-4",
+				ChatOptions{ResponseSchema: schema, Params: GenParams{Temperature: &temperature}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Content != "ok" || resp.Model != "openai/gpt-4o" ||
+				resp.FallbackFrom != "anthropic/claude-sonnet-4" {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+			backup := bodies[len(bodies)-1]
+			if backup.ResponseFormat == nil || len(backup.Messages) != 1 || backup.Temperature != 1.5 {
+				t.Fatalf("backup request adapted for the primary model: %+v", backup)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"start-feishubot/logger"
+)
+
+// Forward 把请求体原样转发到上游的 suffix 接口，使用机器人的密钥池、代理和平台配置。
+// 上游返回错误时换一个密钥重试，成功或重试用尽后返回上游响应，调用方负责关闭 Body
+func (gpt *ChatGPT) Forward(ctx context.Context, suffix string, body []byte) (*http.Response, error) {
+	url := gpt.FullUrl(suffix)
+	if url == "" {
+		return nil, errors.New("无法获取openai请求地址")
+	}
+	client, err := GetProxyClient(gpt.HttpProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for retry := 0; retry <= MaxRetries; retry++ {
+		if retry > 0 {
+			time.Sleep(time.Duration(retry) * time.Second)
+		}
+		api := gpt.Lb.GetAPI()
+		if api == nil {
+			return nil, errors.New("no available API")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		gpt.setAuthHeader(req, api.Key)
+
+		response, err := client.Do(req)
+		if err != nil {
+			logger.Errorf("转发请求失败: %v", err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			gpt.Lb.SetAvailability(api.Key, false)
+			lastErr = err
+			continue
+		}
+		if response.StatusCode >= 200 && response.StatusCode < 300 {
+			gpt.Lb.SetAvailability(api.Key, true)
+			return response, nil
+		}
+		// 除了密钥失效和限流，4xx 是请求本身的问题，换密钥也没用，直接返回给调用方
+		retryable := response.StatusCode >= 500 ||
+			response.StatusCode == http.StatusUnauthorized ||
+			response.StatusCode == http.StatusTooManyRequests
+		if !retryable || retry == MaxRetries {
+			return response, nil
+		}
+		gpt.Lb.SetAvailability(api.Key, false)
+		errBody, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		lastErr = fmt.Errorf("status %d: %s", response.StatusCode, errBody)
+	}
+	return nil, fmt.Errorf("POST api failed after %d retries: %v", MaxRetries, lastErr)
+}
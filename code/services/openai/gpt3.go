@@ -4,6 +4,7 @@ import (
 	"errors"
 	"start-feishubot/logger"
 	"strings"
+	"time"
 
 	"github.com/pandodao/tokenizer-go"
 )
@@ -34,6 +35,33 @@ var AIModeStrs = []string{
 type Messages struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// 工具调用：assistant 消息中模型发起的调用，以及 tool 消息对应的调用ID
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// 以下字段仅用于会话记录，不会发送给模型
+	// Truncated 表示这条回答没有完整生成（被用户中途停止或达到长度上限）
+	Truncated bool `json:"-"`
+	// ID 为会话树中的节点编号，FeishuMsgId 为对应的飞书消息ID
+	ID          string `json:"-"`
+	FeishuMsgId string `json:"-"`
+	// Model 为生成这条回答的模型，CreatedAt 为消息写入会话的时间
+	Model     string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	// FallbackFrom 所选模型请求失败、由降级模型回答时，记录原本选择的模型
+	FallbackFrom string `json:"-"`
+	// AutoRoute 自动选择模型时的选择说明
+	AutoRoute string `json:"-"`
+	// Structured 角色声明了 JSON Schema 时解析并校验通过的结果，StructuredError 为校验失败的原因
+	Structured      interface{} `json:"-"`
+	StructuredError string      `json:"-"`
+	// ToolRecords 生成这条回答时调用过的工具
+	ToolRecords []ToolCallRecord `json:"-"`
+	// Reasoning 推理模型的思考过程，只在卡片中展示，不写入会话历史
+	Reasoning string `json:"-"`
+	// DefaultPrompt 表示这条系统消息来自默认提示词，每次请求时重新渲染
+	DefaultPrompt bool `json:"-"`
+	// Speaker 群聊中提问人的显示名称，请求时加在消息前
+	Speaker string `json:"-"`
 }
 
 // ChatGPTResponseBody 请求体
@@ -46,10 +74,21 @@ type ChatGPTResponseBody struct {
 	Usage   map[string]interface{} `json:"usage"`
 }
 
+// FinishReasonLength 表示回答因 max_tokens 限制被截断
+const FinishReasonLength = "length"
+
 type ChatGPTChoiceItem struct {
-	Message      Messages `json:"message"`
-	Index        int      `json:"index"`
-	FinishReason string   `json:"finish_reason"`
+	Message      ResponseMessage `json:"message"`
+	Index        int             `json:"index"`
+	FinishReason string          `json:"finish_reason"`
+}
+
+// ResponseMessage 模型返回的消息，推理模型会在 reasoning（OpenRouter）
+// 或 reasoning_content（DeepSeek 等）中返回思考过程
+type ResponseMessage struct {
+	Messages
+	ReasoningText    string `json:"reasoning"`
+	ReasoningContent string `json:"reasoning_content"`
 }
 
 // ChatGPTRequestBody 响应体
@@ -58,9 +97,96 @@ type ChatGPTRequestBody struct {
 	Messages         []Messages `json:"messages"`
 	MaxTokens        int        `json:"max_tokens"`
 	Temperature      AIMode     `json:"temperature"`
-	TopP             int        `json:"top_p"`
+	TopP             float64    `json:"top_p"`
 	FrequencyPenalty int        `json:"frequency_penalty"`
 	PresencePenalty  int        `json:"presence_penalty"`
+	Stop             []string   `json:"stop,omitempty"`
+	Seed             *int       `json:"seed,omitempty"`
+	// ResponseFormat 结构化输出，只在模型支持 json_schema 时设置
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Tools          []Tool          `json:"tools,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	// 推理强度：OpenAI 使用 reasoning_effort，OpenRouter 使用 reasoning.effort
+	ReasoningEffort string           `json:"reasoning_effort,omitempty"`
+	Reasoning       *ReasoningConfig `json:"reasoning,omitempty"`
+}
+
+type ReasoningConfig struct {
+	Effort string `json:"effort,omitempty"`
+}
+
+// ChatOptions 对话的可选项
+type ChatOptions struct {
+	// Tools 可供模型调用的工具，为空时不提供工具
+	Tools ToolExecutor
+	// ReasoningEffort 推理强度 low、medium、high，为空时使用模型默认值
+	ReasoningEffort string
+	// OnToolCall 每次工具调用完成后回调
+	OnToolCall func(ToolCallRecord)
+	// OnReasoning 流式输出思考过程时回调
+	OnReasoning func(string)
+	// Params 会话设置的生成参数，会覆盖发散模式对应的温度
+	Params GenParams
+	// ResponseSchema 要求按 JSON Schema 输出，模型不支持时改为系统提示约束
+	ResponseSchema *ResponseSchema
+	// NoFallback 只使用指定的模型，失败时不按降级链换模型（例如多模型对比）
+	NoFallback bool
+}
+
+// newRequestBody 组装请求体，各平台推理强度的参数名不同
+func (gpt *ChatGPT) newRequestBody(msg []Messages, aiMode AIMode, model string,
+	opts ChatOptions, tools []Tool) ChatGPTRequestBody {
+	body := ChatGPTRequestBody{
+		Model:            model,
+		Messages:         withSpeakers(msg),
+		MaxTokens:        gpt.MaxTokens,
+		Temperature:      aiMode,
+		TopP:             1,
+		FrequencyPenalty: 0,
+		PresencePenalty:  0,
+		Tools:            tools,
+		Stop:             opts.Params.Stop,
+		Seed:             opts.Params.Seed,
+	}
+	if opts.Params.Temperature != nil {
+		body.Temperature = AIMode(*opts.Params.Temperature)
+	}
+	if opts.Params.TopP != nil {
+		body.TopP = *opts.Params.TopP
+	}
+	if opts.Params.MaxTokens > 0 {
+		body.MaxTokens = opts.Params.MaxTokens
+	}
+	if opts.ResponseSchema != nil {
+		body.ResponseFormat = &ResponseFormat{Type: "json_schema", JSONSchema: opts.ResponseSchema}
+	}
+	if opts.ReasoningEffort != "" {
+		if gpt.Platform == OpenRouter {
+			body.Reasoning = &ReasoningConfig{Effort: opts.ReasoningEffort}
+		} else {
+			body.ReasoningEffort = opts.ReasoningEffort
+		}
+	}
+	return body
+}
+
+// forModel 返回发给指定模型的请求体，按模型上限调整温度和最大输出长度，发散模式的 1.2、1.7 超出了部分平台 [0, 1] 的温度范围；
+// 模型不支持 json_schema 时改为在系统提示中约束输出。原请求体不变，降级链上的每个模型都从它重新调整
+func (body ChatGPTRequestBody) forModel(model string) ChatGPTRequestBody {
+	body.Model = model
+	if body.ResponseFormat != nil && !SupportsStructuredOutput(model) {
+		body.Messages = append(append([]Messages{}, body.Messages...),
+			schemaInstruction(body.ResponseFormat.JSONSchema))
+		body.ResponseFormat = nil
+	}
+	maxTemperature, maxOutputTokens := ParamLimits(model)
+	if float64(body.Temperature) > maxTemperature {
+		body.Temperature = AIMode(maxTemperature)
+	}
+	if maxOutputTokens > 0 && body.MaxTokens > maxOutputTokens {
+		body.MaxTokens = maxOutputTokens
+	}
+	return body
 }
 
 func (msg *Messages) CalculateTokenLength() int {
@@ -76,15 +202,34 @@ func (gpt *ChatGPT) Completions(msg []Messages, aiMode AIMode) (resp Messages,
 // CompletionsWithModel 使用指定模型进行对话
 func (gpt *ChatGPT) CompletionsWithModel(msg []Messages, aiMode AIMode, model string) (resp Messages,
 	err error) {
-	requestBody := ChatGPTRequestBody{
-		Model:            model,
-		Messages:         msg,
-		MaxTokens:        gpt.MaxTokens,
-		Temperature:      aiMode,
-		TopP:             1,
-		FrequencyPenalty: 0,
-		PresencePenalty:  0,
+	return gpt.completions(gpt.newRequestBody(msg, aiMode, model, ChatOptions{}, nil), true)
+}
+
+// completions 请求失败且 fallback 为 true 时，按降级链依次换用其它模型
+func (gpt *ChatGPT) completions(requestBody ChatGPTRequestBody, fallback bool) (resp Messages, err error) {
+	chain := []string{requestBody.Model}
+	if fallback {
+		chain = gpt.ModelChain(requestBody.Model)
+	}
+	var errs []string
+	for i, model := range chain {
+		resp, err = gpt.completionsOnce(requestBody.forModel(model))
+		if err == nil {
+			if i > 0 {
+				resp.FallbackFrom = chain[0]
+			}
+			return resp, nil
+		}
+		errs = append(errs, err.Error())
+		if i+1 < len(chain) {
+			logger.Warnf("⚠️ %v，切换到降级模型 %s", err, chain[i+1])
+		}
 	}
+	return resp, errors.New(strings.Join(errs, "；"))
+}
+
+func (gpt *ChatGPT) completionsOnce(requestBody ChatGPTRequestBody) (resp Messages, err error) {
+	model := requestBody.Model
 	gptResponseBody := &ChatGPTResponseBody{}
 	url := gpt.FullUrl("chat/completions")
 	logger.Debug(url)
@@ -96,8 +241,13 @@ func (gpt *ChatGPT) CompletionsWithModel(msg []Messages, aiMode AIMode, model st
 	
 	err = gpt.sendRequestWithBodyType(url, "POST", jsonBody, requestBody, gptResponseBody)
 	if err == nil && len(gptResponseBody.Choices) > 0 {
-		resp = gptResponseBody.Choices[0].Message
+		resp = gptResponseBody.Choices[0].Message.toMessages()
+		resp.Truncated = gptResponseBody.Choices[0].FinishReason == FinishReasonLength
+		resp.Model = model
 	} else {
+		if err == nil {
+			err = errors.New("没有返回任何回答")
+		}
 		logger.Errorf("ERROR %v", err)
 		resp = Messages{}
 		err = errors.New("模型 " + model + " 请求失败: " + err.Error())
@@ -27,84 +27,109 @@ type ModelInfo struct {
 	IsFree       bool         `json:"is_free"`      // 是否免费
 	Capabilities []string     `json:"capabilities"` // 能力列表 (text, image, vision等)
 	Category     string       `json:"category"`     // 分类 (通用, 编程, 专业等)
+	// 参数上限，为 0 时温度按 2、输出长度不限制
+	MaxTemperature  float64 `json:"max_temperature,omitempty"`   // 温度上限
+	MaxOutputTokens int     `json:"max_output_tokens,omitempty"` // 单次回答的最大输出token数
 }
 
 // 支持的模型列表
 var SupportedModels = map[string]*ModelInfo{
-	"openai/gpt-4o": {
-		ID:           "openai/gpt-4o",
-		Name:         "GPT-4o",
-		Provider:     ProviderOpenAI,
-		Description:  "OpenAI最新的多模态模型，支持文本、图像和语音",
-		MaxTokens:    128000,
+	AutoModel: {
+		ID:           AutoModel,
+		Name:         "自动选择",
+		Provider:     "",
+		Description:  "按问题内容自动选择合适的模型：编程、长文档、图片、闲聊分别路由",
+		MaxTokens:    0,
 		IsFree:       false,
-		Capabilities: []string{"text", "vision", "reasoning"},
-		Category:     "通用",
+		Capabilities: []string{"text"},
+		Category:     "自动",
+	},
+	"openai/gpt-4o": {
+		ID:              "openai/gpt-4o",
+		Name:            "GPT-4o",
+		Provider:        ProviderOpenAI,
+		Description:     "OpenAI最新的多模态模型，支持文本、图像和语音",
+		MaxTokens:       128000,
+		IsFree:          false,
+		Capabilities:    []string{"text", "vision", "reasoning", "structured_output"},
+		Category:        "通用",
+		MaxOutputTokens: 16384,
 	},
 	"openai/gpt-4.1": {
-		ID:           "openai/gpt-4.1",
-		Name:         "GPT-4.1",
-		Provider:     ProviderOpenAI,
-		Description:  "OpenAI GPT-4.1，增强的推理能力",
-		MaxTokens:    128000,
-		IsFree:       false,
-		Capabilities: []string{"text", "reasoning"},
-		Category:     "通用",
+		ID:              "openai/gpt-4.1",
+		Name:            "GPT-4.1",
+		Provider:        ProviderOpenAI,
+		Description:     "OpenAI GPT-4.1，增强的推理能力",
+		MaxTokens:       128000,
+		IsFree:          false,
+		Capabilities:    []string{"text", "reasoning", "structured_output"},
+		Category:        "通用",
+		MaxOutputTokens: 32768,
 	},
 	"qwen/qwen3-coder:free": {
-		ID:           "qwen/qwen3-coder:free",
-		Name:         "Qwen3 Coder (免费)",
-		Provider:     ProviderQwen,
-		Description:  "通义千问3代码专家版，专为编程任务优化",
-		MaxTokens:    32768,
-		IsFree:       true,
-		Capabilities: []string{"text", "coding"},
-		Category:     "编程",
+		ID:              "qwen/qwen3-coder:free",
+		Name:            "Qwen3 Coder (免费)",
+		Provider:        ProviderQwen,
+		Description:     "通义千问3代码专家版，专为编程任务优化",
+		MaxTokens:       32768,
+		IsFree:          true,
+		Capabilities:    []string{"text", "coding"},
+		Category:        "编程",
+		MaxOutputTokens: 8192,
 	},
 	"google/gemini-2.5-pro": {
-		ID:           "google/gemini-2.5-pro",
-		Name:         "Gemini 2.5 Pro",
-		Provider:     ProviderGoogle,
-		Description:  "Google最新的大型语言模型，性能卓越",
-		MaxTokens:    1000000,
-		IsFree:       false,
-		Capabilities: []string{"text", "vision", "reasoning"},
-		Category:     "通用",
+		ID:              "google/gemini-2.5-pro",
+		Name:            "Gemini 2.5 Pro",
+		Provider:        ProviderGoogle,
+		Description:     "Google最新的大型语言模型，性能卓越",
+		MaxTokens:       1000000,
+		IsFree:          false,
+		Capabilities:    []string{"text", "vision", "reasoning", "structured_output"},
+		Category:        "通用",
+		MaxOutputTokens: 65536,
 	},
 	"anthropic/claude-sonnet-4": {
-		ID:           "anthropic/claude-sonnet-4",
-		Name:         "claude-sonnet-4",
-		Provider:     ProviderAnthropic,
-		Description:  "Anthropic最新的Claude模型，擅长分析和推理",
-		MaxTokens:    200000,
-		IsFree:       false,
-		Capabilities: []string{"text", "analysis", "reasoning"},
-		Category:     "分析",
+		ID:              "anthropic/claude-sonnet-4",
+		Name:            "claude-sonnet-4",
+		Provider:        ProviderAnthropic,
+		Description:     "Anthropic最新的Claude模型，擅长分析和推理",
+		MaxTokens:       200000,
+		IsFree:          false,
+		Capabilities:    []string{"text", "analysis", "reasoning"},
+		Category:        "分析",
+		MaxTemperature:  1,
+		MaxOutputTokens: 64000,
 	},
 	"deepseek/deepseek-chat-v3-0324:free": {
-		ID:           "deepseek/deepseek-chat-v3-0324:free",
-		Name:         "DeepSeek Chat V3 (免费)",
-		Provider:     ProviderDeepSeek,
-		Description:  "深度求索聊天模型V3版本，免费使用",
-		MaxTokens:    32768,
-		IsFree:       true,
-		Capabilities: []string{"text", "reasoning"},
-		Category:     "通用",
+		ID:              "deepseek/deepseek-chat-v3-0324:free",
+		Name:            "DeepSeek Chat V3 (免费)",
+		Provider:        ProviderDeepSeek,
+		Description:     "深度求索聊天模型V3版本，免费使用",
+		MaxTokens:       32768,
+		IsFree:          true,
+		Capabilities:    []string{"text", "reasoning"},
+		Category:        "通用",
+		MaxOutputTokens: 8192,
 	},
 	"moonshot/kimi-k2-0711-preview": {
-		ID:           "moonshot/kimi-k2-0711-preview",
-		Name:         "Kimi K2 (免费)",
-		Provider:     ProviderMoonshot,
-		Description:  "月之暗面Kimi K2模型，OpenRouter免费版本",
-		MaxTokens:    128000,
-		IsFree:       true,
-		Capabilities: []string{"text", "long_context", "reasoning"},
-		Category:     "长文本",
+		ID:              "moonshot/kimi-k2-0711-preview",
+		Name:            "Kimi K2 (免费)",
+		Provider:        ProviderMoonshot,
+		Description:     "月之暗面Kimi K2模型，OpenRouter免费版本",
+		MaxTokens:       128000,
+		IsFree:          true,
+		Capabilities:    []string{"text", "long_context", "reasoning"},
+		Category:        "长文本",
+		MaxTemperature:  1,
+		MaxOutputTokens: 16384,
 	},
 }
 
 // ModelCategory 模型分类
 var ModelCategories = map[string][]string{
+	"自动": {
+		AutoModel,
+	},
 	"通用": {
 		"openai/gpt-4o",
 		"openai/gpt-4.1", 
@@ -155,6 +180,17 @@ func GetAllModels() []*ModelInfo {
 	return models
 }
 
+// GetConcreteModels 获取所有实际的模型，不含自动选择，用于多模型对比
+func GetConcreteModels() []*ModelInfo {
+	var models []*ModelInfo
+	for _, model := range SupportedModels {
+		if model.ID != AutoModel {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
 // GetFreeModels 获取免费模型
 func GetFreeModels() []*ModelInfo {
 	var models []*ModelInfo
@@ -0,0 +1,152 @@
+package openai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 未在 ModelInfo 中声明上限时使用的默认取值范围
+const (
+	defaultMaxTemperature = 2.0
+	maxStopSequences      = 4
+)
+
+// GenParams 会话级的生成参数，字段为空时使用默认值（温度取发散模式）
+type GenParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// GenParamNames 可以设置的参数名
+var GenParamNames = []string{"temperature", "top_p", "max_tokens", "stop", "seed"}
+
+// IsZero 是否没有设置任何参数
+func (p GenParams) IsZero() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == 0 &&
+		len(p.Stop) == 0 && p.Seed == nil
+}
+
+// Set 解析并设置一个参数，值为 default 时恢复默认
+func (p *GenParams) Set(name string, value string) error {
+	value = strings.TrimSpace(value)
+	reset := value == "" || value == "default"
+	switch name {
+	case "temperature":
+		if reset {
+			p.Temperature = nil
+			return nil
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("temperature 需要是不小于 0 的数字")
+		}
+		p.Temperature = &v
+	case "top_p":
+		if reset {
+			p.TopP = nil
+			return nil
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v <= 0 || v > 1 {
+			return fmt.Errorf("top_p 需要是 (0, 1] 之间的数字")
+		}
+		p.TopP = &v
+	case "max_tokens":
+		if reset {
+			p.MaxTokens = 0
+			return nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("max_tokens 需要是正整数")
+		}
+		p.MaxTokens = v
+	case "stop":
+		if reset {
+			p.Stop = nil
+			return nil
+		}
+		var stop []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				stop = append(stop, strings.ReplaceAll(s, `\n`, "\n"))
+			}
+		}
+		if len(stop) > maxStopSequences {
+			return fmt.Errorf("stop 最多设置 %d 个", maxStopSequences)
+		}
+		p.Stop = stop
+	case "seed":
+		if reset {
+			p.Seed = nil
+			return nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("seed 需要是整数")
+		}
+		p.Seed = &v
+	default:
+		return fmt.Errorf("未知参数 %s，可设置 %s", name, strings.Join(GenParamNames, "、"))
+	}
+	return nil
+}
+
+// ParamLimits 模型的参数上限，未声明的取默认值
+func ParamLimits(model string) (maxTemperature float64, maxOutputTokens int) {
+	maxTemperature = defaultMaxTemperature
+	if info, ok := SupportedModels[model]; ok {
+		if info.MaxTemperature > 0 {
+			maxTemperature = info.MaxTemperature
+		}
+		maxOutputTokens = info.MaxOutputTokens
+	}
+	return maxTemperature, maxOutputTokens
+}
+
+// Clamp 按模型上限调整参数，返回调整说明
+func (p GenParams) Clamp(model string) (GenParams, []string) {
+	var notes []string
+	maxTemperature, maxOutputTokens := ParamLimits(model)
+	if p.Temperature != nil && *p.Temperature > maxTemperature {
+		notes = append(notes, fmt.Sprintf("temperature 超过该模型上限，按 %g 发送", maxTemperature))
+		v := maxTemperature
+		p.Temperature = &v
+	}
+	if maxOutputTokens > 0 && p.MaxTokens > maxOutputTokens {
+		notes = append(notes, fmt.Sprintf("max_tokens 超过该模型上限，按 %d 发送", maxOutputTokens))
+		p.MaxTokens = maxOutputTokens
+	}
+	return p, notes
+}
+
+// String 参数的简要说明，未设置的参数显示为默认
+func (p GenParams) String() string {
+	show := func(set bool, v string) string {
+		if !set {
+			return "默认"
+		}
+		return v
+	}
+	var seed string
+	if p.Seed != nil {
+		seed = strconv.Itoa(*p.Seed)
+	}
+	var temperature, topP string
+	if p.Temperature != nil {
+		temperature = strconv.FormatFloat(*p.Temperature, 'g', -1, 64)
+	}
+	if p.TopP != nil {
+		topP = strconv.FormatFloat(*p.TopP, 'g', -1, 64)
+	}
+	return fmt.Sprintf("temperature: %s\ntop_p: %s\nmax_tokens: %s\nstop: %s\nseed: %s",
+		show(p.Temperature != nil, temperature),
+		show(p.TopP != nil, topP),
+		show(p.MaxTokens > 0, strconv.Itoa(p.MaxTokens)),
+		show(len(p.Stop) > 0, strconv.Quote(strings.Join(p.Stop, ","))),
+		show(p.Seed != nil, seed))
+}
@@ -0,0 +1,47 @@
+package openai
+
+import "testing"
+
+func TestGenParamsSet(t *testing.T) {
+	var p GenParams
+	for name, value := range map[string]string{
+		"temperature": "0.5", "top_p": "0.9", "max_tokens": "100000", "stop": `END,\n\n`, "seed": "42",
+	} {
+		if err := p.Set(name, value); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if *p.Temperature != 0.5 || *p.TopP != 0.9 || *p.Seed != 42 || p.Stop[1] != "\n\n" {
+		t.Fatalf("unexpected params %+v", p)
+	}
+	for name, value := range map[string]string{
+		"temperature": "-1", "top_p": "1.5", "max_tokens": "0", "seed": "x", "penalty": "1",
+	} {
+		if err := p.Set(name, value); err == nil {
+			t.Fatalf("expected %s=%s to be rejected", name, value)
+		}
+	}
+	if err := p.Set("seed", "default"); err != nil || p.Seed != nil {
+		t.Fatalf("expected seed to be reset, got %v", p.Seed)
+	}
+}
+
+func TestRequestBodyClampsToModelLimits(t *testing.T) {
+	gpt := &ChatGPT{MaxTokens: 2000}
+	claude := "anthropic/claude-sonnet-4"
+	body := gpt.newRequestBody(nil, Creativity, claude, ChatOptions{}, nil).forModel(claude)
+	if body.Temperature != 1 || body.TopP != 1 {
+		t.Fatalf("expected preset temperature clamped to 1, got %v", body.Temperature)
+	}
+
+	temperature := 1.8
+	params := GenParams{Temperature: &temperature, MaxTokens: 100000}
+	body = gpt.newRequestBody(nil, Fresh, "openai/gpt-4o", ChatOptions{Params: params}, nil).
+		forModel("openai/gpt-4o")
+	if body.Temperature != 1.8 || body.MaxTokens != 16384 {
+		t.Fatalf("unexpected body %+v", body)
+	}
+	if _, notes := params.Clamp(claude); len(notes) != 2 {
+		t.Fatalf("expected two clamp notes, got %v", notes)
+	}
+}
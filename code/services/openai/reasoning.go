@@ -0,0 +1,107 @@
+package openai
+
+import "strings"
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// ReasoningEfforts 可选的推理强度
+var ReasoningEfforts = []string{"low", "medium", "high"}
+
+// toMessages 取出回答，思考过程放到 Reasoning 中，不混在正文里
+func (m ResponseMessage) toMessages() Messages {
+	msg := m.Messages
+	msg.Reasoning = m.ReasoningContent
+	if msg.Reasoning == "" {
+		msg.Reasoning = m.ReasoningText
+	}
+	if reasoning, content, ok := splitThink(msg.Content); ok {
+		if msg.Reasoning == "" {
+			msg.Reasoning = reasoning
+		}
+		msg.Content = content
+	}
+	return msg
+}
+
+// splitThink 拆出正文开头 <think>...</think> 中的思考过程
+func splitThink(content string) (reasoning string, answer string, ok bool) {
+	trimmed := strings.TrimLeft(content, " \n\r\t")
+	if !strings.HasPrefix(trimmed, thinkOpenTag) {
+		return "", content, false
+	}
+	rest := strings.TrimPrefix(trimmed, thinkOpenTag)
+	end := strings.Index(rest, thinkCloseTag)
+	if end < 0 {
+		// 没有结束标签，说明回答在思考中途被截断
+		return strings.TrimSpace(rest), "", true
+	}
+	return strings.TrimSpace(rest[:end]),
+		strings.TrimLeft(rest[end+len(thinkCloseTag):], " \n\r\t"), true
+}
+
+// thinkSplitter 流式输出时把 <think> 标签中的内容分离出来。
+// 标签可能被拆在多个分片里，所以未确定的部分先缓存起来
+type thinkSplitter struct {
+	state   int // 0 尚未确定是否以 <think> 开头，1 思考中，2 正文
+	pending string
+}
+
+// push 输入一个分片，返回其中的思考内容和正文内容
+func (t *thinkSplitter) push(chunk string) (reasoning string, content string) {
+	t.pending += chunk
+	for {
+		switch t.state {
+		case 0:
+			trimmed := strings.TrimLeft(t.pending, " \n\r\t")
+			if strings.HasPrefix(trimmed, thinkOpenTag) {
+				t.pending = strings.TrimPrefix(trimmed, thinkOpenTag)
+				t.state = 1
+				continue
+			}
+			if strings.HasPrefix(thinkOpenTag, trimmed) {
+				return reasoning, content // 可能是标签的前半部分，继续等待
+			}
+			t.state = 2
+			continue
+		case 1:
+			if end := strings.Index(t.pending, thinkCloseTag); end >= 0 {
+				reasoning += t.pending[:end]
+				t.pending = strings.TrimLeft(t.pending[end+len(thinkCloseTag):], " \n\r\t")
+				t.state = 2
+				continue
+			}
+			// 保留可能是结束标签前半部分的结尾
+			keep := partialSuffix(t.pending, thinkCloseTag)
+			reasoning += t.pending[:len(t.pending)-keep]
+			t.pending = t.pending[len(t.pending)-keep:]
+			return reasoning, content
+		default:
+			content += t.pending
+			t.pending = ""
+			return reasoning, content
+		}
+	}
+}
+
+// flush 流结束时输出缓存的内容
+func (t *thinkSplitter) flush() (reasoning string, content string) {
+	pending := t.pending
+	t.pending = ""
+	if t.state == 1 {
+		return pending, ""
+	}
+	return "", pending
+}
+
+// partialSuffix s 的结尾与 tag 开头重合的最大长度
+func partialSuffix(s string, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
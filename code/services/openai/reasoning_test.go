@@ -0,0 +1,48 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 标签被拆在多个分片中时也能正确分离思考过程和正文
+func TestThinkSplitterAcrossChunks(t *testing.T) {
+	var s thinkSplitter
+	var reasoning, content string
+	for _, chunk := range []string{"\n<thi", "nk>先算", "一下</th", "ink>\n\n答案", "是 <b>2</b>"} {
+		r, c := s.push(chunk)
+		reasoning += r
+		content += c
+	}
+	r, c := s.flush()
+	reasoning += r
+	content += c
+	if reasoning != "先算一下" || content != "答案是 <b>2</b>" {
+		t.Fatalf("unexpected split reasoning=%q content=%q", reasoning, content)
+	}
+
+	var plain thinkSplitter
+	if _, c := plain.push("<"); c != "" {
+		t.Fatalf("expected possible tag prefix to be held back, got %q", c)
+	}
+	if _, c := plain.push("p>hi"); c != "<p>hi" {
+		t.Fatalf("expected plain content, got %q", c)
+	}
+}
+
+func TestResponseMessageReasoning(t *testing.T) {
+	var fields ResponseMessage
+	json.Unmarshal([]byte(`{"role":"assistant","content":"42","reasoning_content":"想了想"}`), &fields)
+	if msg := fields.toMessages(); msg.Reasoning != "想了想" || msg.Content != "42" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	var tags ResponseMessage
+	json.Unmarshal([]byte(`{"role":"assistant","content":"<think>\n想了想\n</think>\n\n42"}`), &tags)
+	if msg := tags.toMessages(); msg.Reasoning != "想了想" || msg.Content != "42" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if data, _ := json.Marshal(tags.toMessages()); string(data) != `{"role":"assistant","content":"42"}` {
+		t.Fatalf("reasoning should not be sent back to the model: %s", data)
+	}
+}
@@ -0,0 +1,145 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"start-feishubot/logger"
+)
+
+// AutoModel 自动选择模型，每个问题按内容路由到合适的模型
+const AutoModel = "auto"
+
+// 路由得到的问题类型
+const (
+	RouteCoding  = "coding"
+	RouteLong    = "long"
+	RouteImage   = "image"
+	RouteChat    = "chat"
+	RouteGeneral = "general"
+)
+
+// routeCategories 问题类型对应 ModelCategories 中的分类和显示名称
+var routeCategories = map[string]struct {
+	category string
+	label    string
+}{
+	RouteCoding:  {"编程", "编程问题"},
+	RouteLong:    {"长文本", "长文档"},
+	RouteImage:   {"通用", "图片理解"},
+	RouteChat:    {"免费", "简单闲聊"},
+	RouteGeneral: {"通用", "通用问题"},
+}
+
+// 长文档和简单闲聊的长度阈值（字符数）
+const (
+	longQuestionRunes = 3000
+	chatQuestionRunes = 20
+)
+
+var codeRegex = regexp.MustCompile("(?i)```|\\bfunc\\b|\\bdef\\b|\\bclass\\b|\\bimport\\b|\\bselect\\b.+\\bfrom\\b|" +
+	"traceback|exception|panic:|stack ?trace|\\bsql\\b|\\bregex\\b|" +
+	"代码|编程|报错|函数|正则|编译|调试|bug")
+
+// RouteInput 路由时参考的问题信息
+type RouteInput struct {
+	Question string
+	// ContextRunes 随问题一起发送的附加内容（链接正文、搜索结果等）长度
+	ContextRunes int
+	HasImage     bool
+}
+
+// RouteDecision 路由结果
+type RouteDecision struct {
+	Model string
+	Kind  string
+	// Reason 选择的依据，展示在卡片脚注中
+	Reason string
+}
+
+// Note 卡片脚注中的说明
+func (d RouteDecision) Note() string {
+	return fmt.Sprintf("🧭 自动选择：%s（%s）", routeCategories[d.Kind].label, d.Reason)
+}
+
+// RouteModel 先用规则判断问题类型，判断不出来且配置了分类模型时再请求一次分类，
+// 最后从 ModelCategories 对应分类中选出模型
+func (gpt *ChatGPT) RouteModel(ctx context.Context, in RouteInput) RouteDecision {
+	kind, reason := classifyByRules(in)
+	if kind == "" && gpt.RouterModel != "" {
+		kind, reason = gpt.classifyByModel(ctx, in.Question)
+	}
+	if kind == "" {
+		kind, reason = RouteGeneral, "未识别出特定类型"
+	}
+	return RouteDecision{Model: pickRouteModel(kind), Kind: kind, Reason: reason}
+}
+
+func classifyByRules(in RouteInput) (kind string, reason string) {
+	runes := utf8.RuneCountInString(in.Question)
+	switch {
+	case in.HasImage:
+		return RouteImage, "消息包含图片"
+	case runes+in.ContextRunes > longQuestionRunes:
+		return RouteLong, fmt.Sprintf("内容较长，约 %d 字", runes+in.ContextRunes)
+	case codeRegex.MatchString(in.Question):
+		return RouteCoding, "包含代码或编程相关内容"
+	case runes <= chatQuestionRunes:
+		return RouteChat, "问题简短"
+	}
+	return "", ""
+}
+
+const routerPrompt = "判断用户问题属于哪一类，只回答类别英文名，不要解释：\n" +
+	"coding（编程、代码、技术排错）\nlong（长文档阅读、总结）\n" +
+	"chat（寒暄、简单问答）\ngeneral（其它问题）"
+
+// classifyByModel 用配置的低成本模型给问题分类，失败时返回空
+func (gpt *ChatGPT) classifyByModel(ctx context.Context, question string) (kind string, reason string) {
+	runes := []rune(question)
+	if len(runes) > 1000 {
+		runes = runes[:1000]
+	}
+	resp, err := gpt.CompletionsWithOptions(ctx, []Messages{
+		{Role: "system", Content: routerPrompt},
+		{Role: "user", Content: string(runes)},
+	}, Fresh, gpt.RouterModel, ChatOptions{NoFallback: true})
+	if err != nil {
+		logger.Warnf("问题分类失败: %v", err)
+		return "", ""
+	}
+	answer := strings.ToLower(resp.Content)
+	for _, k := range []string{RouteCoding, RouteLong, RouteChat, RouteGeneral} {
+		if strings.Contains(answer, k) {
+			return k, "由分类模型判断"
+		}
+	}
+	return "", ""
+}
+
+// pickRouteModel 取分类中第一个可用的模型，图片问题要求模型支持图像理解
+func pickRouteModel(kind string) string {
+	for _, id := range ModelCategories[routeCategories[kind].category] {
+		info, ok := SupportedModels[id]
+		if !ok {
+			continue
+		}
+		if kind == RouteImage && !hasCapability(info, "vision") {
+			continue
+		}
+		return id
+	}
+	return DefaultModel
+}
+
+func hasCapability(info *ModelInfo, capability string) bool {
+	for _, c := range info.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"start-feishubot/services/loadbalancer"
+)
+
+func TestRouteModelByRules(t *testing.T) {
+	gpt := &ChatGPT{}
+	cases := []struct {
+		in   RouteInput
+		kind string
+	}{
+		{RouteInput{Question: "你好"}, RouteChat},
+		{RouteInput{Question: "这段 Go 代码为什么会 panic: nil map？```m[1]=2```"}, RouteCoding},
+		{RouteInput{Question: "帮我总结一下", ContextRunes: 5000}, RouteLong},
+		{RouteInput{Question: "图里是什么", HasImage: true}, RouteImage},
+		{RouteInput{Question: strings.Repeat("介绍一下唐朝的历史背景", 3)}, RouteGeneral},
+	}
+	for _, c := range cases {
+		d := gpt.RouteModel(context.Background(), c.in)
+		if d.Kind != c.kind {
+			t.Fatalf("%q: expected %s, got %s", c.in.Question, c.kind, d.Kind)
+		}
+		if _, ok := SupportedModels[d.Model]; !ok || d.Model == AutoModel {
+			t.Fatalf("%q: routed to unknown model %s", c.in.Question, d.Model)
+		}
+	}
+	if d := gpt.RouteModel(context.Background(), RouteInput{HasImage: true}); !hasCapability(SupportedModels[d.Model], "vision") {
+		t.Fatalf("image question routed to %s without vision", d.Model)
+	}
+}
+
+func TestRouteModelByClassifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Coding"}}]}`)
+	}))
+	defer server.Close()
+	gpt := &ChatGPT{
+		Lb:          loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:      server.URL,
+		Platform:    OpenRouter,
+		RouterModel: "cheap",
+	}
+	d := gpt.RouteModel(context.Background(),
+		RouteInput{Question: "我的服务部署到 k8s 之后总是起不来，日志里什么都没有怎么排查"})
+	if d.Kind != RouteCoding || d.Model != ModelCategories["编程"][0] {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+}
@@ -0,0 +1,151 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 结构化结果的展示方式
+const (
+	OutputTable = "table" // 表格卡片
+	OutputFile  = "file"  // JSON 文件
+)
+
+// ResponseSchema 角色声明的输出结构，对应 response_format 中的 json_schema
+type ResponseSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
+	// Output 结果的展示方式，不发送给模型
+	Output string `json:"-"`
+}
+
+// ResponseFormat 请求体中的 response_format
+type ResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *ResponseSchema `json:"json_schema,omitempty"`
+}
+
+// SupportsStructuredOutput 模型是否支持 response_format 的 json_schema，
+// 不在模型列表中的模型按不支持处理
+func SupportsStructuredOutput(model string) bool {
+	info, ok := SupportedModels[model]
+	return ok && hasCapability(info, "structured_output")
+}
+
+// schemaInstruction 不支持 json_schema 的模型改为在系统提示中要求输出 JSON
+func schemaInstruction(schema *ResponseSchema) Messages {
+	return Messages{Role: "system", Content: "只输出一个符合以下 JSON Schema 的 JSON，" +
+		"不要输出 Markdown 代码块或任何解释：\n" + string(schema.Schema)}
+}
+
+// ParseStructured 从回答中取出 JSON 并按 schema 校验，同时返回取出的 JSON 原文
+func ParseStructured(schema json.RawMessage, content string) (value interface{}, text string, err error) {
+	text = strings.TrimSpace(content)
+	if start := strings.IndexAny(text, "{["); start > 0 {
+		text = text[start:]
+	}
+	if end := strings.LastIndexAny(text, "}]"); end >= 0 {
+		text = text[:end+1]
+	}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, "", fmt.Errorf("回答不是有效的 JSON: %v", err)
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, "", fmt.Errorf("JSON Schema 无效: %v", err)
+	}
+	if err := validateSchema(s, value, "$"); err != nil {
+		return nil, "", err
+	}
+	return value, text, nil
+}
+
+// validateSchema 校验常用的 JSON Schema 关键字：type、properties、required、items、enum
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s 不在可选值 %v 中", path, enum)
+		}
+	}
+	if t, ok := schema["type"]; ok && !matchType(t, value) {
+		return fmt.Errorf("%s 应为 %v 类型", path, t)
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if _, ok := v[fmt.Sprint(r)]; !ok {
+					return fmt.Errorf("%s 缺少必填字段 %v", path, r)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]interface{})
+			if val, exists := v[k]; ok && exists {
+				if err := validateSchema(sub, val, path+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchType type 可以是单个类型或类型列表
+func matchType(t interface{}, value interface{}) bool {
+	if list, ok := t.([]interface{}); ok {
+		for _, item := range list {
+			if matchType(item, value) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const todoSchema = `{"type":"object","required":["items"],"properties":{"items":{"type":"array",
+"items":{"type":"object","required":["task"],"properties":{"task":{"type":"string"},
+"priority":{"type":"string","enum":["P0","P1"]}}}}}}`
+
+func TestParseStructured(t *testing.T) {
+	content := "好的：\n```json\n{\"items\":[{\"task\":\"写文档\",\"priority\":\"P0\"}]}\n```"
+	value, text, err := ParseStructured(json.RawMessage(todoSchema), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != `{"items":[{"task":"写文档","priority":"P0"}]}` || value == nil {
+		t.Fatalf("unexpected text %q", text)
+	}
+
+	for _, bad := range []string{
+		`not json`,
+		`{"items":[{"priority":"P0"}]}`,
+		`{"items":[{"task":"a","priority":"P9"}]}`,
+		`{"items":{"task":"a"}}`,
+	} {
+		if _, _, err := ParseStructured(json.RawMessage(todoSchema), bad); err == nil {
+			t.Fatalf("expected %s to fail validation", bad)
+		}
+	}
+}
+
+func TestResponseFormatFallsBackToInstruction(t *testing.T) {
+	gpt := &ChatGPT{}
+	schema := &ResponseSchema{Name: "role_output", Schema: json.RawMessage(todoSchema)}
+	msg := []Messages{{Role: "user", Content: "hi"}}
+	body := gpt.newRequestBody(msg, Fresh, "openai/gpt-4o", ChatOptions{ResponseSchema: schema}, nil).
+		forModel("openai/gpt-4o")
+	if body.ResponseFormat == nil || len(body.Messages) != 1 {
+		t.Fatalf("expected json_schema response_format, got %+v", body)
+	}
+	body = gpt.newRequestBody(msg, Fresh, "anthropic/claude-sonnet-4", ChatOptions{ResponseSchema: schema}, nil).
+		forModel("anthropic/claude-sonnet-4")
+	if body.ResponseFormat != nil || len(body.Messages) != 2 || len(msg) != 1 {
+		t.Fatalf("expected schema instruction for unsupported model, got %+v", body)
+	}
+}
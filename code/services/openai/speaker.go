@@ -0,0 +1,21 @@
+package openai
+
+// withSpeakers 群聊话题里有多人提问时，在用户消息前加上提问人的名字，让模型分清谁说了什么；
+// 只影响发送给模型的内容，会话历史中保留原始问题
+func withSpeakers(msg []Messages) []Messages {
+	var out []Messages
+	for i, m := range msg {
+		if m.Role != "user" || m.Speaker == "" {
+			continue
+		}
+		if out == nil {
+			out = make([]Messages, len(msg))
+			copy(out, msg)
+		}
+		out[i].Content = "【" + m.Speaker + "】" + m.Content
+	}
+	if out == nil {
+		return msg
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package openai
+
+import "testing"
+
+func TestWithSpeakers(t *testing.T) {
+	msg := []Messages{
+		{Role: "system", Content: "sys", Speaker: "ignored"},
+		{Role: "user", Content: "这个接口谁负责？", Speaker: "张三"},
+		{Role: "assistant", Content: "支付团队"},
+		{Role: "user", Content: "那我去问问"},
+	}
+	got := withSpeakers(msg)
+	if got[0].Content != "sys" || got[1].Content != "【张三】这个接口谁负责？" || got[3].Content != "那我去问问" {
+		t.Fatalf("unexpected request messages %+v", got)
+	}
+	if msg[1].Content != "这个接口谁负责？" {
+		t.Fatal("history must keep the original question")
+	}
+	plain := []Messages{{Role: "user", Content: "hi"}}
+	if got := withSpeakers(plain); &got[0] != &plain[0] {
+		t.Fatal("messages without speakers should be sent as is")
+	}
+}
@@ -1,26 +1,33 @@
 package openai
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	go_openai "github.com/sashabaranov/go-openai"
 	"io"
+	"io/ioutil"
+	"strings"
+
+	"start-feishubot/logger"
+
+	go_openai "github.com/sashabaranov/go-openai"
 )
 
 func (c *ChatGPT) StreamChat(ctx context.Context,
 	msg []Messages, mode AIMode,
 	responseStream chan string) error {
-	//change msg type from Messages to openai.ChatCompletionMessage
-	chatMsgs := make([]go_openai.ChatCompletionMessage, len(msg))
-	for i, m := range msg {
-		chatMsgs[i] = go_openai.ChatCompletionMessage{
-			Role:    m.Role,
-			Content: m.Content,
-		}
-	}
-	return c.StreamChatWithHistory(ctx, chatMsgs, 2000, mode,
-		responseStream)
+	_, err := c.StreamChatWithModel(ctx, msg, mode, c.Model, responseStream)
+	return err
+}
+
+// StreamChatWithModel 使用指定模型进行流式对话，返回结束原因（stop、length 等）
+func (c *ChatGPT) StreamChatWithModel(ctx context.Context,
+	msg []Messages, mode AIMode, model string,
+	responseStream chan string) (finishReason string, err error) {
+	result, err := c.StreamChatWithOptions(ctx, msg, mode, model, responseStream, ChatOptions{})
+	return result.FinishReason, err
 }
 
 func (c *ChatGPT) StreamChatWithHistory(ctx context.Context,
@@ -28,60 +35,245 @@ func (c *ChatGPT) StreamChatWithHistory(ctx context.Context,
 	aiMode AIMode,
 	responseStream chan string,
 ) error {
+	chatMsgs := make([]Messages, len(msg))
+	for i, m := range msg {
+		chatMsgs[i] = Messages{Role: m.Role, Content: m.Content}
+	}
+	body := c.newRequestBody(chatMsgs, aiMode, c.Model, ChatOptions{}, nil)
+	body.MaxTokens = maxTokens
+	_, err := c.streamChat(ctx, body.forModel(c.Model), responseStream, nil)
+	return err
+}
 
-	config := go_openai.DefaultConfig(c.ApiKey[0])
-	config.BaseURL = c.ApiUrl + "/v1"
-	if c.Platform != OpenAI {
-		baseUrl := fmt.Sprintf("https://%s.%s",
-			c.AzureConfig.ResourceName, "openai.azure.com")
-		config = go_openai.DefaultAzureConfig(c.AzureConfig.
-			ApiToken, baseUrl)
-		config.AzureModelMapperFunc = func(model string) string {
-			return c.AzureConfig.DeploymentName
+// StreamResult 一次流式对话的结果
+type StreamResult struct {
+	FinishReason string
+	ToolRecords  []ToolCallRecord
+	// Reasoning 完整的思考过程
+	Reasoning string
+	// Model 实际回答的模型，FallbackFrom 发生降级时原本选择的模型
+	Model        string
+	FallbackFrom string
+}
 
+// StreamChatWithOptions 流式对话，正文增量写入 responseStream。
+// 提供了工具时，模型请求调用工具则执行并把结果写回后继续生成；
+// 推理模型的思考过程通过 OnReasoning 回调输出，不写入 responseStream
+func (c *ChatGPT) StreamChatWithOptions(ctx context.Context,
+	msg []Messages, mode AIMode, model string,
+	responseStream chan string, opts ChatOptions) (result StreamResult, err error) {
+	ctx = WithReferenceNumbering(ctx, nil)
+	record := func(r ToolCallRecord) {
+		result.ToolRecords = append(result.ToolRecords, r)
+		if opts.OnToolCall != nil {
+			opts.OnToolCall(r)
 		}
 	}
+	var reasoning strings.Builder
+	onReasoning := func(s string) {
+		reasoning.WriteString(s)
+		if opts.OnReasoning != nil {
+			opts.OnReasoning(s)
+		}
+	}
+	requested := model
+	msg = append([]Messages{}, msg...)
+	for round := 0; ; round++ {
+		var tools []Tool
+		if opts.Tools != nil && round < maxToolRounds {
+			tools = opts.Tools.Tools()
+		}
+		body := c.newRequestBody(msg, mode, model, opts, tools)
+		reply, err := c.streamChatWithFallback(ctx, body, responseStream, onReasoning, !opts.NoFallback)
+		if reply.Model != "" {
+			model = reply.Model
+		}
+		result.Model = model
+		if model != requested {
+			result.FallbackFrom = requested
+		}
+		result.FinishReason = reply.finishReason
+		result.Reasoning = strings.TrimSpace(reasoning.String())
+		if err != nil || len(reply.ToolCalls) == 0 {
+			return result, err
+		}
+		msg = append(msg, reply.Messages)
+		msg = append(msg, runToolCalls(ctx, opts.Tools, reply.ToolCalls, record)...)
+	}
+}
 
-	proxyClient, parseProxyError := GetProxyClient(c.HttpProxy)
-	if parseProxyError != nil {
-		return parseProxyError
+// streamChunk 流式响应中的一个数据块
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string     `json:"content"`
+			Reasoning        string     `json:"reasoning"`
+			ReasoningContent string     `json:"reasoning_content"`
+			ToolCalls        []ToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type streamReply struct {
+	Messages
+	finishReason string
+	// started 是否已经输出过正文或思考过程，输出之后失败不能再换模型重试
+	started bool
+}
+
+// streamChatWithFallback 流式请求失败且还没有任何输出时，按降级链换用其它模型，
+// 返回的 reply.Model 为实际回答的模型
+func (c *ChatGPT) streamChatWithFallback(ctx context.Context, requestBody ChatGPTRequestBody,
+	responseStream chan string, onReasoning func(string), fallback bool,
+) (reply streamReply, err error) {
+	chain := []string{requestBody.Model}
+	if fallback {
+		chain = c.ModelChain(requestBody.Model)
+	}
+	for i, model := range chain {
+		reply, err = c.streamChat(ctx, requestBody.forModel(model), responseStream, onReasoning)
+		reply.Model = model
+		if err == nil || reply.started || ctx.Err() != nil || i+1 == len(chain) {
+			return reply, err
+		}
+		logger.Warnf("⚠️ 模型 %s 流式请求失败: %v，切换到降级模型 %s", model, err, chain[i+1])
 	}
-	config.HTTPClient = proxyClient
+	return reply, err
+}
 
-	client := go_openai.NewClientWithConfig(config)
-	//pp.Printf("client: %v", client)
-	//turn aimode to float64()
-	var temperature float32
-	temperature = float32(aiMode)
-	req := go_openai.ChatCompletionRequest{
-		Model:       c.Model,
-		Messages:    msg,
-		N:           1,
-		Temperature: temperature,
-		MaxTokens:   maxTokens,
-		//TopP:        1,
-		//Moderation:     true,
-		//ModerationStop: true,
+// streamChat 发起一次流式请求，正文增量写入 responseStream，思考过程交给 onReasoning，
+// 返回完整的 assistant 消息（含拼接好的工具调用）
+func (c *ChatGPT) streamChat(ctx context.Context, requestBody ChatGPTRequestBody,
+	responseStream chan string, onReasoning func(string),
+) (reply streamReply, err error) {
+	requestBody.Stream = true
+	body, err := json.Marshal(requestBody)
+	if err != nil {
+		return reply, err
 	}
-	stream, err := client.CreateChatCompletionStream(ctx, req)
+	response, err := c.Forward(ctx, "chat/completions", body)
 	if err != nil {
-		fmt.Errorf("CreateCompletionStream returned error: %v", err)
+		return reply, fmt.Errorf("CreateCompletionStream returned error: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		errBody, _ := ioutil.ReadAll(response.Body)
+		return reply, fmt.Errorf("CreateCompletionStream returned error: status %d: %s",
+			response.StatusCode, errBody)
 	}
 
-	defer stream.Close()
-	for {
-		response, err := stream.Recv()
-		fmt.Println("response: ", response)
-		if errors.Is(err, io.EOF) {
-			//fmt.Println("Stream finished")
+	reply.Role = "assistant"
+	var content strings.Builder
+	var calls []ToolCall
+	var think thinkSplitter
+	// emit 输出一段思考过程和正文，ctx 被取消（例如用户点击停止）时不再阻塞在发送上
+	emit := func(reasoning, text string) error {
+		if reasoning != "" {
+			reply.started = true
+			if onReasoning != nil {
+				onReasoning(reasoning)
+			}
+		}
+		if text == "" {
 			return nil
 		}
-		if err != nil {
-			fmt.Printf("Stream error: %v\n", err)
-			return err
+		reply.started = true
+		content.WriteString(text)
+		select {
+		case responseStream <- text:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		responseStream <- response.Choices[0].Delta.Content
 	}
-	return nil
+	reader := bufio.NewReader(response.Body)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && !(errors.Is(readErr, io.EOF) && line != "") {
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+			if ctx.Err() != nil {
+				readErr = ctx.Err()
+			}
+			reply.Content = content.String()
+			return reply, readErr
+		}
+		data, ok := cutSSEData(line)
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			reply.Content = content.String()
+			return reply, errors.New(chunk.Error.Message)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			reply.finishReason = choice.FinishReason
+		}
+		calls = mergeToolCallDeltas(calls, choice.Delta.ToolCalls)
+		reasoning := choice.Delta.ReasoningContent + choice.Delta.Reasoning
+		thinkReasoning, text := think.push(choice.Delta.Content)
+		if err := emit(reasoning+thinkReasoning, text); err != nil {
+			reply.Content = content.String()
+			return reply, err
+		}
+	}
+	if err := emit(think.flush()); err != nil {
+		reply.Content = content.String()
+		return reply, err
+	}
+	reply.Content = content.String()
+	reply.ToolCalls = calls
+	return reply, nil
+}
+
+// cutSSEData 取出 SSE 中 data 行的内容
+func cutSSEData(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "data:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+}
 
+// mergeToolCallDeltas 把流式返回的工具调用片段按 index 拼接成完整调用
+func mergeToolCallDeltas(calls []ToolCall, deltas []ToolCall) []ToolCall {
+	for _, d := range deltas {
+		i := len(calls) - 1
+		if d.Index != nil {
+			i = *d.Index
+		} else if d.ID != "" {
+			i = len(calls)
+		}
+		if i < 0 {
+			i = 0
+		}
+		for len(calls) <= i {
+			calls = append(calls, ToolCall{Type: "function"})
+		}
+		if d.ID != "" {
+			calls[i].ID = d.ID
+		}
+		if d.Type != "" {
+			calls[i].Type = d.Type
+		}
+		calls[i].Function.Name += d.Function.Name
+		calls[i].Function.Arguments += d.Function.Arguments
+	}
+	return calls
 }
@@ -0,0 +1,236 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Tool 提供给模型的函数工具，格式与 OpenAI tools 参数一致
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall 模型发起的一次工具调用
+type ToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolExecutor 工具来源（MCP、HTTP 插件等），列出可用工具并执行调用
+type ToolExecutor interface {
+	Tools() []Tool
+	Call(ctx context.Context, name string, arguments string) (string, error)
+}
+
+// Reference 工具结果引用的来源，例如搜索结果的网页
+type Reference struct {
+	Title string
+	URL   string
+}
+
+// ReferenceToolExecutor 能返回参考来源的工具，卡片中会列出这些来源
+type ReferenceToolExecutor interface {
+	ToolExecutor
+	CallWithReferences(ctx context.Context, name string, arguments string) (string, []Reference, error)
+}
+
+// ToolCallRecord 一次工具调用的记录，用于在卡片中展示
+type ToolCallRecord struct {
+	Name       string
+	Arguments  string
+	Result     string
+	References []Reference
+	Err        error
+}
+
+// Summary 卡片中展示的单行摘要
+func (r ToolCallRecord) Summary() string {
+	status := "✅"
+	if r.Err != nil {
+		status = "❌"
+	}
+	args := strings.Join(strings.Fields(r.Arguments), " ")
+	if runes := []rune(args); len(runes) > 40 {
+		args = string(runes[:40]) + "…"
+	}
+	return fmt.Sprintf("%s `%s` %s", status, r.Name, args)
+}
+
+// MultiToolExecutor 把多个工具来源合并成一个，按工具名分发调用
+type MultiToolExecutor []ToolExecutor
+
+func (m MultiToolExecutor) Tools() []Tool {
+	var tools []Tool
+	for _, e := range m {
+		tools = append(tools, e.Tools()...)
+	}
+	return tools
+}
+
+func (m MultiToolExecutor) Call(ctx context.Context, name string, arguments string) (string, error) {
+	result, _, err := m.CallWithReferences(ctx, name, arguments)
+	return result, err
+}
+
+func (m MultiToolExecutor) CallWithReferences(ctx context.Context, name string,
+	arguments string) (string, []Reference, error) {
+	for _, e := range m {
+		for _, t := range e.Tools() {
+			if t.Function.Name == name {
+				return callTool(ctx, e, name, arguments)
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("未知工具: %s", name)
+}
+
+// callTool 执行一次工具调用，支持时一并取回参考来源
+func callTool(ctx context.Context, executor ToolExecutor, name string,
+	arguments string) (string, []Reference, error) {
+	if e, ok := executor.(ReferenceToolExecutor); ok {
+		return e.CallWithReferences(ctx, name, arguments)
+	}
+	result, err := executor.Call(ctx, name, arguments)
+	return result, nil, err
+}
+
+// References 汇总多次工具调用的参考来源，按链接去重
+func References(records []ToolCallRecord) []Reference {
+	var refs []Reference
+	seen := make(map[string]bool)
+	for _, r := range records {
+		for _, ref := range r.References {
+			if !seen[ref.URL] {
+				seen[ref.URL] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// ReferenceNumbering 一轮对话中参考来源的编号。多次搜索的结果按链接连续编号，
+// 重复的链接沿用第一次的编号，与 References 合并去重后的顺序一致
+type ReferenceNumbering struct {
+	mu    sync.Mutex
+	index map[string]int
+}
+
+// Number 链接的编号，第一次出现时分配下一个编号
+func (n *ReferenceNumbering) Number(url string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.index == nil {
+		n.index = make(map[string]int)
+	}
+	if i, ok := n.index[url]; ok {
+		return i
+	}
+	n.index[url] = len(n.index) + 1
+	return n.index[url]
+}
+
+type referenceNumberingKey struct{}
+
+// WithReferenceNumbering 为一轮对话准备参考来源编号，records 是请求前已有的工具结果（如 /search），
+// 它们的来源先占用编号。ctx 中已有编号时原样返回
+func WithReferenceNumbering(ctx context.Context, records []ToolCallRecord) context.Context {
+	if _, ok := ctx.Value(referenceNumberingKey{}).(*ReferenceNumbering); ok {
+		return ctx
+	}
+	numbering := &ReferenceNumbering{}
+	for _, ref := range References(records) {
+		numbering.Number(ref.URL)
+	}
+	return context.WithValue(ctx, referenceNumberingKey{}, numbering)
+}
+
+// ReferenceNumberingFrom 取出本轮对话的参考来源编号，没有时返回一个新的，从1开始编号
+func ReferenceNumberingFrom(ctx context.Context) *ReferenceNumbering {
+	if numbering, ok := ctx.Value(referenceNumberingKey{}).(*ReferenceNumbering); ok {
+		return numbering
+	}
+	return &ReferenceNumbering{}
+}
+
+// maxToolRounds 单轮对话中最多连续调用工具的次数，超过后不再提供工具，要求模型直接回答
+const maxToolRounds = 5
+
+// maxToolResultLength 工具结果写回上下文时的长度上限
+const maxToolResultLength = 8000
+
+// runToolCalls 依次执行模型发起的工具调用，返回写回上下文的 tool 消息
+func runToolCalls(ctx context.Context, executor ToolExecutor, calls []ToolCall,
+	onCall func(ToolCallRecord)) []Messages {
+	var results []Messages
+	for _, call := range calls {
+		record := ToolCallRecord{Name: call.Function.Name, Arguments: call.Function.Arguments}
+		record.Result, record.References, record.Err = callTool(ctx, executor,
+			call.Function.Name, call.Function.Arguments)
+		content := record.Result
+		if record.Err != nil {
+			content = "工具调用失败: " + record.Err.Error()
+		}
+		if runes := []rune(content); len(runes) > maxToolResultLength {
+			content = string(runes[:maxToolResultLength]) + "\n（结果过长，已截断）"
+		}
+		if onCall != nil {
+			onCall(record)
+		}
+		results = append(results, Messages{
+			Role: "tool", Content: content, ToolCallID: call.ID,
+		})
+	}
+	return results
+}
+
+// CompletionsWithOptions 非流式对话。提供了工具时，模型请求调用工具则执行并把结果写回，
+// 直到模型给出最终回答
+func (gpt *ChatGPT) CompletionsWithOptions(ctx context.Context, msg []Messages, aiMode AIMode,
+	model string, opts ChatOptions) (resp Messages, err error) {
+	ctx = WithReferenceNumbering(ctx, nil)
+	var records []ToolCallRecord
+	record := func(r ToolCallRecord) {
+		records = append(records, r)
+		if opts.OnToolCall != nil {
+			opts.OnToolCall(r)
+		}
+	}
+	requested := model
+	msg = append([]Messages{}, msg...)
+	for round := 0; ; round++ {
+		var tools []Tool
+		if opts.Tools != nil && round < maxToolRounds {
+			tools = opts.Tools.Tools()
+		}
+		resp, err = gpt.completions(gpt.newRequestBody(msg, aiMode, model, opts, tools), !opts.NoFallback)
+		if err == nil && resp.Model != requested {
+			// 降级后的后续轮次继续使用能正常回答的模型
+			model = resp.Model
+			resp.FallbackFrom = requested
+		}
+		if err != nil || len(resp.ToolCalls) == 0 {
+			resp.ToolRecords = records
+			return resp, err
+		}
+		msg = append(msg, resp)
+		msg = append(msg, runToolCalls(ctx, opts.Tools, resp.ToolCalls, record)...)
+	}
+}
@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"start-feishubot/services/loadbalancer"
+)
+
+type echoTools struct{}
+
+func (echoTools) Tools() []Tool {
+	return []Tool{{Type: "function", Function: ToolFunction{Name: "echo"}}}
+}
+
+func (echoTools) Call(ctx context.Context, name string, arguments string) (string, error) {
+	return "echo:" + arguments, nil
+}
+
+// 第一轮流式返回分片的工具调用，第二轮根据工具结果给出回答
+func TestStreamChatRunsToolCalls(t *testing.T) {
+	var requests []ChatGPTRequestBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var body ChatGPTRequestBody
+		json.Unmarshal(data, &body)
+		requests = append(requests, body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if len(requests) == 1 {
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"echo","arguments":"{\"a\""}}]}}]}`+"\n\n")
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]},"finish_reason":"tool_calls"}]}`+"\n\n")
+		} else {
+			fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"done"},"finish_reason":"stop"}]}`+"\n\n")
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	gpt := &ChatGPT{
+		Lb:       loadbalancer.NewLoadBalancer([]string{"sk-test"}),
+		ApiUrl:   server.URL,
+		Platform: OpenRouter,
+	}
+
+	stream := make(chan string, 10)
+	result, err := gpt.StreamChatWithOptions(context.Background(),
+		[]Messages{{Role: "user", Content: "hi"}}, Balance, "m", stream, ChatOptions{Tools: echoTools{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FinishReason != "stop" || len(result.ToolRecords) != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if got := result.ToolRecords[0].Result; got != `echo:{"a":1}` {
+		t.Fatalf("tool call arguments were not merged, got %q", got)
+	}
+	if len(requests) != 2 || len(requests[1].Messages) != 3 ||
+		requests[1].Messages[2].Role != "tool" || requests[1].Messages[2].ToolCallID != "call_1" {
+		t.Fatalf("tool result was not sent back: %+v", requests)
+	}
+	if got := <-stream; got != "done" {
+		t.Fatalf("expected streamed answer, got %q", got)
+	}
+}
@@ -43,7 +43,7 @@ func (gpt *ChatGPT) GetVisionInfo(msg []VisionMessages) (
 	//fmt.Println("model", gpt.Model)
 	err = gpt.sendRequestWithBodyType(url, "POST", jsonBody, requestBody, gptResponseBody)
 	if err == nil && len(gptResponseBody.Choices) > 0 {
-		resp = gptResponseBody.Choices[0].Message
+		resp = gptResponseBody.Choices[0].Message.toMessages()
 	} else {
 		logger.Errorf("ERROR %v", err)
 		resp = Messages{}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// searxng 自建的 SearXNG 实例，需要在 settings.yml 中开启 json 格式
+type searxng struct {
+	baseUrl string
+	client  *http.Client
+}
+
+func (s *searxng) Name() string { return ProviderSearXNG }
+
+func (s *searxng) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	req, err := http.NewRequest(http.MethodGet, s.baseUrl+"/search?"+url.Values{
+		"q": {query}, "format": {"json"},
+	}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := getJSON(ctx, s.client, req, &resp); err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, r := range resp.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return truncate(results, limit), nil
+}
+
+// bing Bing Web Search API
+type bing struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+func (b *bing) Name() string { return ProviderBing }
+
+func (b *bing) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	req, err := http.NewRequest(http.MethodGet, b.url+"?"+url.Values{
+		"q": {query}, "count": {strconv.Itoa(limit)},
+	}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", b.key)
+	var resp struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := getJSON(ctx, b.client, req, &resp); err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, r := range resp.WebPages.Value {
+		results = append(results, Result{Title: r.Name, URL: r.URL, Snippet: r.Snippet})
+	}
+	return truncate(results, limit), nil
+}
+
+// custom 内部搜索服务：GET url?q=关键词&limit=条数，
+// 返回 {"results":[{"title":"","url":"","snippet":""}]}，配置了 key 时以 Bearer 方式鉴权
+type custom struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+func (c *custom) Name() string { return ProviderCustom }
+
+func (c *custom) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url+"?"+url.Values{
+		"q": {query}, "limit": {strconv.Itoa(limit)},
+	}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+	var resp struct {
+		Results []Result `json:"results"`
+	}
+	if err := getJSON(ctx, c.client, req, &resp); err != nil {
+		return nil, err
+	}
+	return truncate(resp.Results, limit), nil
+}
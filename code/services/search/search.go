@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+)
+
+// Result 一条搜索结果
+type Result struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// Provider 搜索服务
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]Result, error)
+}
+
+const (
+	ProviderSearXNG = "searxng"
+	ProviderBing    = "bing"
+	ProviderCustom  = "custom"
+)
+
+// New 按配置创建搜索服务，未配置 SEARCH_PROVIDER 时返回 nil
+func New(config initialization.Config) (Provider, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	switch strings.ToLower(config.SearchProvider) {
+	case "":
+		return nil, nil
+	case ProviderSearXNG:
+		if config.SearchApiUrl == "" {
+			return nil, errors.New("SearXNG 需要配置 SEARCH_API_URL")
+		}
+		return &searxng{baseUrl: strings.TrimRight(config.SearchApiUrl, "/"), client: client}, nil
+	case ProviderBing:
+		if config.SearchApiKey == "" {
+			return nil, errors.New("Bing 搜索需要配置 SEARCH_API_KEY")
+		}
+		url := config.SearchApiUrl
+		if url == "" {
+			url = "https://api.bing.microsoft.com/v7.0/search"
+		}
+		return &bing{url: url, key: config.SearchApiKey, client: client}, nil
+	case ProviderCustom:
+		if config.SearchApiUrl == "" {
+			return nil, errors.New("自定义搜索需要配置 SEARCH_API_URL")
+		}
+		return &custom{url: config.SearchApiUrl, key: config.SearchApiKey, client: client}, nil
+	}
+	return nil, fmt.Errorf("不支持的搜索服务: %s", config.SearchProvider)
+}
+
+func getJSON(ctx context.Context, client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func truncate(results []Result, limit int) []Result {
+	if limit > 0 && len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
+
+// Format 把搜索结果整理成提供给模型的文本，编号由 numbering 按链接分配，
+// 同一轮对话中多次搜索的编号连续，与卡片中合并后的参考来源一致
+func Format(results []Result, numbering *openai.ReferenceNumbering) string {
+	if len(results) == 0 {
+		return "没有找到相关结果"
+	}
+	var b strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n%s\n\n", numbering.Number(r.URL), r.Title, r.URL, r.Snippet)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// References 搜索结果对应的参考来源
+func References(results []Result) []openai.Reference {
+	refs := make([]openai.Reference, len(results))
+	for i, r := range results {
+		refs[i] = openai.Reference{Title: r.Title, URL: r.URL}
+	}
+	return refs
+}
@@ -0,0 +1,62 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/openai"
+)
+
+func TestSearXNGTool(t *testing.T) {
+	var gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("q")
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]string{
+			{"title": "Go 1.22 发布", "url": "https://go.dev/blog/go1.22", "content": "range over int"},
+			{"title": "Release notes", "url": "https://go.dev/doc/go1.22", "content": "..."},
+			{"title": "third", "url": "https://example.com", "content": "..."},
+		}})
+	}))
+	defer server.Close()
+
+	provider, err := New(initialization.Config{SearchProvider: "searxng", SearchApiUrl: server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := &Tool{Provider: provider, Limit: 2}
+	text, refs, err := tool.CallWithReferences(context.Background(), ToolName, `{"query":"go 1.22"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotQuery != "go 1.22" {
+		t.Fatalf("unexpected query %q", gotQuery)
+	}
+	if len(refs) != 2 || refs[0].URL != "https://go.dev/blog/go1.22" {
+		t.Fatalf("unexpected references %+v", refs)
+	}
+	if text != "[1] Go 1.22 发布\nhttps://go.dev/blog/go1.22\nrange over int\n\n[2] Release notes\nhttps://go.dev/doc/go1.22\n..." {
+		t.Fatalf("unexpected text %q", text)
+	}
+}
+
+// 同一轮对话中多次搜索的编号连续，重复的链接沿用第一次的编号，与卡片中合并后的参考来源一致
+func TestFormatNumbersAcrossCalls(t *testing.T) {
+	first := []Result{{Title: "a", URL: "https://a"}, {Title: "b", URL: "https://b"}}
+	second := []Result{{Title: "b", URL: "https://b"}, {Title: "c", URL: "https://c"}}
+	records := []openai.ToolCallRecord{{References: References(first)}}
+	ctx := openai.WithReferenceNumbering(context.Background(), records)
+
+	text := Format(second, openai.ReferenceNumberingFrom(ctx))
+	if text != "[2] b\nhttps://b\n\n\n[3] c\nhttps://c" {
+		t.Fatalf("unexpected text %q", text)
+	}
+	records = append(records, openai.ToolCallRecord{References: References(second)})
+	refs := openai.References(records)
+	if len(refs) != 3 || refs[1].URL != "https://b" || refs[2].URL != "https://c" {
+		t.Fatalf("card references do not match numbering: %+v", refs)
+	}
+}
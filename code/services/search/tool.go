@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"start-feishubot/services/openai"
+)
+
+// ToolName 提供给模型的搜索工具名，同时作为群内开关的名称
+const ToolName = "web_search"
+
+// Tool 把搜索服务包装成模型可调用的工具
+type Tool struct {
+	Provider Provider
+	Limit    int
+}
+
+func (t *Tool) Tools() []openai.Tool {
+	return []openai.Tool{{
+		Type: "function",
+		Function: openai.ToolFunction{
+			Name: ToolName,
+			Description: "搜索互联网获取最新信息。问题涉及近期事件、实时数据或你不确定的事实时使用，" +
+				"回答时用 [编号] 标注引用的来源",
+			Parameters: json.RawMessage(`{"type":"object","properties":{"query":` +
+				`{"type":"string","description":"搜索关键词"}},"required":["query"]}`),
+		},
+	}}
+}
+
+func (t *Tool) Call(ctx context.Context, name string, arguments string) (string, error) {
+	result, _, err := t.CallWithReferences(ctx, name, arguments)
+	return result, err
+}
+
+func (t *Tool) CallWithReferences(ctx context.Context, name string,
+	arguments string) (string, []openai.Reference, error) {
+	if name != ToolName {
+		return "", nil, fmt.Errorf("未知工具: %s", name)
+	}
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", nil, err
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", nil, errors.New("搜索关键词为空")
+	}
+	results, err := t.Provider.Search(ctx, args.Query, t.Limit)
+	if err != nil {
+		return "", nil, err
+	}
+	return Format(results, openai.ReferenceNumberingFrom(ctx)), References(results), nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"start-feishubot/services/openai"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -11,6 +12,9 @@ type SessionMode string
 type VisionDetail string
 type SessionService struct {
 	cache *cache.Cache
+	// mu 保护 SessionMeta 字段的读写，locks 用于串行化同一会话的整轮对话
+	mu    sync.Mutex
+	locks *sessionLocker
 }
 type PicSetting struct {
 	resolution Resolution
@@ -20,13 +24,20 @@ type Resolution string
 type PicStyle string
 
 type SessionMeta struct {
-	Mode          SessionMode       `json:"mode"`
-	Msg           []openai.Messages `json:"msg,omitempty"`
-	PicSetting    PicSetting        `json:"pic_setting,omitempty"`
-	AIMode        openai.AIMode     `json:"ai_mode,omitempty"`
-	VisionDetail  VisionDetail      `json:"vision_detail,omitempty"`
-	CurrentModel  string            `json:"current_model,omitempty"`  // 当前选择的模型
-	CompareMode   bool              `json:"compare_mode,omitempty"`   // 是否处于对比模式
+	Mode         SessionMode       `json:"mode"`
+	Msg          []openai.Messages `json:"msg,omitempty"`
+	PicSetting   PicSetting        `json:"pic_setting,omitempty"`
+	AIMode       openai.AIMode     `json:"ai_mode,omitempty"`
+	VisionDetail VisionDetail      `json:"vision_detail,omitempty"`
+	CurrentModel string            `json:"current_model,omitempty"` // 当前选择的模型
+	CompareMode  bool              `json:"compare_mode,omitempty"`  // 是否处于对比模式
+	Tree         *MsgTree          `json:"tree,omitempty"`          // 完整的分支历史，Msg 为当前分支
+	// ReasoningEffort 推理模型的推理强度，为空时使用模型默认值
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// Params 通过 /params 设置的生成参数
+	Params openai.GenParams `json:"params,omitempty"`
+	// ResponseSchema 当前角色要求的结构化输出
+	ResponseSchema *openai.ResponseSchema `json:"response_schema,omitempty"`
 }
 
 const (
@@ -70,28 +81,56 @@ type SessionServiceCacheInterface interface {
 	SetCurrentModel(sessionId string, model string)
 	GetCompareMode(sessionId string) bool
 	SetCompareMode(sessionId string, compareMode bool)
+	GetReasoningEffort(sessionId string) string
+	SetReasoningEffort(sessionId string, effort string)
+	GetParams(sessionId string) openai.GenParams
+	SetParams(sessionId string, params openai.GenParams)
+	GetResponseSchema(sessionId string) *openai.ResponseSchema
+	SetResponseSchema(sessionId string, schema *openai.ResponseSchema)
 	Clear(sessionId string)
+	// LockSession 独占某个会话直到返回的 unlock 被调用，
+	// 用于包住 GetMsg → 请求模型 → SetMsg 这一整轮读改写
+	LockSession(sessionId string) (unlock func())
+	// GetBranches 列出会话的所有分支
+	GetBranches(sessionId string) []Branch
+	// SwitchBranch 把当前分支切换到以 leafId 结尾的分支
+	SwitchBranch(sessionId string, leafId string) bool
+	// ForkAt 回到某条消息之前，下一条消息将作为它的兄弟节点开辟新分支
+	ForkAt(sessionId string, msgId string) bool
+	// FindQuestion 根据飞书消息ID（提问或回答卡片）找到对应的提问
+	FindQuestion(sessionId string, feishuMsgId string) (MsgNode, bool)
 }
 
-var sessionServices *SessionService
+var (
+	sessionServices     *SessionService
+	sessionServicesOnce sync.Once
+)
 
 // implement Get interface
 func (s *SessionService) Get(sessionId string) *SessionMeta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return nil
 	}
-	sessionMeta := sessionContext.(*SessionMeta)
-	return sessionMeta
+	// 返回副本，避免调用方绕过锁直接修改缓存中的会话
+	sessionMeta := *sessionContext.(*SessionMeta)
+	sessionMeta.Msg = copyMsg(sessionMeta.Msg)
+	return &sessionMeta
 }
 
 // implement Set interface
 func (s *SessionService) Set(sessionId string, sessionMeta *SessionMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 }
 
 func (s *SessionService) GetMode(sessionId string) SessionMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// Get the session mode from the cache.
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -102,6 +141,8 @@ func (s *SessionService) GetMode(sessionId string) SessionMode {
 }
 
 func (s *SessionService) SetMode(sessionId string, mode SessionMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -115,6 +156,8 @@ func (s *SessionService) SetMode(sessionId string, mode SessionMode) {
 }
 
 func (s *SessionService) GetAIMode(sessionId string) openai.AIMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return openai.Balance
@@ -125,6 +168,8 @@ func (s *SessionService) GetAIMode(sessionId string) openai.AIMode {
 
 // SetAIMode set the ai mode for the session.
 func (s *SessionService) SetAIMode(sessionId string, aiMode openai.AIMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -137,36 +182,199 @@ func (s *SessionService) SetAIMode(sessionId string, aiMode openai.AIMode) {
 	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 }
 
+// GetReasoningEffort 获取推理强度，未设置时返回空字符串
+func (s *SessionService) GetReasoningEffort(sessionId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return ""
+	}
+	return sessionContext.(*SessionMeta).ReasoningEffort
+}
+
+// SetReasoningEffort 设置推理强度，空字符串表示恢复模型默认值
+func (s *SessionService) SetReasoningEffort(sessionId string, effort string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		s.cache.Set(sessionId, &SessionMeta{ReasoningEffort: effort}, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.ReasoningEffort = effort
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+// GetParams 获取会话的生成参数
+func (s *SessionService) GetParams(sessionId string) openai.GenParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return openai.GenParams{}
+	}
+	return sessionContext.(*SessionMeta).Params
+}
+
+// SetParams 设置会话的生成参数，传入零值表示全部恢复默认
+func (s *SessionService) SetParams(sessionId string, params openai.GenParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		s.cache.Set(sessionId, &SessionMeta{Params: params}, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.Params = params
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
+// GetResponseSchema 获取当前角色要求的结构化输出，没有时返回 nil
+func (s *SessionService) GetResponseSchema(sessionId string) *openai.ResponseSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return nil
+	}
+	return sessionContext.(*SessionMeta).ResponseSchema
+}
+
+// SetResponseSchema 设置结构化输出，传入 nil 表示取消
+func (s *SessionService) SetResponseSchema(sessionId string, schema *openai.ResponseSchema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maxCacheTime := time.Hour * 12
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		s.cache.Set(sessionId, &SessionMeta{ResponseSchema: schema}, maxCacheTime)
+		return
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	sessionMeta.ResponseSchema = schema
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+}
+
 func (s *SessionService) GetMsg(sessionId string) (msg []openai.Messages) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return nil
 	}
 	sessionMeta := sessionContext.(*SessionMeta)
-	return sessionMeta.Msg
+	return copyMsg(sessionMeta.Msg)
 }
 
 func (s *SessionService) SetMsg(sessionId string, msg []openai.Messages) {
-	maxLength := 4096
 	maxCacheTime := time.Hour * 12
 
 	//限制对话上下文长度
-	for getStrPoolTotalLength(msg) > maxLength {
-		msg = append(msg[:1], msg[2:]...)
+	msg = copyMsg(msg)
+	// 思考过程只在卡片中展示，不进入历史
+	for i := range msg {
+		msg[i].Reasoning = ""
 	}
+	msg = trimMsg(msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
-		sessionMeta := &SessionMeta{Msg: msg}
+		sessionMeta := &SessionMeta{Tree: newMsgTree()}
+		sessionMeta.Tree.sync(msg)
+		sessionMeta.Msg = msg
 		s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 		return
 	}
 	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.Tree == nil {
+		sessionMeta.Tree = newMsgTree()
+	}
+	sessionMeta.Tree.sync(msg)
 	sessionMeta.Msg = msg
 	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 }
 
+// GetBranches 列出会话的所有分支
+func (s *SessionService) GetBranches(sessionId string) []Branch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return nil
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.Tree == nil {
+		return nil
+	}
+	return sessionMeta.Tree.Branches()
+}
+
+// SwitchBranch 切换到以 leafId 结尾的分支
+func (s *SessionService) SwitchBranch(sessionId string, leafId string) bool {
+	return s.moveHead(sessionId, leafId, false)
+}
+
+// ForkAt 把当前分支退回到 msgId 的父节点
+func (s *SessionService) ForkAt(sessionId string, msgId string) bool {
+	return s.moveHead(sessionId, msgId, true)
+}
+
+// FindQuestion 根据飞书消息ID找到对应的提问
+func (s *SessionService) FindQuestion(sessionId string, feishuMsgId string) (MsgNode, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok || feishuMsgId == "" {
+		return MsgNode{}, false
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.Tree == nil {
+		return MsgNode{}, false
+	}
+	node, ok := sessionMeta.Tree.findQuestion(feishuMsgId)
+	if !ok {
+		return MsgNode{}, false
+	}
+	return *node, true
+}
+
+func (s *SessionService) moveHead(sessionId string, nodeId string, toParent bool) bool {
+	maxCacheTime := time.Hour * 12
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessionContext, ok := s.cache.Get(sessionId)
+	if !ok {
+		return false
+	}
+	sessionMeta := sessionContext.(*SessionMeta)
+	if sessionMeta.Tree == nil {
+		return false
+	}
+	node, ok := sessionMeta.Tree.Nodes[nodeId]
+	if !ok {
+		return false
+	}
+	head := node.ID
+	if toParent {
+		head = node.ParentID
+	}
+	sessionMeta.Tree.Head = head
+	sessionMeta.Msg = trimMsg(sessionMeta.Tree.Path(head))
+	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
+	return true
+}
+
 func (s *SessionService) SetPicStyle(sessionId string, style PicStyle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 
 	switch style {
@@ -187,6 +395,8 @@ func (s *SessionService) SetPicStyle(sessionId string, style PicStyle) {
 }
 
 func (s *SessionService) GetPicStyle(sessionId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return string(PicStyleVivid)
@@ -197,6 +407,8 @@ func (s *SessionService) GetPicStyle(sessionId string) string {
 
 func (s *SessionService) SetPicResolution(sessionId string,
 	resolution Resolution) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 
 	//if not in [Resolution256, Resolution512, Resolution1024] then set
@@ -219,6 +431,8 @@ func (s *SessionService) SetPicResolution(sessionId string,
 }
 
 func (s *SessionService) GetPicResolution(sessionId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return string(Resolution256)
@@ -229,11 +443,15 @@ func (s *SessionService) GetPicResolution(sessionId string) string {
 }
 
 func (s *SessionService) Clear(sessionId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// Delete the session context from the cache.
 	s.cache.Delete(sessionId)
 }
 
 func (s *SessionService) GetVisionDetail(sessionId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return ""
@@ -244,6 +462,8 @@ func (s *SessionService) GetVisionDetail(sessionId string) string {
 
 func (s *SessionService) SetVisionDetail(sessionId string,
 	visionDetail VisionDetail) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -257,14 +477,23 @@ func (s *SessionService) SetVisionDetail(sessionId string,
 }
 
 func GetSessionCache() SessionServiceCacheInterface {
-	if sessionServices == nil {
-		sessionServices = &SessionService{cache: cache.New(time.Hour*12, time.Hour*1)}
-	}
+	sessionServicesOnce.Do(func() {
+		sessionServices = newSessionService()
+	})
 	return sessionServices
 }
 
+func newSessionService() *SessionService {
+	return &SessionService{
+		cache: cache.New(time.Hour*12, time.Hour*1),
+		locks: newSessionLocker(),
+	}
+}
+
 // GetCurrentModel 获取当前选择的模型
 func (s *SessionService) GetCurrentModel(sessionId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return "openai/gpt-4o" // 默认模型
@@ -278,6 +507,8 @@ func (s *SessionService) GetCurrentModel(sessionId string) string {
 
 // SetCurrentModel 设置当前选择的模型
 func (s *SessionService) SetCurrentModel(sessionId string, model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -292,6 +523,8 @@ func (s *SessionService) SetCurrentModel(sessionId string, model string) {
 
 // GetCompareMode 获取是否处于对比模式
 func (s *SessionService) GetCompareMode(sessionId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
 		return false
@@ -302,6 +535,8 @@ func (s *SessionService) GetCompareMode(sessionId string) bool {
 
 // SetCompareMode 设置对比模式
 func (s *SessionService) SetCompareMode(sessionId string, compareMode bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	maxCacheTime := time.Hour * 12
 	sessionContext, ok := s.cache.Get(sessionId)
 	if !ok {
@@ -314,6 +549,15 @@ func (s *SessionService) SetCompareMode(sessionId string, compareMode bool) {
 	s.cache.Set(sessionId, sessionMeta, maxCacheTime)
 }
 
+// trimMsg 限制对话上下文长度，保留第一条（通常是系统提示）并丢弃最早的对话
+func trimMsg(msg []openai.Messages) []openai.Messages {
+	maxLength := 4096
+	for getStrPoolTotalLength(msg) > maxLength {
+		msg = append(msg[:1], msg[2:]...)
+	}
+	return msg
+}
+
 func getStrPoolTotalLength(strPool []openai.Messages) int {
 	var total int
 	for _, v := range strPool {
@@ -321,3 +565,10 @@ func getStrPoolTotalLength(strPool []openai.Messages) int {
 	}
 	return total
 }
+
+func copyMsg(msg []openai.Messages) []openai.Messages {
+	if msg == nil {
+		return nil
+	}
+	return append([]openai.Messages{}, msg...)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"start-feishubot/services/openai"
+)
+
+// 模拟同一话题下连续发送多条消息：每一轮都是 GetMsg → 请求模型 → SetMsg。
+// 不加会话锁时后写入的一轮会覆盖先写入的一轮，历史条数会少于轮数。
+func TestLockSessionPreventsLostUpdate(t *testing.T) {
+	s := newSessionService()
+	sessionId := "om_root"
+	turns := 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < turns; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			unlock := s.LockSession(sessionId)
+			defer unlock()
+
+			msg := s.GetMsg(sessionId)
+			time.Sleep(time.Millisecond) // 模拟模型请求耗时
+			msg = append(msg, openai.Messages{
+				Role: "user", Content: fmt.Sprintf("q%d", i),
+			})
+			s.SetMsg(sessionId, msg)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(s.GetMsg(sessionId)); got != turns {
+		t.Fatalf("expected %d turns in history, got %d", turns, got)
+	}
+	if len(s.locks.locks) != 0 {
+		t.Fatalf("expected session locks to be released, got %d", len(s.locks.locks))
+	}
+}
+
+// 设置类方法与读取历史并发执行时不应出现数据竞争（需配合 go test -race）
+func TestSessionMetaConcurrentAccess(t *testing.T) {
+	s := newSessionService()
+	sessionId := "om_root"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			s.SetAIMode(sessionId, openai.Fresh)
+			s.SetCurrentModel(sessionId, "openai/gpt-4o")
+		}()
+		go func() {
+			defer wg.Done()
+			s.SetMsg(sessionId, []openai.Messages{{Role: "user", Content: "hi"}})
+		}()
+		go func() {
+			defer wg.Done()
+			msg := s.GetMsg(sessionId)
+			if len(msg) > 0 {
+				msg[0].Content = "changed"
+			}
+			_ = s.GetAIMode(sessionId)
+		}()
+	}
+	wg.Wait()
+
+	if msg := s.GetMsg(sessionId); len(msg) != 1 || msg[0].Content != "hi" {
+		t.Fatalf("history was modified through a returned slice: %+v", msg)
+	}
+}
+
+// 编辑第二个问题后重新提问：旧的对话保留为另一个分支，可以切换回去
+func TestForkAtKeepsOldBranch(t *testing.T) {
+	s := newSessionService()
+	sessionId := "om_root"
+	s.SetMsg(sessionId, []openai.Messages{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "q1", FeishuMsgId: "om_q1"},
+		{Role: "assistant", Content: "a1", FeishuMsgId: "om_a1"},
+		{Role: "user", Content: "q2", FeishuMsgId: "om_q2"},
+		{Role: "assistant", Content: "a2", FeishuMsgId: "om_a2"},
+	})
+
+	question, ok := s.FindQuestion(sessionId, "om_a2")
+	if !ok || question.Msg.Content != "q2" {
+		t.Fatalf("expected to find q2 from its answer card, got %+v", question)
+	}
+	if !s.ForkAt(sessionId, question.ID) {
+		t.Fatal("fork failed")
+	}
+	msg := s.GetMsg(sessionId)
+	if len(msg) != 3 {
+		t.Fatalf("expected history to end before q2, got %d messages", len(msg))
+	}
+	msg = append(msg,
+		openai.Messages{Role: "user", Content: "q2 edited"},
+		openai.Messages{Role: "assistant", Content: "a2 edited"})
+	s.SetMsg(sessionId, msg)
+
+	branches := s.GetBranches(sessionId)
+	if len(branches) != 2 {
+		t.Fatalf("expected 2 branches, got %d", len(branches))
+	}
+	if branches[0].LastQuestion != "q2" || branches[0].Current {
+		t.Fatalf("unexpected old branch %+v", branches[0])
+	}
+	if branches[1].LastQuestion != "q2 edited" || !branches[1].Current {
+		t.Fatalf("unexpected new branch %+v", branches[1])
+	}
+
+	s.SwitchBranch(sessionId, branches[0].LeafID)
+	msg = s.GetMsg(sessionId)
+	if got := msg[len(msg)-1].Content; got != "a2" {
+		t.Fatalf("expected to switch back to the old answer, got %q", got)
+	}
+}
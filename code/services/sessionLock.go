@@ -0,0 +1,48 @@
+package services
+
+import "sync"
+
+// sessionLocker 为每个会话提供一把互斥锁，没有使用者时自动回收
+type sessionLocker struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newSessionLocker() *sessionLocker {
+	return &sessionLocker{locks: make(map[string]*sessionLock)}
+}
+
+func (l *sessionLocker) lock(sessionId string) func() {
+	l.mu.Lock()
+	sl, ok := l.locks[sessionId]
+	if !ok {
+		sl = &sessionLock{}
+		l.locks[sessionId] = sl
+	}
+	sl.refs++
+	l.mu.Unlock()
+
+	sl.mu.Lock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sl.mu.Unlock()
+			l.mu.Lock()
+			sl.refs--
+			if sl.refs == 0 {
+				delete(l.locks, sessionId)
+			}
+			l.mu.Unlock()
+		})
+	}
+}
+
+// LockSession 串行化同一会话的对话轮次，不同会话之间互不影响
+func (s *SessionService) LockSession(sessionId string) (unlock func()) {
+	return s.locks.lock(sessionId)
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"start-feishubot/logger"
+)
+
+// Store 简单的 JSON 文件键值存储，用于群设置、自定义角色等少量需要重启后保留的数据。
+// 每次写入都整体落盘，先写临时文件再重命名，避免进程中途退出时留下半个文件
+type Store struct {
+	path string
+	mu   sync.RWMutex
+	data map[string]json.RawMessage
+	// updateMu 让读取-修改-写回依次进行，互不覆盖
+	updateMu sync.Mutex
+}
+
+// Open 打开 path 对应的存储文件，文件不存在时创建一个空存储
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, data: make(map[string]json.RawMessage)}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &s.data); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// OpenOrMemory 打开存储文件，失败时记录错误并退化为仅内存保存，name 是错误日志中数据的名称
+func OpenOrMemory(path string, name string) *Store {
+	s, err := Open(path)
+	if err != nil {
+		logger.Errorf("加载%s失败，本次运行的修改不会保存: %v", name, err)
+		return Memory()
+	}
+	return s
+}
+
+// Memory 不落盘的存储，用于测试或数据目录不可用时
+func Memory() *Store {
+	return &Store{data: make(map[string]json.RawMessage)}
+}
+
+// Get 读取 key 对应的值到 v，key 不存在时返回 false
+func (s *Store) Get(key string, v interface{}) bool {
+	s.mu.RLock()
+	raw, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// Set 写入 key 并落盘
+func (s *Store) Set(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = raw
+	return s.save()
+}
+
+// Delete 删除 key 并落盘
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+	delete(s.data, key)
+	return s.save()
+}
+
+// Atomic 依次执行跨多个 key 的读取-修改-写回，执行期间其它 Atomic 和 Update 等待
+func (s *Store) Atomic(fn func() error) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	return fn()
+}
+
+// Update 把 key 的当前值读到 v（不存在时保持零值），调用 modify 修改后写回；
+// modify 返回错误时不写回
+func (s *Store) Update(key string, v interface{}, modify func() error) error {
+	return s.Atomic(func() error {
+		s.Get(key, v)
+		if err := modify(); err != nil {
+			return err
+		}
+		return s.Set(key, v)
+	})
+}
+
+// Keys 返回以 prefix 开头的所有 key，按字典序排列
+func (s *Store) Keys(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
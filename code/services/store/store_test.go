@@ -0,0 +1,78 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestStorePersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "settings.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("chat:oc_1", map[string]string{"scope": "thread"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Set("chat:oc_2", map[string]string{"scope": "chat"})
+	s.Set("user:ou_1", "x")
+	s.Delete("chat:oc_2")
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]string
+	if !reopened.Get("chat:oc_1", &v) || v["scope"] != "thread" {
+		t.Fatalf("value was not persisted: %v", v)
+	}
+	if keys := reopened.Keys("chat:"); len(keys) != 1 || keys[0] != "chat:oc_1" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+// 并发的读取-修改-写回依次进行，不会丢失修改；modify 出错时不写回
+func TestStoreUpdate(t *testing.T) {
+	s := Memory()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var n int
+			s.Update("count", &n, func() error {
+				n++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	var n int
+	if !s.Get("count", &n) || n != 50 {
+		t.Fatalf("lost updates, got %d", n)
+	}
+	err := s.Update("count", &n, func() error {
+		n = 0
+		return errors.New("rejected")
+	})
+	if err == nil || !s.Get("count", &n) || n != 50 {
+		t.Fatalf("failed update was written back: %d, %v", n, err)
+	}
+}
+
+func TestOpenOrMemoryFallsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.json")
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := OpenOrMemory(path, "测试数据")
+	if err := s.Set("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "{" {
+		t.Fatalf("memory fallback wrote to the broken file: %q", data)
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"path/filepath"
+	"sync"
+
+	"start-feishubot/initialization"
+	"start-feishubot/services/store"
+)
+
+// MaxInstructionRunes 自定义指令的长度上限
+const MaxInstructionRunes = 1500
+
+// UserProfile 用户级别的设置，在所有群和话题中生效
+type UserProfile struct {
+	// Instructions 自定义指令，每次提问时合并到系统提示词中
+	Instructions string `json:"instructions,omitempty"`
+}
+
+type UserProfileInterface interface {
+	Get(userId string) UserProfile
+	Update(userId string, update func(*UserProfile)) error
+}
+
+type UserProfileService struct {
+	store *store.Store
+}
+
+var (
+	userProfileService     *UserProfileService
+	userProfileServiceOnce sync.Once
+)
+
+// GetUserProfiles 用户设置保存在 DATA_DIR/user_profiles.json
+func GetUserProfiles() UserProfileInterface {
+	userProfileServiceOnce.Do(func() {
+		path := filepath.Join(initialization.GetConfig().DataDir, "user_profiles.json")
+		userProfileService = &UserProfileService{store: store.OpenOrMemory(path, "用户设置")}
+	})
+	return userProfileService
+}
+
+func (u *UserProfileService) Get(userId string) UserProfile {
+	var profile UserProfile
+	u.store.Get("user:"+userId, &profile)
+	return profile
+}
+
+func (u *UserProfileService) Update(userId string, update func(*UserProfile)) error {
+	var profile UserProfile
+	return u.store.Update("user:"+userId, &profile, func() error {
+		update(&profile)
+		return nil
+	})
+}
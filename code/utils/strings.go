@@ -1,6 +1,9 @@
 package utils
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
 
 func CutPrefix(s, prefix string) (string, bool) {
 	if strings.HasPrefix(s, prefix) {
@@ -36,3 +39,26 @@ func EitherTrimEqual(s string, prefix ...string) (string, bool) {
 	}
 	return s, false
 }
+
+// Ellipsis 截取前 n 个字符，超出部分用省略号代替
+func Ellipsis(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
+
+var templateVarRegex = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// RenderTemplate 替换模板中的 {{name}} 变量，lookup 只在用到时调用，未知变量原样保留
+func RenderTemplate(tpl string, lookup func(name string) (string, bool)) string {
+	return templateVarRegex.ReplaceAllStringFunc(tpl, func(match string) string {
+		name := templateVarRegex.FindStringSubmatch(match)[1]
+		if value, ok := lookup(name); ok {
+			return value
+		}
+		return match
+	})
+}
@@ -107,3 +107,48 @@ func TestEitherTrimEqual(t *testing.T) {
 		})
 	}
 }
+
+func TestEllipsis(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{name: "Short", s: "你好", n: 5, want: "你好"},
+		{name: "Cut runes", s: "今天天气怎么样", n: 4, want: "今天天气…"},
+		{name: "Collapse spaces", s: "a\n b\tc", n: 10, want: "a b c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Ellipsis(tt.s, tt.n); got != tt.want {
+				t.Errorf("Ellipsis() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	vars := map[string]string{"date": "2024年05月01日", "user_name": "小王"}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+	tests := []struct {
+		name string
+		tpl  string
+		want string
+	}{
+		{name: "Replace", tpl: "今天是{{date}}", want: "今天是2024年05月01日"},
+		{name: "Spaces", tpl: "你好，{{ user_name }}", want: "你好，小王"},
+		{name: "Unknown kept", tpl: "{{chat_name}}群", want: "{{chat_name}}群"},
+		{name: "No vars", tpl: "纯文本", want: "纯文本"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderTemplate(tt.tpl, lookup); got != tt.want {
+				t.Errorf("RenderTemplate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}